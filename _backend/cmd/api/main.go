@@ -3,6 +3,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"log"
@@ -39,6 +40,14 @@ type App struct {
 }
 
 func main() {
+	// Sandbox shim re-executions of this binary never return from here
+	sandbox.Init()
+
+	// Subcommands run against the same database and sandbox, then exit
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		os.Exit(runVerify(os.Args[2:]))
+	}
+
 	// Load configuration from environment
 	config := Config{
 		Port:         getEnv("PORT", "8080"),
@@ -60,16 +69,57 @@ func main() {
 	}
 	log.Println("✅ All migrations applied successfully")
 
+	// Languages come from the database; the built-in ones stay if it fails
+	if err := sandbox.LoadLanguages(database); err != nil {
+		log.Printf("⚠️  Using built-in languages: %v", err)
+	}
+
+	// Initialize code execution sandbox
+	runner, err := sandbox.NewRunnerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize sandbox: %v", err)
+	}
+
+	// Check every language's runtime; missing ones are hidden from learners
+	inventoryCtx, cancelInventory := context.WithTimeout(context.Background(), 2*time.Minute)
+	for _, rt := range sandbox.CheckRuntimes(inventoryCtx, runner) {
+		if rt.Available {
+			log.Printf("🧪 Sandbox: %s runs %s (%s backend)", rt.Language, rt.Detail, rt.Backend)
+		} else {
+			log.Printf("⚠️  Sandbox: hiding %s, its runtime failed: %s", rt.Language, rt.Error)
+		}
+	}
+	cancelInventory()
+
+	schedulerConfig := sandbox.DefaultSchedulerConfig()
+	schedulerConfig.Workers = getEnvInt("SANDBOX_WORKERS", schedulerConfig.Workers)
+	schedulerConfig.QueueSize = getEnvInt("SANDBOX_QUEUE_SIZE", schedulerConfig.Workers*8)
+	schedulerConfig.MaxWait = time.Duration(getEnvInt("SANDBOX_MAX_WAIT_SECONDS", 30)) * time.Second
+	schedulerConfig.MaxPerUser = getEnvInt("SANDBOX_MAX_PER_USER", schedulerConfig.MaxPerUser)
+	schedulerConfig.MaxPerIP = getEnvInt("SANDBOX_MAX_PER_IP", schedulerConfig.MaxPerIP)
+	// Only these peers may name the client in Fly-Client-IP
+	if schedulerConfig.TrustedProxies, err = sandbox.ParseTrustedProxies(os.Getenv("SANDBOX_TRUSTED_PROXIES")); err != nil {
+		log.Fatalf("Invalid SANDBOX_TRUSTED_PROXIES: %v", err)
+	}
+	scheduler := sandbox.NewScheduler(schedulerConfig)
+	log.Printf("🧪 Sandbox: %d workers, queue of %d", schedulerConfig.Workers, schedulerConfig.QueueSize)
+
 	// Initialize handlers
 	authHandler := auth.NewHandlerWithDB(database)
+	sandboxHandler := sandbox.NewHandler(database, runner, scheduler, authHandler)
+
+	// Compare passing submissions in the background to flag copied solutions
+	if minutes := getEnvInt("SIMILARITY_INTERVAL_MINUTES", 15); minutes > 0 {
+		go sandbox.NewSimilarityAnalyzer(database, time.Duration(minutes)*time.Minute).Run(context.Background())
+	}
 	
 	// Initialize app
 	app := &App{
 		config:         config,
 		db:             database,
 		authHandler:    authHandler,
-		sandboxHandler: sandbox.NewHandler(),
-		adminHandler:   admin.NewHandler(database, authHandler),
+		sandboxHandler: sandboxHandler,
+		adminHandler:   admin.NewHandler(database, authHandler, sandboxHandler),
 	}
 
 	// Create router
@@ -116,10 +166,15 @@ func (app *App) registerAPIRoutes(mux *http.ServeMux) {
 	// Exercise routes
 	mux.HandleFunc("GET /api/exercises", app.handleListExercises)
 	mux.HandleFunc("GET /api/exercises/{id}", app.handleGetExercise)
-	mux.HandleFunc("POST /api/exercises/{id}/run", app.handleRunCode)
-	mux.HandleFunc("POST /api/exercises/{id}/submit", app.handleSubmitSolution)
+	mux.HandleFunc("POST /api/exercises/{id}/run", app.sandboxHandler.HandleTest)
+	mux.HandleFunc("POST /api/exercises/{id}/submit", app.sandboxHandler.HandleSubmit)
+	mux.HandleFunc("GET /api/exercises/{id}/attempts", app.sandboxHandler.HandleListAttempts)
+	mux.HandleFunc("GET /api/exercises/{id}/attempts/diff", app.sandboxHandler.HandleDiffAttempts)
+	mux.HandleFunc("GET /api/exercises/{id}/attempts/{attemptId}", app.sandboxHandler.HandleGetAttempt)
 
 	// Sandbox routes
+	mux.HandleFunc("GET /api/languages", app.sandboxHandler.HandleLanguages)
+	mux.HandleFunc("GET /api/sandbox/runtimes", app.sandboxHandler.HandleRuntimes)
 	mux.HandleFunc("POST /api/sandbox/run", app.sandboxHandler.HandleRun)
 	mux.HandleFunc("POST /api/sandbox/test", app.sandboxHandler.HandleTest)
 	mux.HandleFunc("POST /api/sandbox/submit", app.sandboxHandler.HandleSubmit)
@@ -147,6 +202,8 @@ func (app *App) registerAPIRoutes(mux *http.ServeMux) {
 	// Admin dashboard
 	mux.HandleFunc("GET /api/admin/stats", adminMw.RequireAdmin(app.adminHandler.HandleDashboardStats))
 	mux.HandleFunc("GET /api/admin/audit-log", adminMw.RequireAdmin(app.adminHandler.HandleListAuditLog))
+	mux.HandleFunc("GET /api/admin/sandbox/stats", adminMw.RequireAdmin(app.sandboxHandler.HandleStats))
+	mux.HandleFunc("GET /api/admin/similarity", adminMw.RequireAdmin(app.adminHandler.HandleListSimilarity))
 	
 	// Admin - Primitives CRUD
 	mux.HandleFunc("GET /api/admin/primitives", adminMw.RequireAdmin(app.adminHandler.HandleListPrimitives))
@@ -163,6 +220,9 @@ func (app *App) registerAPIRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("POST /api/admin/exercises", adminMw.RequireAdmin(app.adminHandler.HandleCreateExercise))
 	mux.HandleFunc("PUT /api/admin/exercises/{id}", adminMw.RequireAdmin(app.adminHandler.HandleUpdateExercise))
 	mux.HandleFunc("DELETE /api/admin/exercises/{id}", adminMw.RequireAdmin(app.adminHandler.HandleDeleteExercise))
+	mux.HandleFunc("POST /api/admin/exercises/verify", adminMw.RequireAdmin(app.adminHandler.HandleVerifyExercises))
+	mux.HandleFunc("GET /api/admin/exercises/verify", adminMw.RequireAdmin(app.adminHandler.HandleVerifyExercisesStatus))
+	mux.HandleFunc("POST /api/admin/exercises/{id}/verify", adminMw.RequireAdmin(app.adminHandler.HandleVerifyExercise))
 	
 	// Admin - Exercise Starter Code
 	mux.HandleFunc("GET /api/admin/exercises/{exerciseId}/starter-code", adminMw.RequireAdmin(app.adminHandler.HandleListStarterCode))
@@ -264,6 +324,16 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// getEnvInt gets an integer environment variable with fallback
+func getEnvInt(key string, fallback int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
+
 // ============================================
 // Health Check Handler
 // ============================================
@@ -275,12 +345,29 @@ func (app *App) handleHealth(w http.ResponseWriter, r *http.Request) {
 		dbStatus = "unhealthy"
 	}
 
+	// The sandbox is degraded when a language's runtime is missing
+	runtimes := sandbox.Runtimes()
+	sandboxStatus := "healthy"
+	available := 0
+	for _, rt := range runtimes {
+		if rt.Available {
+			available++
+		} else {
+			sandboxStatus = "degraded"
+		}
+	}
+	if len(runtimes) > 0 && available == 0 {
+		sandboxStatus = "unhealthy"
+	}
+
 	response.JSON(w, http.StatusOK, map[string]interface{}{
 		"status":      "healthy",
 		"service":     "programprimitives-api",
 		"version":     "0.1.0",
 		"environment": app.config.Environment,
 		"database":    dbStatus,
+		"sandbox":     sandboxStatus,
+		"runtimes":    runtimes,
 	})
 }
 
@@ -420,37 +507,23 @@ func (app *App) handleListExercises(w http.ResponseWriter, r *http.Request) {
 
 func (app *App) handleGetExercise(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
+	signature := &sandbox.Signature{Name: "sum to n", Params: []sandbox.Param{{Name: "n", Type: "int"}}, Returns: "int"}
+	starterCode := map[string]string{}
+	for _, lang := range sandbox.Languages() {
+		starterCode[lang.ID] = signature.Starter(lang.ID)
+	}
 	exercise := map[string]interface{}{
 		"id": id, "primitiveId": "for-loop", "title": "Sum of Numbers",
 		"description":  "Calculate the sum of all numbers from 1 to n using a for loop",
 		"instructions": "## Your Task\n\nCreate a function `sumToN(n)` that returns the sum of all integers from 1 to n.\n\n### Examples\n```\nsumToN(5)  → 15\nsumToN(10) → 55\n```",
 		"hints":        []string{"Start with a total variable", "Loop from 1 to n", "Add each number to total"},
 		"difficulty":   2, "estimatedMinutes": 5, "isPremium": false,
-		"starterCode": map[string]string{
-			"javascript": "function sumToN(n) {\n  // Your code here\n}",
-			"python":     "def sum_to_n(n):\n    # Your code here\n    pass",
-			"go":         "func sumToN(n int) int {\n    // Your code here\n    return 0\n}",
-		},
+		"signature":    signature,
+		"starterCode":  starterCode,
 	}
 	response.JSON(w, http.StatusOK, exercise)
 }
 
-func (app *App) handleRunCode(w http.ResponseWriter, r *http.Request) {
-	response.JSON(w, http.StatusOK, map[string]interface{}{
-		"output": "15\n", "error": nil, "executionTimeMs": 23,
-	})
-}
-
-func (app *App) handleSubmitSolution(w http.ResponseWriter, r *http.Request) {
-	response.JSON(w, http.StatusOK, map[string]interface{}{
-		"passed": true, "score": 95, "xpEarned": 25, "isFirstCompletion": true,
-		"testResults": []map[string]interface{}{
-			{"testCaseId": "1", "name": "Basic case", "passed": true},
-			{"testCaseId": "2", "name": "Edge case", "passed": true},
-		},
-	})
-}
-
 // ============================================
 // Progress Handlers
 // ============================================
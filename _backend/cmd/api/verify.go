@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/programprimitives/api/internal/db"
+	"github.com/programprimitives/api/internal/sandbox"
+)
+
+// runVerify implements `verify`: it runs every exercise's reference
+// solutions against its test cases and prints a pass/fail matrix. It
+// returns the process exit code, non-zero when any exercise fails.
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	exercise := fs.String("exercise", "", "verify only this exercise ID")
+	fill := fs.String("fill", "", "fill missing expected outputs from this language's reference solution")
+	unpublish := fs.Bool("unpublish", false, "unpublish exercises that fail")
+	verbose := fs.Bool("v", false, "print every failing test case")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	database, err := db.Initialize(getEnv("DATABASE_PATH", "./data/programprimitives.db"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize database: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+	if err := db.RunMigrations(database, "./migrations"); err != nil {
+		fmt.Fprintf(os.Stderr, "Migration failed: %v\n", err)
+		return 1
+	}
+	if err := sandbox.LoadLanguages(database); err != nil {
+		fmt.Fprintf(os.Stderr, "Using built-in languages: %v\n", err)
+	}
+	runner, err := sandbox.NewRunnerFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize sandbox: %v\n", err)
+		return 1
+	}
+
+	ids := []string{*exercise}
+	if *exercise == "" {
+		if ids, err = sandbox.ExerciseIDs(database); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts := sandbox.VerifyOptions{FillExpected: *fill, Unpublish: *unpublish}
+	var results []*sandbox.Verification
+	for _, id := range ids {
+		v, err := sandbox.VerifyExercise(ctx, database, runner, id, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", id, err)
+			return 1
+		}
+		results = append(results, v)
+	}
+
+	return printVerifications(results, *verbose)
+}
+
+// printVerifications writes the matrix, one row per exercise and one
+// column per language, and returns the exit code
+func printVerifications(results []*sandbox.Verification, verbose bool) int {
+	seen := map[string]bool{}
+	var langs []string
+	for _, v := range results {
+		for _, cell := range v.Languages {
+			if !seen[cell.Language] {
+				seen[cell.Language] = true
+				langs = append(langs, cell.Language)
+			}
+		}
+	}
+	sort.Strings(langs)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "EXERCISE\t%s\tRESULT\n", strings.ToUpper(strings.Join(langs, "\t")))
+	failed := 0
+	for _, v := range results {
+		row := []string{v.Slug}
+		for _, lang := range langs {
+			row = append(row, matrixCell(v, lang))
+		}
+		result := "ok"
+		if !v.Passed {
+			failed++
+			result = "FAIL: " + v.Message
+		}
+		if v.Filled > 0 {
+			result += fmt.Sprintf(" (filled %d)", v.Filled)
+		}
+		if v.Unpublished {
+			result += " (unpublished)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", strings.Join(row, "\t"), result)
+	}
+	tw.Flush()
+
+	if verbose {
+		for _, v := range results {
+			for _, cell := range v.Languages {
+				if cell.Status != sandbox.VerifyFailed {
+					continue
+				}
+				fmt.Printf("\n%s [%s]\n", v.Slug, cell.Language)
+				if len(cell.Results) == 0 {
+					fmt.Printf("  %s\n", cell.Message)
+				}
+				for _, r := range cell.Results {
+					if !r.Passed {
+						fmt.Printf("  %s: %s\n", r.Name, r.Message)
+					}
+				}
+			}
+		}
+	}
+
+	fmt.Printf("\n%d exercises, %d passed, %d failed\n", len(results), len(results)-failed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func matrixCell(v *sandbox.Verification, lang string) string {
+	for _, cell := range v.Languages {
+		if cell.Language != lang {
+			continue
+		}
+		switch cell.Status {
+		case sandbox.VerifyPassed:
+			return fmt.Sprintf("pass %d/%d", cell.Passed, cell.Passed+cell.Failed)
+		case sandbox.VerifyFailed:
+			return fmt.Sprintf("FAIL %d/%d", cell.Passed, cell.Passed+cell.Failed)
+		}
+		return "no solution"
+	}
+	return "-"
+}
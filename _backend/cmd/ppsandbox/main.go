@@ -0,0 +1,333 @@
+// ppsandbox runs a solution file against an exercise's test cases without
+// the API server, for authors iterating on exercises. The exercise comes
+// from the SQLite database or from a local exercise bundle.
+//
+//	ppsandbox -exercise two-sum solution.py
+//	ppsandbox -bundle exercises/two-sum -trace solution.js
+//	ppsandbox -bundle exercises/two-sum -all-languages
+//
+// Programs are isolated as on the server, so it runs as root with
+// SANDBOX_UID set; SANDBOX_UNISOLATED=1 runs them as the current user.
+// It exits 1 when any test case fails and 2 when it cannot run.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/programprimitives/api/internal/db"
+	"github.com/programprimitives/api/internal/sandbox"
+)
+
+func main() {
+	// Sandbox shim re-executions of this binary never return from here
+	sandbox.Init()
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// options are the parsed command line
+type options struct {
+	trace    bool
+	caseName string
+	maxSteps int
+	asJSON   bool
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("ppsandbox", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	defaultDB := "./data/programprimitives.db"
+	if path := os.Getenv("DATABASE_PATH"); path != "" {
+		defaultDB = path
+	}
+	dbPath := fs.String("db", defaultDB, "SQLite database to load the exercise from")
+	exercise := fs.String("exercise", "", "exercise ID or slug in the database")
+	bundle := fs.String("bundle", "", "exercise bundle: a directory with exercise.json, or the file itself")
+	language := fs.String("language", "", "language of the file; detected from its extension when empty")
+	all := fs.Bool("all-languages", false, "run every language's reference solution instead of a file")
+	var opts options
+	fs.BoolVar(&opts.trace, "trace", false, "also trace one test case step by step (Python and JavaScript)")
+	fs.StringVar(&opts.caseName, "case", "", "test case to trace, by name or ID; defaults to the first failing one")
+	fs.IntVar(&opts.maxSteps, "max-steps", 0, "trace steps to record")
+	fs.BoolVar(&opts.asJSON, "json", false, "print the JSON responses instead of a report")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: ppsandbox (-exercise ID | -bundle PATH) [flags] (FILE | -all-languages)")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	switch {
+	case (*exercise == "") == (*bundle == ""):
+		fmt.Fprintln(stderr, "ppsandbox: give one of -exercise or -bundle")
+		return 2
+	case *all && fs.NArg() > 0:
+		fmt.Fprintln(stderr, "ppsandbox: -all-languages runs the reference solutions and takes no file")
+		return 2
+	case !*all && fs.NArg() != 1:
+		fs.Usage()
+		return 2
+	}
+
+	var ex *sandbox.LocalExercise
+	var err error
+	if *bundle != "" {
+		ex, err = sandbox.OpenBundle(*bundle)
+	} else {
+		ex, err = openExercise(*dbPath, *exercise)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "ppsandbox: %v\n", err)
+		return 2
+	}
+
+	runner, err := sandbox.NewRunnerFromEnv()
+	if err != nil {
+		fmt.Fprintf(stderr, "ppsandbox: failed to initialize sandbox: %v\n", err)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	out := &reporter{w: stdout, opts: opts}
+
+	if *all {
+		if len(ex.Languages) == 0 {
+			fmt.Fprintf(stderr, "ppsandbox: %s has no languages\n", ex.Slug)
+			return 2
+		}
+		failed := false
+		for _, lang := range ex.Languages {
+			code, err := ex.Solution(lang)
+			if err != nil {
+				out.header(ex, lang, "reference solution")
+				fmt.Fprintf(stdout, "  %v\n", err)
+				failed = true
+				continue
+			}
+			ok, err := check(ctx, runner, out, ex, lang, code, "reference solution")
+			if err != nil {
+				fmt.Fprintf(stderr, "ppsandbox: %s: %v\n", lang, err)
+				return 2
+			}
+			failed = failed || !ok
+		}
+		if failed {
+			return 1
+		}
+		return 0
+	}
+
+	file := fs.Arg(0)
+	src, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(stderr, "ppsandbox: %v\n", err)
+		return 2
+	}
+	lang := *language
+	if lang == "" {
+		if lang = languageFor(file); lang == "" {
+			fmt.Fprintf(stderr, "ppsandbox: cannot tell the language of %s, use -language\n", file)
+			return 2
+		}
+	}
+	ok, err := check(ctx, runner, out, ex, lang, string(src), file)
+	if err != nil {
+		fmt.Fprintf(stderr, "ppsandbox: %v\n", err)
+		return 2
+	}
+	if !ok {
+		return 1
+	}
+	return 0
+}
+
+// check tests code, and traces it when asked, reporting whether it passed
+func check(ctx context.Context, runner sandbox.Runner, out *reporter, ex *sandbox.LocalExercise, lang, code, label string) (bool, error) {
+	resp, err := ex.Test(ctx, runner, lang, code)
+	if err != nil {
+		return false, err
+	}
+	out.header(ex, lang, label)
+	out.results(resp)
+
+	if out.opts.trace {
+		tc, traced, err := ex.Trace(ctx, runner, lang, code, out.opts.caseName, out.opts.maxSteps)
+		if err != nil {
+			out.note(err)
+		} else {
+			out.trace(tc, traced)
+		}
+	}
+	return resp.Success, nil
+}
+
+// openExercise loads an exercise from the database at path, which must
+// already exist
+func openExercise(path, idOrSlug string) (*sandbox.LocalExercise, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	database, err := db.Initialize(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := sandbox.LoadLanguages(database); err != nil {
+		fmt.Fprintf(os.Stderr, "Using built-in languages: %v\n", err)
+	}
+	ex, err := sandbox.OpenExercise(database, idOrSlug)
+	if err == sandbox.ErrExerciseNotFound {
+		return nil, fmt.Errorf("exercise %q not found in %s", idOrSlug, path)
+	}
+	return ex, err
+}
+
+// languageFor picks the language whose source files have file's extension
+func languageFor(file string) string {
+	ext := filepath.Ext(file)
+	for _, lang := range sandbox.Languages() {
+		if lang.Extension == ext {
+			return lang.ID
+		}
+	}
+	return ""
+}
+
+// reporter prints results as text, or as JSON with -json
+type reporter struct {
+	w    io.Writer
+	opts options
+}
+
+func (r *reporter) header(ex *sandbox.LocalExercise, lang, label string) {
+	if r.opts.asJSON {
+		return
+	}
+	title := ex.Slug
+	if ex.Title != "" {
+		title = ex.Title + " (" + ex.Slug + ")"
+	}
+	fmt.Fprintf(r.w, "%s [%s] %s\n", title, lang, label)
+}
+
+func (r *reporter) results(resp *sandbox.TestResponse) {
+	if r.opts.asJSON {
+		r.json(resp)
+		return
+	}
+	for _, d := range resp.Diagnostics {
+		if d.Line > 0 {
+			fmt.Fprintf(r.w, "  line %d: %s\n", d.Line, d.Message)
+		} else {
+			fmt.Fprintf(r.w, "  %s\n", d.Message)
+		}
+	}
+	for _, res := range resp.Results {
+		mark := "PASS"
+		if !res.Passed {
+			mark = "FAIL"
+		}
+		name := res.Name
+		if res.Hidden {
+			name += " (hidden)"
+		}
+		fmt.Fprintf(r.w, "  %s  %s\n", mark, name)
+		if res.Passed {
+			continue
+		}
+		switch {
+		case res.Message != "":
+			fmt.Fprintf(r.w, "        %s\n", res.Message)
+		case res.Expected != "" || res.Actual != "":
+			fmt.Fprintf(r.w, "        expected %s, got %s\n", res.Expected, res.Actual)
+		}
+	}
+	summary := fmt.Sprintf("%d passed, %d failed", resp.Passed, resp.Failed)
+	if resp.ErrorType != "" {
+		summary += " (" + resp.ErrorType + ")"
+	}
+	fmt.Fprintf(r.w, "  %s in %d ms\n\n", summary, resp.ExecutionMs)
+}
+
+func (r *reporter) trace(tc *sandbox.TestCase, resp *sandbox.RunResponse) {
+	if r.opts.asJSON {
+		r.json(map[string]interface{}{"testCase": tc, "run": resp})
+		return
+	}
+	args, _ := json.Marshal(tc.Input)
+	fmt.Fprintf(r.w, "  Trace of %s, input %s\n", tc.Name, args)
+	for _, s := range resp.Trace.Steps {
+		where := s.File + ":" + strconv.Itoa(s.Line)
+		if s.Function != "" {
+			where += " in " + s.Function
+		}
+		indent := strings.Repeat("  ", s.Depth)
+		switch s.Event {
+		case "return":
+			fmt.Fprintf(r.w, "    %s%s returns %s\n", indent, where, s.ReturnValue)
+		case "exception":
+			fmt.Fprintf(r.w, "    %s%s raises %s\n", indent, where, s.Error)
+		default:
+			fmt.Fprintf(r.w, "    %s%s  %s\n", indent, where, locals(s.Locals))
+		}
+	}
+	if resp.Trace.Truncated != "" {
+		fmt.Fprintf(r.w, "    ... stopped early (%s limit)\n", resp.Trace.Truncated)
+	}
+	if resp.Output != "" {
+		fmt.Fprintf(r.w, "  Output:\n%s", indentLines(resp.Output, "    "))
+	}
+	if resp.Error != "" {
+		fmt.Fprintf(r.w, "  Error: %s\n", resp.Error)
+	}
+	fmt.Fprintln(r.w)
+}
+
+func (r *reporter) note(err error) {
+	if r.opts.asJSON {
+		r.json(map[string]string{"error": err.Error()})
+		return
+	}
+	fmt.Fprintf(r.w, "  Trace: %v\n\n", err)
+}
+
+func (r *reporter) json(v interface{}) {
+	enc := json.NewEncoder(r.w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// locals renders a step's variables as name=value pairs in their order
+func locals(raw json.RawMessage) string {
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return ""
+	}
+	var parts []string
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			break
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%v=%s", key, value))
+	}
+	return strings.Join(parts, " ")
+}
+
+func indentLines(s, prefix string) string {
+	lines := strings.SplitAfter(strings.TrimRight(s, "\n")+"\n", "\n")
+	return prefix + strings.Join(lines[:len(lines)-1], prefix)
+}
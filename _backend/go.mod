@@ -6,3 +6,5 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.22
 	golang.org/x/crypto v0.17.0
 )
+
+require github.com/tetratelabs/wazero v1.8.2
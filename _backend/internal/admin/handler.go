@@ -2,15 +2,19 @@
 package admin
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/programprimitives/api/internal/auth"
 	"github.com/programprimitives/api/internal/response"
+	"github.com/programprimitives/api/internal/sandbox"
 )
 
 // Handler manages admin operations
@@ -18,14 +22,26 @@ type Handler struct {
 	db          *sql.DB
 	middleware  *Middleware
 	authHandler *auth.Handler
+	verifier    Verifier
+
+	jobMu sync.Mutex
+	job   *verifyJob // the last verification of every exercise
+}
+
+// Verifier runs an exercise's reference solutions against its test cases,
+// reading the exercise through q
+type Verifier interface {
+	VerifyExercise(ctx context.Context, q sandbox.Querier, id string, opts sandbox.VerifyOptions) (*sandbox.Verification, error)
 }
 
-// NewHandler creates a new admin handler
-func NewHandler(db *sql.DB, authHandler *auth.Handler) *Handler {
+// NewHandler creates a new admin handler. Exercises are only published
+// once verifier passes them.
+func NewHandler(db *sql.DB, authHandler *auth.Handler, verifier Verifier) *Handler {
 	return &Handler{
 		db:          db,
 		middleware:  NewMiddleware(db, authHandler),
 		authHandler: authHandler,
+		verifier:    verifier,
 	}
 }
 
@@ -284,18 +300,26 @@ func (h *Handler) HandleDeletePrimitive(w http.ResponseWriter, r *http.Request)
 // ============================================
 
 type ExerciseInput struct {
-	ID               string   `json:"id"`
-	PrimitiveID      string   `json:"primitiveId"`
-	Title            string   `json:"title"`
-	Slug             string   `json:"slug"`
-	Description      string   `json:"description"`
-	Difficulty       int      `json:"difficulty"`
-	EstimatedMinutes int      `json:"estimatedMinutes"`
-	Instructions     string   `json:"instructions"`
-	Hints            []string `json:"hints"`
-	SequenceOrder    int      `json:"sequenceOrder"`
-	IsPremium        bool     `json:"isPremium"`
-	IsPublished      bool     `json:"isPublished"`
+	ID               string          `json:"id"`
+	PrimitiveID      string          `json:"primitiveId"`
+	Title            string          `json:"title"`
+	Slug             string          `json:"slug"`
+	Description      string          `json:"description"`
+	Difficulty       int             `json:"difficulty"`
+	EstimatedMinutes int             `json:"estimatedMinutes"`
+	Instructions     string          `json:"instructions"`
+	Hints            []string        `json:"hints"`
+	SequenceOrder    int             `json:"sequenceOrder"`
+	IsPremium        bool            `json:"isPremium"`
+	IsPublished      bool            `json:"isPublished"`
+	MemoryLimitMB    int             `json:"memoryLimitMb"`  // 0 uses the sandbox default
+	AllowedImports   []string        `json:"allowedImports"` // modules permitted beyond the language defaults
+	Required         []string        `json:"requiredConstructs"`
+	Forbidden        []string        `json:"forbiddenConstructs"`
+	InputGenerator   json.RawMessage `json:"inputGenerator,omitempty"` // sizes and input template for complexity estimation
+	InputSchema      json.RawMessage `json:"inputSchema,omitempty"`    // random arguments checked against the reference solution
+	Signature        json.RawMessage `json:"signature,omitempty"`      // entry point name and types, for every language
+	Deterministic    bool            `json:"deterministic"`            // seeded randomness and a frozen clock in tests
 }
 
 func (h *Handler) HandleListExercises(w http.ResponseWriter, r *http.Request) {
@@ -304,7 +328,9 @@ func (h *Handler) HandleListExercises(w http.ResponseWriter, r *http.Request) {
 	query := `
 		SELECT e.id, e.primitive_id, e.title, e.slug, e.description, e.difficulty, 
 		       e.estimated_minutes, e.instructions, e.hints, e.sequence_order, 
-		       e.is_premium, e.is_published, e.created_at, e.updated_at,
+		       e.is_premium, (e.is_published = 1 OR e.publish_pending IS NOT NULL), e.memory_limit_mb, e.allowed_imports,
+		       e.required_constructs, e.forbidden_constructs, e.input_generator, e.input_schema,
+		       e.signature, COALESCE(e.deterministic, 0), e.created_at, e.updated_at,
 		       p.name as primitive_name
 		FROM exercises e
 		LEFT JOIN primitives p ON e.primitive_id = p.id
@@ -328,34 +354,44 @@ func (h *Handler) HandleListExercises(w http.ResponseWriter, r *http.Request) {
 	var exercises []map[string]interface{}
 	for rows.Next() {
 		var id, primitiveID, title, slug, description, instructions, createdAt, updatedAt string
-		var hints sql.NullString
+		var hints, allowedImports, required, forbidden, generator, schema, signature sql.NullString
 		var primitiveName sql.NullString
 		var difficulty, estimatedMinutes, sequenceOrder int
-		var isPremium, isPublished bool
+		var isPremium, isPublished, deterministic bool
+		var memoryLimitMB sql.NullInt64
 
 		err := rows.Scan(&id, &primitiveID, &title, &slug, &description, &difficulty,
 			&estimatedMinutes, &instructions, &hints, &sequenceOrder,
-			&isPremium, &isPublished, &createdAt, &updatedAt, &primitiveName)
+			&isPremium, &isPublished, &memoryLimitMB, &allowedImports,
+			&required, &forbidden, &generator, &schema, &signature, &deterministic, &createdAt, &updatedAt, &primitiveName)
 		if err != nil {
 			continue
 		}
 
 		exercises = append(exercises, map[string]interface{}{
-			"id":               id,
-			"primitiveId":      primitiveID,
-			"primitiveName":    nullStringToString(primitiveName),
-			"title":            title,
-			"slug":             slug,
-			"description":      description,
-			"difficulty":       difficulty,
-			"estimatedMinutes": estimatedMinutes,
-			"instructions":     instructions,
-			"hints":            parseJSONArray(hints),
-			"sequenceOrder":    sequenceOrder,
-			"isPremium":        isPremium,
-			"isPublished":      isPublished,
-			"createdAt":        createdAt,
-			"updatedAt":        updatedAt,
+			"id":                  id,
+			"primitiveId":         primitiveID,
+			"primitiveName":       nullStringToString(primitiveName),
+			"title":               title,
+			"slug":                slug,
+			"description":         description,
+			"difficulty":          difficulty,
+			"estimatedMinutes":    estimatedMinutes,
+			"instructions":        instructions,
+			"hints":               parseJSONArray(hints),
+			"sequenceOrder":       sequenceOrder,
+			"isPremium":           isPremium,
+			"isPublished":         isPublished,
+			"memoryLimitMb":       memoryLimitMB.Int64,
+			"allowedImports":      parseJSONArray(allowedImports),
+			"requiredConstructs":  parseJSONArray(required),
+			"forbiddenConstructs": parseJSONArray(forbidden),
+			"inputGenerator":      nullableJSON(generator),
+			"inputSchema":         nullableJSON(schema),
+			"signature":           nullableJSON(signature),
+			"deterministic":       deterministic,
+			"createdAt":           createdAt,
+			"updatedAt":           updatedAt,
 		})
 	}
 
@@ -373,6 +409,29 @@ func (h *Handler) HandleCreateExercise(w http.ResponseWriter, r *http.Request) {
 		response.BadRequest(w, "Primitive ID and title are required")
 		return
 	}
+	if !validMemoryLimit(input.MemoryLimitMB) {
+		response.BadRequest(w, fmt.Sprintf("Memory limit must be between %d and %d MB", sandbox.MinMemoryLimitMB, sandbox.MaxMemoryLimitMB))
+		return
+	}
+	if err := sandbox.ValidateConstructs(input.Required, input.Forbidden); err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+	generator, err := jsonColumn(input.InputGenerator, sandbox.ParseInputGenerator)
+	if err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+	schema, err := jsonColumn(input.InputSchema, sandbox.ParseInputSchema)
+	if err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+	signature, err := jsonColumn(input.Signature, sandbox.ParseSignature)
+	if err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
 
 	// Generate ID and slug if not provided
 	if input.ID == "" {
@@ -383,28 +442,37 @@ func (h *Handler) HandleCreateExercise(w http.ResponseWriter, r *http.Request) {
 	}
 
 	now := time.Now().UTC().Format(time.RFC3339)
-	_, err := h.db.Exec(`
+	saved := h.saveVerified(w, r, func(tx *sql.Tx) (string, bool) {
+		_, err := tx.Exec(`
 		INSERT INTO exercises (id, primitive_id, title, slug, description, difficulty, 
 		                       estimated_minutes, instructions, hints, sequence_order, 
-		                       is_premium, is_published, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		                       is_premium, is_published, memory_limit_mb, allowed_imports,
+		                       required_constructs, forbidden_constructs, input_generator, input_schema,
+		                       signature, deterministic, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
 		input.ID, input.PrimitiveID, input.Title, input.Slug, input.Description,
 		input.Difficulty, input.EstimatedMinutes, input.Instructions,
-		toJSONArray(input.Hints), input.SequenceOrder, input.IsPremium, input.IsPublished, now, now,
-	)
-
-	if err != nil {
-		log.Printf("Error creating exercise: %v", err)
-		response.InternalErrorWithMessage(w, "Failed to create exercise")
-		return
-	}
+		toJSONArray(input.Hints), input.SequenceOrder, input.IsPremium, input.IsPublished,
+		nullableInt(input.MemoryLimitMB), toJSONArray(input.AllowedImports),
+		toJSONArray(input.Required), toJSONArray(input.Forbidden), generator, schema, signature, input.Deterministic, now, now,
+		)
+		if err != nil {
+			log.Printf("Error creating exercise: %v", err)
+			response.InternalErrorWithMessage(w, "Failed to create exercise")
+			return "", false
+		}
+		return input.ID, true
+	})
 
 	// Log action
 	user := h.authHandler.GetUserFromSession(r)
-	if user != nil {
+	if user != nil && saved != saveFailed {
 		h.middleware.LogAction(user.ID, "create", "exercise", input.ID, "", input.Title, r.RemoteAddr)
 	}
+	if saved != saveVerified {
+		return
+	}
 
 	response.JSON(w, http.StatusCreated, map[string]interface{}{
 		"id":      input.ID,
@@ -424,29 +492,79 @@ func (h *Handler) HandleUpdateExercise(w http.ResponseWriter, r *http.Request) {
 		response.BadRequest(w, "Invalid JSON")
 		return
 	}
+	if !validMemoryLimit(input.MemoryLimitMB) {
+		response.BadRequest(w, fmt.Sprintf("Memory limit must be between %d and %d MB", sandbox.MinMemoryLimitMB, sandbox.MaxMemoryLimitMB))
+		return
+	}
+	if err := sandbox.ValidateConstructs(input.Required, input.Forbidden); err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+	generator, err := jsonColumn(input.InputGenerator, sandbox.ParseInputGenerator)
+	if err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+	schema, err := jsonColumn(input.InputSchema, sandbox.ParseInputSchema)
+	if err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+	signature, err := jsonColumn(input.Signature, sandbox.ParseSignature)
+	if err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
 
 	now := time.Now().UTC().Format(time.RFC3339)
-	result, err := h.db.Exec(`
+	saved := h.saveVerified(w, r, func(tx *sql.Tx) (string, bool) {
+		if input.Deterministic {
+			lang, err := nonDeterministicLanguage(tx, id)
+			if err != nil {
+				log.Printf("Error reading starter code: %v", err)
+				response.InternalErrorWithMessage(w, "Failed to update exercise")
+				return "", false
+			}
+			if lang != "" {
+				response.BadRequest(w, sandbox.ErrNotDeterministic.Error())
+				return "", false
+			}
+		}
+		result, err := tx.Exec(`
 		UPDATE exercises SET 
 			primitive_id = ?, title = ?, slug = ?, description = ?, difficulty = ?,
 			estimated_minutes = ?, instructions = ?, hints = ?, sequence_order = ?,
-			is_premium = ?, is_published = ?, updated_at = ?
+			is_premium = ?, is_published = ?, memory_limit_mb = ?, allowed_imports = ?,
+			required_constructs = ?, forbidden_constructs = ?, input_generator = ?, input_schema = ?,
+			signature = ?, deterministic = ?, updated_at = ?
 		WHERE id = ?
 	`,
 		input.PrimitiveID, input.Title, input.Slug, input.Description, input.Difficulty,
 		input.EstimatedMinutes, input.Instructions, toJSONArray(input.Hints),
-		input.SequenceOrder, input.IsPremium, input.IsPublished, now, id,
-	)
-
-	if err != nil {
-		log.Printf("Error updating exercise: %v", err)
-		response.InternalErrorWithMessage(w, "Failed to update exercise")
-		return
-	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		response.NotFound(w, "Exercise not found")
+		input.SequenceOrder, input.IsPremium, input.IsPublished,
+		nullableInt(input.MemoryLimitMB), toJSONArray(input.AllowedImports),
+		toJSONArray(input.Required), toJSONArray(input.Forbidden), generator, schema, signature, input.Deterministic, now, id,
+		)
+		if err != nil {
+			log.Printf("Error updating exercise: %v", err)
+			response.InternalErrorWithMessage(w, "Failed to update exercise")
+			return "", false
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			response.NotFound(w, "Exercise not found")
+			return "", false
+		}
+		if !input.IsPublished {
+			// Cancel the publication an earlier edit is still verifying
+			if _, err := tx.Exec("UPDATE exercises SET publish_pending = NULL WHERE id = ?", id); err != nil {
+				log.Printf("Error updating exercise: %v", err)
+				response.InternalErrorWithMessage(w, "Failed to update exercise")
+				return "", false
+			}
+		}
+		return id, true
+	})
+	if saved != saveVerified {
 		return
 	}
 
@@ -455,6 +573,26 @@ func (h *Handler) HandleUpdateExercise(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// nonDeterministicLanguage returns a language the exercise has code in
+// that cannot run deterministic tests, or "" when there is none
+func nonDeterministicLanguage(tx *sql.Tx, exerciseID string) (string, error) {
+	rows, err := tx.Query("SELECT language FROM exercise_starter_code WHERE exercise_id = ?", exerciseID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var lang string
+		if err := rows.Scan(&lang); err != nil {
+			return "", err
+		}
+		if !sandbox.DeterministicLanguage(lang) {
+			return lang, nil
+		}
+	}
+	return "", rows.Err()
+}
+
 func (h *Handler) HandleDeleteExercise(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if id == "" {
@@ -489,13 +627,14 @@ type StarterCodeInput struct {
 	Language     string `json:"language"`
 	StarterCode  string `json:"starterCode"`
 	SolutionCode string `json:"solutionCode"`
+	EntryPoint   string `json:"entryPoint"` // function the grader calls; from the signature or starter code when empty
 }
 
 func (h *Handler) HandleListStarterCode(w http.ResponseWriter, r *http.Request) {
 	exerciseID := r.PathValue("exerciseId")
 	
 	rows, err := h.db.Query(`
-		SELECT id, exercise_id, language, starter_code, solution_code, created_at, updated_at
+		SELECT id, exercise_id, language, starter_code, solution_code, COALESCE(entry_point, ''), created_at, updated_at
 		FROM exercise_starter_code WHERE exercise_id = ?
 	`, exerciseID)
 	if err != nil {
@@ -504,13 +643,26 @@ func (h *Handler) HandleListStarterCode(w http.ResponseWriter, r *http.Request)
 	}
 	defer rows.Close()
 
+	// Languages without their own starter code get it from the signature
+	var signature *sandbox.Signature
+	var rawSignature sql.NullString
+	h.db.QueryRow("SELECT signature FROM exercises WHERE id = ?", exerciseID).Scan(&rawSignature)
+	if rawSignature.Valid && rawSignature.String != "" {
+		signature, _ = sandbox.ParseSignature([]byte(rawSignature.String))
+	}
+
 	var codes []map[string]interface{}
 	for rows.Next() {
-		var id, exerciseID, language, starterCode, solutionCode, createdAt, updatedAt string
-		rows.Scan(&id, &exerciseID, &language, &starterCode, &solutionCode, &createdAt, &updatedAt)
+		var id, exerciseID, language, starterCode, solutionCode, entryPoint, createdAt, updatedAt string
+		rows.Scan(&id, &exerciseID, &language, &starterCode, &solutionCode, &entryPoint, &createdAt, &updatedAt)
+		generated := signature != nil && strings.TrimSpace(starterCode) == ""
+		if generated {
+			starterCode = signature.Starter(language)
+		}
 		codes = append(codes, map[string]interface{}{
 			"id": id, "exerciseId": exerciseID, "language": language,
-			"starterCode": starterCode, "solutionCode": solutionCode,
+			"starterCode": starterCode, "solutionCode": solutionCode, "entryPoint": entryPoint,
+			"starterGenerated": generated,
 			"createdAt": createdAt, "updatedAt": updatedAt,
 		})
 	}
@@ -526,30 +678,41 @@ func (h *Handler) HandleUpsertStarterCode(w http.ResponseWriter, r *http.Request
 	}
 
 	now := time.Now().UTC().Format(time.RFC3339)
-	
-	// Try update first
-	result, err := h.db.Exec(`
-		UPDATE exercise_starter_code SET starter_code = ?, solution_code = ?, updated_at = ?
-		WHERE exercise_id = ? AND language = ?
-	`, input.StarterCode, input.SolutionCode, now, input.ExerciseID, input.Language)
-
-	if err != nil {
-		response.InternalErrorWithMessage(w, "Failed to update starter code")
-		return
-	}
+	saved := h.saveVerified(w, r, func(tx *sql.Tx) (string, bool) {
+		if !sandbox.DeterministicLanguage(input.Language) {
+			var deterministic bool
+			tx.QueryRow("SELECT COALESCE(deterministic, 0) FROM exercises WHERE id = ?", input.ExerciseID).Scan(&deterministic)
+			if deterministic {
+				response.BadRequest(w, sandbox.ErrNotDeterministic.Error())
+				return "", false
+			}
+		}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		// Insert new
-		_, err = h.db.Exec(`
-			INSERT INTO exercise_starter_code (id, exercise_id, language, starter_code, solution_code, created_at, updated_at)
-			VALUES (?, ?, ?, ?, ?, ?, ?)
-		`, generateID(), input.ExerciseID, input.Language, input.StarterCode, input.SolutionCode, now, now)
-		
+		// Try update first
+		result, err := tx.Exec(`
+			UPDATE exercise_starter_code SET starter_code = ?, solution_code = ?, entry_point = ?, updated_at = ?
+			WHERE exercise_id = ? AND language = ?
+		`, input.StarterCode, input.SolutionCode, input.EntryPoint, now, input.ExerciseID, input.Language)
 		if err != nil {
-			response.InternalErrorWithMessage(w, "Failed to create starter code")
-			return
+			response.InternalErrorWithMessage(w, "Failed to update starter code")
+			return "", false
+		}
+
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			// Insert new
+			_, err = tx.Exec(`
+				INSERT INTO exercise_starter_code (id, exercise_id, language, starter_code, solution_code, entry_point, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			`, generateID(), input.ExerciseID, input.Language, input.StarterCode, input.SolutionCode, input.EntryPoint, now, now)
+			if err != nil {
+				response.InternalErrorWithMessage(w, "Failed to create starter code")
+				return "", false
+			}
 		}
+		return input.ExerciseID, true
+	})
+	if saved != saveVerified {
+		return
 	}
 
 	response.JSON(w, http.StatusOK, map[string]interface{}{
@@ -562,22 +725,24 @@ func (h *Handler) HandleUpsertStarterCode(w http.ResponseWriter, r *http.Request
 // ============================================
 
 type TestCaseInput struct {
-	ID             string `json:"id"`
-	ExerciseID     string `json:"exerciseId"`
-	Name           string `json:"name"`
-	Description    string `json:"description"`
-	Input          string `json:"input"`
-	ExpectedOutput string `json:"expectedOutput"`
-	IsHidden       bool   `json:"isHidden"`
-	TimeoutMs      int    `json:"timeoutMs"`
-	SequenceOrder  int    `json:"sequenceOrder"`
+	ID             string          `json:"id"`
+	ExerciseID     string          `json:"exerciseId"`
+	Name           string          `json:"name"`
+	Description    string          `json:"description"`
+	Input          string          `json:"input"`
+	ExpectedOutput string          `json:"expectedOutput"`
+	IsHidden       bool            `json:"isHidden"`
+	TimeoutMs      int             `json:"timeoutMs"`
+	SequenceOrder  int             `json:"sequenceOrder"`
+	Checker        json.RawMessage `json:"checker,omitempty"` // how results are judged; exact when absent
+	Clock          string          `json:"clock,omitempty"`   // frozen time in deterministic exercises, RFC 3339
 }
 
 func (h *Handler) HandleListTestCases(w http.ResponseWriter, r *http.Request) {
 	exerciseID := r.PathValue("exerciseId")
 	
 	rows, err := h.db.Query(`
-		SELECT id, exercise_id, name, description, input, expected_output, is_hidden, timeout_ms, sequence_order
+		SELECT id, exercise_id, name, description, input, expected_output, is_hidden, timeout_ms, sequence_order, checker, clock
 		FROM exercise_test_cases WHERE exercise_id = ? ORDER BY sequence_order
 	`, exerciseID)
 	if err != nil {
@@ -589,14 +754,15 @@ func (h *Handler) HandleListTestCases(w http.ResponseWriter, r *http.Request) {
 	var tests []map[string]interface{}
 	for rows.Next() {
 		var id, exerciseID, name, input, expectedOutput string
-		var description sql.NullString
+		var description, checker, clock sql.NullString
 		var isHidden bool
 		var timeoutMs, sequenceOrder int
-		rows.Scan(&id, &exerciseID, &name, &description, &input, &expectedOutput, &isHidden, &timeoutMs, &sequenceOrder)
+		rows.Scan(&id, &exerciseID, &name, &description, &input, &expectedOutput, &isHidden, &timeoutMs, &sequenceOrder, &checker, &clock)
 		tests = append(tests, map[string]interface{}{
 			"id": id, "exerciseId": exerciseID, "name": name, "description": nullStringToString(description),
 			"input": input, "expectedOutput": expectedOutput, "isHidden": isHidden,
-			"timeoutMs": timeoutMs, "sequenceOrder": sequenceOrder,
+			"timeoutMs": timeoutMs, "sequenceOrder": sequenceOrder, "checker": nullableJSON(checker),
+			"clock": nullStringToString(clock),
 		})
 	}
 
@@ -616,15 +782,39 @@ func (h *Handler) HandleCreateTestCase(w http.ResponseWriter, r *http.Request) {
 	if input.TimeoutMs == 0 {
 		input.TimeoutMs = 5000
 	}
+	timeout := time.Duration(input.TimeoutMs) * time.Millisecond
+	if timeout < sandbox.MinTestTimeout || timeout > sandbox.MaxTestTimeout {
+		response.BadRequest(w, fmt.Sprintf("Timeout must be between %d and %d ms",
+			sandbox.MinTestTimeout.Milliseconds(), sandbox.MaxTestTimeout.Milliseconds()))
+		return
+	}
+	checker, err := jsonColumn(input.Checker, sandbox.ParseChecker)
+	if err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+	var clock sql.NullString
+	if input.Clock != "" {
+		if _, err := sandbox.ParseClock(input.Clock); err != nil {
+			response.BadRequest(w, err.Error())
+			return
+		}
+		clock = sql.NullString{String: input.Clock, Valid: true}
+	}
 
 	now := time.Now().UTC().Format(time.RFC3339)
-	_, err := h.db.Exec(`
-		INSERT INTO exercise_test_cases (id, exercise_id, name, description, input, expected_output, is_hidden, timeout_ms, sequence_order, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, input.ID, input.ExerciseID, input.Name, input.Description, input.Input, input.ExpectedOutput, input.IsHidden, input.TimeoutMs, input.SequenceOrder, now)
-
-	if err != nil {
-		response.InternalErrorWithMessage(w, "Failed to create test case")
+	saved := h.saveVerified(w, r, func(tx *sql.Tx) (string, bool) {
+		_, err := tx.Exec(`
+			INSERT INTO exercise_test_cases (id, exercise_id, name, description, input, expected_output, is_hidden, timeout_ms, sequence_order, checker, clock, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, input.ID, input.ExerciseID, input.Name, input.Description, input.Input, input.ExpectedOutput, input.IsHidden, input.TimeoutMs, input.SequenceOrder, checker, clock, now)
+		if err != nil {
+			response.InternalErrorWithMessage(w, "Failed to create test case")
+			return "", false
+		}
+		return input.ExerciseID, true
+	})
+	if saved != saveVerified {
 		return
 	}
 
@@ -636,10 +826,253 @@ func (h *Handler) HandleCreateTestCase(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) HandleDeleteTestCase(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
-	h.db.Exec("DELETE FROM exercise_test_cases WHERE id = ?", id)
+	saved := h.saveVerified(w, r, func(tx *sql.Tx) (string, bool) {
+		var exerciseID string
+		err := tx.QueryRow("SELECT exercise_id FROM exercise_test_cases WHERE id = ?", id).Scan(&exerciseID)
+		if err == sql.ErrNoRows {
+			response.NotFound(w, "Test case not found")
+			return "", false
+		}
+		if err == nil {
+			_, err = tx.Exec("DELETE FROM exercise_test_cases WHERE id = ?", id)
+		}
+		if err != nil {
+			log.Printf("Error deleting test case %s: %v", id, err)
+			response.InternalErrorWithMessage(w, "Failed to delete test case")
+			return "", false
+		}
+		return exerciseID, true
+	})
+	if saved != saveVerified {
+		return
+	}
 	response.JSON(w, http.StatusOK, map[string]interface{}{"message": "Test case deleted"})
 }
 
+// ============================================
+// Exercise Verification
+// ============================================
+
+// HandleVerifyExercise runs one exercise's reference solutions against its
+// test cases, optionally filling in missing expected outputs
+func (h *Handler) HandleVerifyExercise(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	opts, ok := verifyOptions(w, r)
+	if !ok {
+		return
+	}
+
+	v, err := h.verifier.VerifyExercise(r.Context(), h.db, id, opts)
+	if err == sandbox.ErrExerciseNotFound {
+		response.NotFound(w, "Exercise not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error verifying exercise %s: %v", id, err)
+		response.InternalErrorWithMessage(w, "Failed to verify exercise")
+		return
+	}
+	h.logVerification(h.authHandler.GetUserFromSession(r), r.RemoteAddr, v)
+
+	response.JSON(w, http.StatusOK, v)
+}
+
+// verifyJob is a verification of every exercise, run in the background
+// since it can take minutes
+type verifyJob struct {
+	Running    bool                    `json:"running"`
+	StartedAt  time.Time               `json:"startedAt"`
+	FinishedAt *time.Time              `json:"finishedAt,omitempty"`
+	Total      int                     `json:"total"`
+	Passed     int                     `json:"passed"`
+	Failed     int                     `json:"failed"`
+	Error      string                  `json:"error,omitempty"`
+	Exercises  []*sandbox.Verification `json:"exercises"`
+}
+
+// HandleVerifyExercises starts verifying every exercise unless a run is
+// already going, and returns the run's progress
+func (h *Handler) HandleVerifyExercises(w http.ResponseWriter, r *http.Request) {
+	opts, ok := verifyOptions(w, r)
+	if !ok {
+		return
+	}
+	ids, err := sandbox.ExerciseIDs(h.db)
+	if err != nil {
+		log.Printf("Error listing exercises: %v", err)
+		response.InternalErrorWithMessage(w, "Failed to list exercises")
+		return
+	}
+
+	h.jobMu.Lock()
+	if h.job == nil || !h.job.Running {
+		h.job = &verifyJob{Running: true, StartedAt: time.Now().UTC(), Total: len(ids), Exercises: []*sandbox.Verification{}}
+		go h.verifyAll(h.job, ids, opts, h.authHandler.GetUserFromSession(r), r.RemoteAddr)
+	}
+	h.jobMu.Unlock()
+
+	response.JSON(w, http.StatusAccepted, h.verifyProgress())
+}
+
+// HandleVerifyExercisesStatus returns the progress of the last run started
+// by HandleVerifyExercises
+func (h *Handler) HandleVerifyExercisesStatus(w http.ResponseWriter, r *http.Request) {
+	job := h.verifyProgress()
+	if job == nil {
+		response.NotFound(w, "No verification has been started")
+		return
+	}
+	response.JSON(w, http.StatusOK, job)
+}
+
+// verifyAll runs job, verifying one exercise at a time so learners keep
+// most of the sandbox workers
+func (h *Handler) verifyAll(job *verifyJob, ids []string, opts sandbox.VerifyOptions, user *auth.User, addr string) {
+	for _, id := range ids {
+		v, err := h.verifier.VerifyExercise(context.Background(), h.db, id, opts)
+		h.jobMu.Lock()
+		if err != nil {
+			log.Printf("Error verifying exercise %s: %v", id, err)
+			job.Error = "Failed to verify exercise " + id
+			h.jobMu.Unlock()
+			break
+		}
+		if v.Passed {
+			job.Passed++
+		} else {
+			job.Failed++
+		}
+		job.Exercises = append(job.Exercises, v)
+		h.jobMu.Unlock()
+		h.logVerification(user, addr, v)
+	}
+
+	h.jobMu.Lock()
+	finished := time.Now().UTC()
+	job.Running = false
+	job.FinishedAt = &finished
+	h.jobMu.Unlock()
+}
+
+// verifyProgress copies the current job, nil when none was started
+func (h *Handler) verifyProgress() *verifyJob {
+	h.jobMu.Lock()
+	defer h.jobMu.Unlock()
+	if h.job == nil {
+		return nil
+	}
+	job := *h.job
+	job.Exercises = append([]*sandbox.Verification{}, h.job.Exercises...)
+	return &job
+}
+
+// verifyOptions reads an optional JSON body of verification options
+func verifyOptions(w http.ResponseWriter, r *http.Request) (sandbox.VerifyOptions, bool) {
+	var opts sandbox.VerifyOptions
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			response.BadRequest(w, "Invalid JSON")
+			return opts, false
+		}
+	}
+	return opts, true
+}
+
+// Outcomes of saveVerified
+const (
+	saveFailed     = iota // nothing was saved; the response is written
+	saveVerified          // saved, and verified if the exercise is to be published
+	saveUnpublished       // saved unpublished since it failed verification; the response is written
+)
+
+// saveVerified runs save, which edits one exercise's content and returns
+// its ID, in a transaction. An exercise that is published after the edit,
+// or awaiting publication from an earlier one, is committed unpublished and
+// verified outside the transaction, so other writers are not blocked while
+// the solutions run and learners never see content that fails. It is
+// published again if it passes and no later edit has taken over.
+func (h *Handler) saveVerified(w http.ResponseWriter, r *http.Request, save func(tx *sql.Tx) (string, bool)) int {
+	tx, err := h.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		response.InternalError(w)
+		return saveFailed
+	}
+	defer tx.Rollback()
+
+	id, ok := save(tx)
+	if !ok {
+		return saveFailed
+	}
+	var published bool
+	var pending sql.NullString
+	err = tx.QueryRow("SELECT is_published, publish_pending FROM exercises WHERE id = ?", id).Scan(&published, &pending)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error loading exercise %s: %v", id, err)
+		response.InternalError(w)
+		return saveFailed
+	}
+	token := ""
+	if published || pending.Valid {
+		token = generateID()
+		_, err = tx.Exec("UPDATE exercises SET is_published = 0, publish_pending = ? WHERE id = ?", token, id)
+		if err != nil {
+			log.Printf("Error staging exercise %s: %v", id, err)
+			response.InternalError(w)
+			return saveFailed
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error saving exercise %s: %v", id, err)
+		response.InternalError(w)
+		return saveFailed
+	}
+	if token == "" {
+		return saveVerified
+	}
+
+	// The token stays set when verification cannot run, so the next edit
+	// verifies again
+	v, err := h.verifier.VerifyExercise(r.Context(), h.db, id, sandbox.VerifyOptions{})
+	if err != nil {
+		log.Printf("Error verifying exercise %s: %v", id, err)
+		response.InternalErrorWithMessage(w, "Saved as unpublished: could not verify the exercise")
+		return saveUnpublished
+	}
+	publish := "UPDATE exercises SET is_published = 1, publish_pending = NULL WHERE id = ? AND publish_pending = ?"
+	if !v.Passed {
+		publish = "UPDATE exercises SET publish_pending = NULL WHERE id = ? AND publish_pending = ?"
+	}
+	res, err := h.db.Exec(publish, id, token)
+	if err != nil {
+		log.Printf("Error publishing exercise %s: %v", id, err)
+		response.InternalErrorWithMessage(w, "Saved as unpublished: could not publish the exercise")
+		return saveUnpublished
+	}
+	if v.Passed {
+		return saveVerified
+	}
+	n, _ := res.RowsAffected()
+	v.Unpublished = n > 0
+
+	h.logVerification(h.authHandler.GetUserFromSession(r), r.RemoteAddr, v)
+	response.ErrorWithData(w, http.StatusUnprocessableEntity, response.ErrVerification,
+		"Saved as unpublished: "+v.Message, v)
+	return saveUnpublished
+}
+
+// logVerification records verifications that changed content
+func (h *Handler) logVerification(user *auth.User, addr string, v *sandbox.Verification) {
+	if v.Filled == 0 && !v.Unpublished || user == nil {
+		return
+	}
+	summary := fmt.Sprintf("filled %d expected outputs", v.Filled)
+	if v.Unpublished {
+		summary += "; unpublished: " + v.Message
+	}
+	h.middleware.LogAction(user.ID, "verify", "exercise", v.ExerciseID, "", summary, addr)
+}
+
 // ============================================
 // Syntax CRUD
 // ============================================
@@ -853,3 +1286,33 @@ func nullStringToString(ns sql.NullString) string {
 	}
 	return ""
 }
+
+// nullableInt stores zero as NULL
+func nullableInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
+
+// validMemoryLimit accepts zero (sandbox default) or a bounded ceiling
+func validMemoryLimit(mb int) bool {
+	return mb == 0 || (mb >= sandbox.MinMemoryLimitMB && mb <= sandbox.MaxMemoryLimitMB)
+}
+
+// jsonColumn validates an optional JSON column for storage with parse,
+// the sandbox's parser for it; an absent value is stored as NULL
+func jsonColumn[T any](raw json.RawMessage, parse func([]byte) (T, error)) (sql.NullString, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return sql.NullString{}, nil
+	}
+	if _, err := parse(raw); err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(raw), Valid: true}, nil
+}
+
+// nullableJSON returns a stored JSON column as raw JSON, or nil
+func nullableJSON(ns sql.NullString) interface{} {
+	if !ns.Valid || ns.String == "" {
+		return nil
+	}
+	return json.RawMessage(ns.String)
+}
@@ -0,0 +1,40 @@
+// Package admin - Submission similarity report
+package admin
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/programprimitives/api/internal/response"
+	"github.com/programprimitives/api/internal/sandbox"
+)
+
+// HandleListSimilarity lists clusters of learners whose passing submissions
+// look copied from one another. Optional query parameters: exerciseId,
+// language and min, the lowest similarity to report.
+func (h *Handler) HandleListSimilarity(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	threshold := sandbox.DefaultSimilarityThreshold
+	if v := q.Get("min"); v != "" {
+		min, err := strconv.ParseFloat(v, 64)
+		if err != nil || min < sandbox.MinSimilarityThreshold || min > 1 {
+			response.BadRequest(w, fmt.Sprintf("min must be a number between %g and 1", sandbox.MinSimilarityThreshold))
+			return
+		}
+		threshold = min
+	}
+
+	clusters, err := sandbox.SimilarityClusters(h.db, q.Get("exerciseId"), q.Get("language"), threshold)
+	if err != nil {
+		log.Printf("Error listing similar submissions: %v", err)
+		response.InternalErrorWithMessage(w, "Failed to list similar submissions")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"threshold": threshold,
+		"clusters":  clusters,
+	})
+}
@@ -16,11 +16,22 @@ import (
 
 // Initialize creates and opens the SQLite database
 func Initialize(dbPath string) (*sql.DB, error) {
-	// Ensure directory exists
+	// Ensure directory exists. The database holds sessions, password
+	// hashes and hidden test cases, so only the server may read it.
 	dir := filepath.Dir(dbPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	if err := os.MkdirAll(dir, 0700); err != nil {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
+	f, err := os.OpenFile(dbPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database: %w", err)
+	}
+	f.Close()
+	for _, path := range []string{dbPath, dbPath + "-wal", dbPath + "-shm"} {
+		if err := os.Chmod(path, 0600); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to restrict database: %w", err)
+		}
+	}
 
 	// Open database with WAL mode for better concurrent access
 	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=ON")
@@ -40,6 +40,7 @@ const (
 	ErrEmailTaken         = "EMAIL_TAKEN"
 	ErrSessionExpired     = "SESSION_EXPIRED"
 	ErrInvalidToken       = "INVALID_TOKEN"
+	ErrVerification       = "VERIFICATION_FAILED"
 )
 
 // JSON sends a successful JSON response
@@ -76,6 +77,20 @@ func Error(w http.ResponseWriter, status int, code, message string) {
 	})
 }
 
+// ErrorWithData sends an error JSON response that carries data explaining it
+func ErrorWithData(w http.ResponseWriter, status int, code, message string, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: false,
+		Data:    data,
+		Error: &APIError{
+			Code:    code,
+			Message: message,
+		},
+	})
+}
+
 // ValidationError sends a validation error response with field details
 func ValidationError(w http.ResponseWriter, message string, details map[string][]string) {
 	w.Header().Set("Content-Type", "application/json")
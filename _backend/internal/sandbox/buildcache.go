@@ -0,0 +1,296 @@
+package sandbox
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BuildCacheStats reports how well the build cache is doing
+type BuildCacheStats struct {
+	Entries   int     `json:"entries"`
+	Bytes     int64   `json:"bytes"`
+	MaxBytes  int64   `json:"maxBytes"`
+	Hits      int64   `json:"hits"`
+	Misses    int64   `json:"misses"`
+	Evictions int64   `json:"evictions"`
+	HitRatio  float64 `json:"hitRatio"`
+}
+
+// buildCache keeps the artifacts of successful compiles on disk, one
+// directory per build key, and evicts the least recently used builds once
+// they take up more than maxBytes. A build's key is a hash of everything
+// that goes into it, so entries never go stale; they only fall out of use.
+type buildCache struct {
+	dir      string
+	maxBytes int64
+
+	mu       sync.Mutex
+	entries  map[string]*buildEntry
+	size     int64
+	versions map[string]string // toolchain version output by version command
+	stats    BuildCacheStats
+}
+
+type buildEntry struct {
+	size int64
+	used time.Time
+}
+
+// newBuildCache opens the cache in dir, picking up builds left by earlier
+// runs of the server
+func newBuildCache(dir string, maxBytes int64) (*buildCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create build cache: %w", err)
+	}
+	c := &buildCache{dir: dir, maxBytes: maxBytes, entries: map[string]*buildEntry{}, versions: map[string]string{}}
+
+	items, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build cache: %w", err)
+	}
+	for _, item := range items {
+		path := filepath.Join(dir, item.Name())
+		info, err := item.Info()
+		if err != nil || !item.IsDir() || !isBuildKey(item.Name()) {
+			// Half-written builds from a crash
+			os.RemoveAll(path)
+			continue
+		}
+		size, err := dirSize(path)
+		if err != nil {
+			os.RemoveAll(path)
+			continue
+		}
+		c.entries[item.Name()] = &buildEntry{size: size, used: info.ModTime()}
+		c.size += size
+	}
+
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// key hashes the toolchain, its version and the program's sources. The
+// harness input is left out: drivers read it at run time, so every test
+// case of a submission shares one build.
+func (c *buildCache) key(tc Toolchain, version string, files map[string]string) string {
+	sources := make(map[string]string, len(files))
+	for name, content := range files {
+		if name != harnessInputFile {
+			sources[name] = content
+		}
+	}
+	// encoding/json sorts map keys, which makes the encoding canonical
+	blob, _ := json.Marshal(struct {
+		Language  string
+		Version   string
+		Compile   []string
+		Env       []string
+		Artifacts []string
+		Support   map[string]string
+		Sources   map[string]string
+	}{tc.Language, version, tc.Compile, tc.Env, tc.Artifacts, tc.Support, sources})
+	sum := sha256.Sum256(blob)
+	return hex.EncodeToString(sum[:])
+}
+
+// restore copies a cached build's artifacts into dir, reporting whether
+// the build was there
+func (c *buildCache) restore(key, dir string, artifacts []string) bool {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok {
+		entry.used = time.Now()
+	}
+	c.mu.Unlock()
+
+	if ok {
+		src := filepath.Join(c.dir, key)
+		for _, name := range artifacts {
+			// Copies, not links: a sandboxed program running as the server's
+			// user could otherwise rewrite the cached build
+			if err := copyFile(filepath.Join(src, name), filepath.Join(dir, name)); err != nil {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			now := time.Now()
+			os.Chtimes(src, now, now)
+		}
+	}
+
+	c.mu.Lock()
+	if ok {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+	c.mu.Unlock()
+	return ok
+}
+
+// store saves a build's artifacts from dir under key
+func (c *buildCache) store(key, dir string, artifacts []string) error {
+	tmp, err := os.MkdirTemp(c.dir, "tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create build cache entry: %w", err)
+	}
+	var size int64
+	for _, name := range artifacts {
+		if err := copyFile(filepath.Join(dir, name), filepath.Join(tmp, name)); err != nil {
+			os.RemoveAll(tmp)
+			return fmt.Errorf("failed to cache %s: %w", name, err)
+		}
+		if info, err := os.Stat(filepath.Join(tmp, name)); err == nil {
+			size += info.Size()
+		}
+	}
+	if err := os.Chmod(tmp, 0755); err != nil {
+		os.RemoveAll(tmp)
+		return fmt.Errorf("failed to create build cache entry: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; ok {
+		// The same build finished concurrently
+		os.RemoveAll(tmp)
+		return nil
+	}
+	if err := os.Rename(tmp, filepath.Join(c.dir, key)); err != nil {
+		os.RemoveAll(tmp)
+		return fmt.Errorf("failed to create build cache entry: %w", err)
+	}
+	c.entries[key] = &buildEntry{size: size, used: time.Now()}
+	c.size += size
+	c.evict()
+	return nil
+}
+
+// evict removes the least recently used builds until the cache fits.
+// Callers hold c.mu.
+func (c *buildCache) evict() {
+	for c.size > c.maxBytes && len(c.entries) > 0 {
+		oldest := ""
+		for key, entry := range c.entries {
+			if oldest == "" || entry.used.Before(c.entries[oldest].used) {
+				oldest = key
+			}
+		}
+		if err := os.RemoveAll(filepath.Join(c.dir, oldest)); err != nil {
+			log.Printf("Failed to evict build %s: %v", oldest, err)
+		}
+		c.size -= c.entries[oldest].size
+		delete(c.entries, oldest)
+		c.stats.Evictions++
+	}
+}
+
+// Stats returns a snapshot of the cache's counters
+func (c *buildCache) Stats() BuildCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st := c.stats
+	st.Entries = len(c.entries)
+	st.Bytes = c.size
+	st.MaxBytes = c.maxBytes
+	if lookups := st.Hits + st.Misses; lookups > 0 {
+		st.HitRatio = float64(st.Hits) / float64(lookups)
+	}
+	return st
+}
+
+// version returns the output of the toolchain's version command, running
+// it once per command. Failures are not remembered, so a runtime installed
+// later is picked up.
+func (c *buildCache) version(ctx context.Context, p *ProcessRunner, dir string, tc Toolchain, env []string) (string, error) {
+	if len(tc.Version) == 0 {
+		return "", nil
+	}
+	id := strings.Join(append(append([]string{}, tc.Version...), tc.Env...), "\x00")
+
+	c.mu.Lock()
+	v, ok := c.versions[id]
+	c.mu.Unlock()
+	if ok {
+		return v, nil
+	}
+
+	res, err := p.exec(ctx, dir, step{argv: tc.Version, env: env, limits: p.cfg.CompileLimits})
+	if err != nil {
+		return "", err
+	}
+	if res.ExitCode != 0 || res.TimedOut {
+		return "", fmt.Errorf("%s failed: %s", tc.Version[0], strings.TrimSpace(res.Stderr))
+	}
+	v = strings.TrimSpace(res.Stdout + res.Stderr)
+
+	c.mu.Lock()
+	c.versions[id] = v
+	c.mu.Unlock()
+	return v, nil
+}
+
+func isBuildKey(name string) bool {
+	if len(name) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// copyFile copies src to dst, keeping its permission bits
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
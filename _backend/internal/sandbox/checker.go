@@ -0,0 +1,336 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Checker types a test case can declare
+const (
+	CheckExact     = "exact"     // the returned value equals the expected one as JSON
+	CheckTolerance = "tolerance" // numbers may be off by Abs, or by Rel of the expected value
+	CheckSet       = "set"       // the returned array holds the expected items, in any order and count
+	CheckMultiset  = "multiset"  // the returned array holds the expected items, in any order
+	CheckStdout    = "stdout"    // the printed output equals the expected text, ignoring spacing
+	CheckRegex     = "regex"     // the returned string, or the printed output, matches Pattern
+	CheckCustom    = "custom"    // a checker program decides
+)
+
+// Checker decides whether a test case's result is right. A nil Checker
+// compares exactly.
+type Checker struct {
+	Type    string  `json:"type"`
+	Abs     float64 `json:"abs,omitempty"`
+	Rel     float64 `json:"rel,omitempty"`
+	Pattern string  `json:"pattern,omitempty"`
+	Stdout  bool    `json:"stdout,omitempty"` // regex: match the printed output instead of the returned string
+
+	// Language and Code make up a custom checker. It reads the case as a
+	// JSON object with input, expected, actual and stdout from stdin, and
+	// prints {"passed": bool, "message": string} as its last line.
+	Language string `json:"language,omitempty"`
+	Code     string `json:"code,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// defaultTolerance applies when a tolerance checker sets neither bound
+const defaultTolerance = 1e-6
+
+// checkerOutputBytes bounds a custom checker's own output
+const checkerOutputBytes = 64 << 10
+
+// ParseChecker decodes and validates a test case's checker
+func ParseChecker(raw []byte) (*Checker, error) {
+	var c Checker
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, fmt.Errorf("invalid checker: %w", err)
+	}
+	switch c.Type {
+	case CheckExact, CheckSet, CheckMultiset, CheckStdout:
+	case CheckTolerance:
+		if c.Abs < 0 || c.Rel < 0 || math.IsNaN(c.Abs) || math.IsNaN(c.Rel) {
+			return nil, errors.New("tolerance must not be negative")
+		}
+		if c.Abs == 0 && c.Rel == 0 {
+			c.Abs = defaultTolerance
+		}
+	case CheckRegex:
+		re, err := regexp.Compile(`^(?:` + c.Pattern + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("invalid checker pattern: %w", err)
+		}
+		c.re = re
+	case CheckCustom:
+		if !validLang(c.Language) {
+			return nil, fmt.Errorf("unsupported checker language %q", c.Language)
+		}
+		if strings.TrimSpace(c.Code) == "" {
+			return nil, errors.New("custom checker has no code")
+		}
+	default:
+		return nil, fmt.Errorf("unknown checker type %q", c.Type)
+	}
+	return &c, nil
+}
+
+// comparesValues reports whether the checker judges the returned value
+// alone, so it can also judge results that have no printed output
+func (c *Checker) comparesValues() bool {
+	return c.Type != CheckStdout && !(c.Type == CheckRegex && c.Stdout)
+}
+
+// checkVerdict is a checker's decision on one result
+type checkVerdict struct {
+	passed    bool
+	actual    string // the result as shown to the learner
+	message   string // why the result is wrong
+	errorType string // overrides the logic error a mismatch is reported as
+}
+
+// check judges the value the entry point returned and the output the
+// program printed against the test case
+func (c *Checker) check(ctx context.Context, runner Runner, tc TestCase, value json.RawMessage, stdout string) (checkVerdict, error) {
+	v := checkVerdict{actual: compactJSON(value)}
+	expected := toJSON(tc.Expected)
+	typ := CheckExact
+	if c != nil {
+		typ = c.Type
+	}
+
+	switch typ {
+	case CheckExact:
+		v.passed = valuesEqual(tc.Expected, value)
+		v.message = fmt.Sprintf("Expected %s but got %s", expected, v.actual)
+	case CheckTolerance:
+		var got interface{}
+		json.Unmarshal(value, &got)
+		v.message = c.withinTolerance(normalizeJSON(tc.Expected), got, "")
+		v.passed = v.message == ""
+	case CheckSet, CheckMultiset:
+		v.message = c.sameItems(normalizeJSON(tc.Expected), value)
+		v.passed = v.message == ""
+	case CheckStdout:
+		v.actual = toJSON(stdout)
+		want, _ := tc.Expected.(string)
+		v.message = outputDiff(want, stdout)
+		v.passed = v.message == ""
+	case CheckRegex:
+		subject := stdout
+		if c.Stdout {
+			v.actual = toJSON(stdout)
+		} else if err := json.Unmarshal(value, &subject); err != nil {
+			v.message = fmt.Sprintf("Expected a string matching /%s/ but got %s", c.Pattern, v.actual)
+			return v, nil
+		}
+		subject = strings.TrimRight(subject, "\n")
+		v.passed = c.re.MatchString(subject)
+		v.message = fmt.Sprintf("%s does not match /%s/", toJSON(subject), c.Pattern)
+	case CheckCustom:
+		return c.runCustom(ctx, runner, tc, value, stdout, v)
+	}
+	return v, nil
+}
+
+// normalizeJSON gives a Go value the shape it would have after a JSON
+// round trip, so it compares with decoded results
+func normalizeJSON(v interface{}) interface{} {
+	var out interface{}
+	json.Unmarshal([]byte(toJSON(v)), &out)
+	return out
+}
+
+// withinTolerance compares numbers with the checker's tolerance and
+// everything else exactly, returning what differs at path
+func (c *Checker) withinTolerance(want, got interface{}, path string) string {
+	where := ""
+	if path != "" {
+		where = path + ": "
+	}
+	switch w := want.(type) {
+	case float64:
+		g, ok := got.(float64)
+		if !ok {
+			return fmt.Sprintf("%sexpected a number but got %s", where, toJSON(got))
+		}
+		allowed := math.Max(c.Abs, c.Rel*math.Abs(w))
+		if math.Abs(g-w) > allowed {
+			return fmt.Sprintf("%sexpected %v (within %g) but got %v", where, w, allowed, g)
+		}
+		return ""
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok {
+			return fmt.Sprintf("%sexpected an array but got %s", where, toJSON(got))
+		}
+		if len(g) != len(w) {
+			return fmt.Sprintf("%sexpected %d items but got %d", where, len(w), len(g))
+		}
+		for i := range w {
+			if msg := c.withinTolerance(w[i], g[i], fmt.Sprintf("%s[%d]", path, i)); msg != "" {
+				return msg
+			}
+		}
+		return ""
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok || len(g) != len(w) {
+			return fmt.Sprintf("%sexpected %s but got %s", where, toJSON(want), toJSON(got))
+		}
+		for key := range w {
+			if msg := c.withinTolerance(w[key], g[key], path+"."+key); msg != "" {
+				return msg
+			}
+		}
+		return ""
+	}
+	if toJSON(want) != toJSON(got) {
+		return fmt.Sprintf("%sexpected %s but got %s", where, toJSON(want), toJSON(got))
+	}
+	return ""
+}
+
+// sameItems compares two arrays as sets or multisets of JSON values,
+// returning which items are missing or extra
+func (c *Checker) sameItems(want interface{}, value json.RawMessage) string {
+	var got interface{}
+	json.Unmarshal(value, &got)
+	w, ok := want.([]interface{})
+	if !ok {
+		return "The test's expected value is not an array"
+	}
+	g, ok := got.([]interface{})
+	if !ok {
+		return fmt.Sprintf("Expected an array but got %s", compactJSON(value))
+	}
+
+	count := func(items []interface{}) map[string]int {
+		counts := map[string]int{}
+		for _, item := range items {
+			if c.Type == CheckSet {
+				counts[toJSON(item)] = 1
+			} else {
+				counts[toJSON(item)]++
+			}
+		}
+		return counts
+	}
+	wantCounts, gotCounts := count(w), count(g)
+	var missing, extra, wrong []string
+	for item, n := range wantCounts {
+		switch m := gotCounts[item]; {
+		case m == 0:
+			missing = append(missing, item)
+		case m != n:
+			wrong = append(wrong, fmt.Sprintf("%s appears %d times instead of %d", item, m, n))
+		}
+	}
+	for item := range gotCounts {
+		if wantCounts[item] == 0 {
+			extra = append(extra, item)
+		}
+	}
+	if len(missing)+len(extra)+len(wrong) == 0 {
+		return ""
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	sort.Strings(wrong)
+
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "missing "+strings.Join(missing, ", "))
+	}
+	if len(extra) > 0 {
+		problems = append(problems, "unexpected "+strings.Join(extra, ", "))
+	}
+	problems = append(problems, wrong...)
+	return fmt.Sprintf("Expected the items of %s in any order but got %s: %s", toJSON(want), compactJSON(value), strings.Join(problems, "; "))
+}
+
+// outputDiff compares printed output line by line, ignoring differences in
+// spacing and blank lines at the end, and describes the first difference
+func outputDiff(want, got string) string {
+	lines := func(s string) []string {
+		out := strings.Split(strings.TrimRight(s, " \t\r\n"), "\n")
+		for i, line := range out {
+			out[i] = strings.Join(strings.Fields(line), " ")
+		}
+		if len(out) == 1 && out[0] == "" {
+			return nil
+		}
+		return out
+	}
+	w, g := lines(want), lines(got)
+	for i := 0; i < len(w) && i < len(g); i++ {
+		if w[i] != g[i] {
+			return fmt.Sprintf("Output line %d: expected %q but got %q", i+1, w[i], g[i])
+		}
+	}
+	switch {
+	case len(g) < len(w):
+		return fmt.Sprintf("Output ended after %d lines; line %d should be %q", len(g), len(g)+1, w[len(g)])
+	case len(g) > len(w):
+		return fmt.Sprintf("Output has %d lines but should have %d; line %d is %q", len(g), len(w), len(w)+1, g[len(w)])
+	}
+	return ""
+}
+
+// runCustom runs the checker program in the sandbox on the case and the
+// learner's result
+func (c *Checker) runCustom(ctx context.Context, runner Runner, tc TestCase, value json.RawMessage, stdout string, v checkVerdict) (checkVerdict, error) {
+	var actual interface{}
+	json.Unmarshal(value, &actual)
+	stdin, err := json.Marshal(map[string]interface{}{
+		"input":    testArgs(tc.Input),
+		"expected": tc.Expected,
+		"actual":   actual,
+		"stdout":   stdout,
+	})
+	if err != nil {
+		return v, fmt.Errorf("failed to encode checker input: %w", err)
+	}
+
+	toolchain, _ := lookupToolchain(c.Language)
+	limits := languageLimits(c.Language)
+	limits.OutputBytes = checkerOutputBytes
+	res, err := runner.Run(ctx, Program{
+		Language: c.Language,
+		Files:    map[string]string{toolchain.MainFile: c.Code},
+		Stdin:    string(stdin),
+		Limits:   limits,
+	})
+	if err != nil {
+		return v, err
+	}
+
+	var verdict struct {
+		Passed  *bool  `json:"passed"`
+		Message string `json:"message"`
+	}
+	out := strings.TrimSpace(res.Stdout)
+	if i := strings.LastIndexByte(out, '\n'); i >= 0 {
+		out = out[i+1:]
+	}
+	if res.Failed() || json.Unmarshal([]byte(out), &verdict) != nil || verdict.Passed == nil {
+		reason := runResponse(res).Error
+		if reason == "" {
+			reason = "it printed no verdict"
+		}
+		v.message = "Checker failed: " + reason
+		v.errorType = ErrorRuntime
+		return v, nil
+	}
+	v.passed = *verdict.Passed
+	v.message = verdict.Message
+	if v.message == "" {
+		v.message = "The checker rejected the result " + v.actual
+	}
+	return v, nil
+}
@@ -0,0 +1,94 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestCheckerCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		checker  string // empty compares exactly
+		expected interface{}
+		value    string
+		stdout   string
+		passed   bool
+	}{
+		{"exact equal", "", []interface{}{1, 2}, `[1,2]`, "", true},
+		{"exact differs", "", []interface{}{1, 2}, `[2,1]`, "", false},
+		{"exact type", `{"type":"exact"}`, "1", `1`, "", false},
+		{"tolerance default", `{"type":"tolerance"}`, 0.3, `0.30000000000000004`, "", true},
+		{"tolerance abs", `{"type":"tolerance","abs":0.1}`, 1.0, `1.05`, "", true},
+		{"tolerance abs exceeded", `{"type":"tolerance","abs":0.01}`, 1.0, `1.05`, "", false},
+		{"tolerance rel", `{"type":"tolerance","rel":0.01}`, 1000.0, `1005`, "", true},
+		{"tolerance nested", `{"type":"tolerance","abs":0.1}`, map[string]interface{}{"x": []interface{}{1.0, 2.0}}, `{"x":[1.01,1.99]}`, "", true},
+		{"tolerance length", `{"type":"tolerance"}`, []interface{}{1.0}, `[1,2]`, "", false},
+		{"tolerance non-number", `{"type":"tolerance"}`, 1.0, `"1"`, "", false},
+		{"set any order", `{"type":"set"}`, []interface{}{1, 2, 3}, `[3,1,2]`, "", true},
+		{"set ignores counts", `{"type":"set"}`, []interface{}{1, 2}, `[2,2,1]`, "", true},
+		{"set missing", `{"type":"set"}`, []interface{}{1, 2}, `[1]`, "", false},
+		{"set not array", `{"type":"set"}`, []interface{}{1}, `1`, "", false},
+		{"multiset any order", `{"type":"multiset"}`, []interface{}{"a", "b", "a"}, `["a","a","b"]`, "", true},
+		{"multiset counts", `{"type":"multiset"}`, []interface{}{1, 2}, `[2,2,1]`, "", false},
+		{"stdout spacing", `{"type":"stdout"}`, "a  b\nc\n", `null`, "a b\nc\n\n", true},
+		{"stdout differs", `{"type":"stdout"}`, "a\nb", `null`, "a\nc", false},
+		{"stdout short", `{"type":"stdout"}`, "a\nb", `null`, "a", false},
+		{"regex value", `{"type":"regex","pattern":"[0-9]+ ms"}`, nil, `"12 ms"`, "", true},
+		{"regex anchored", `{"type":"regex","pattern":"[0-9]+"}`, nil, `"12 ms"`, "", false},
+		{"regex non-string", `{"type":"regex","pattern":".*"}`, nil, `12`, "", false},
+		{"regex stdout", `{"type":"regex","pattern":"id-[a-f0-9]+","stdout":true}`, nil, `null`, "id-3fa9\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var checker *Checker
+			if tt.checker != "" {
+				var err error
+				if checker, err = ParseChecker([]byte(tt.checker)); err != nil {
+					t.Fatalf("ParseChecker: %v", err)
+				}
+			}
+			tc := TestCase{Expected: tt.expected, Checker: checker}
+			v, err := checker.check(context.Background(), nil, tc, json.RawMessage(tt.value), tt.stdout)
+			if err != nil {
+				t.Fatalf("check: %v", err)
+			}
+			if v.passed != tt.passed {
+				t.Errorf("passed = %v, want %v (%s)", v.passed, tt.passed, v.message)
+			}
+		})
+	}
+}
+
+func TestParseChecker(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    string
+		valid  bool
+		values bool // compares returned values
+	}{
+		{"exact", `{"type":"exact"}`, true, true},
+		{"tolerance", `{"type":"tolerance","abs":0.5}`, true, true},
+		{"negative tolerance", `{"type":"tolerance","abs":-1}`, false, false},
+		{"regex", `{"type":"regex","pattern":"a+"}`, true, true},
+		{"regex stdout", `{"type":"regex","pattern":"a+","stdout":true}`, true, false},
+		{"bad regex", `{"type":"regex","pattern":"("}`, false, false},
+		{"stdout", `{"type":"stdout"}`, true, false},
+		{"custom", `{"type":"custom","language":"python","code":"print(1)"}`, true, true},
+		{"custom without code", `{"type":"custom","language":"python"}`, false, false},
+		{"custom unknown language", `{"type":"custom","language":"cobol","code":"x"}`, false, false},
+		{"unknown type", `{"type":"fuzzy"}`, false, false},
+		{"not json", `exact`, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseChecker([]byte(tt.raw))
+			if (err == nil) != tt.valid {
+				t.Fatalf("ParseChecker error = %v, want valid %v", err, tt.valid)
+			}
+			if err == nil && c.comparesValues() != tt.values {
+				t.Errorf("comparesValues = %v, want %v", c.comparesValues(), tt.values)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Benchmark bounds
+const (
+	benchTimeout  = 10 * time.Second      // one process timing every size
+	benchBudget   = 50 * time.Millisecond // repeated calls per size, for a stable mean
+	benchRuns     = 3                     // processes per program; the median run's time is fitted
+	minBenchSizes = 3                     // sizes needed to fit a curve
+)
+
+// ComplexityReport compares how the learner's solution and the reference
+// solution grow with input size, measured by timing both on the same
+// generated inputs
+type ComplexityReport struct {
+	Growth    string             `json:"growth"`              // estimated class of the learner's solution, e.g. "O(n²)"
+	Reference string             `json:"reference,omitempty"` // estimated class of the reference solution
+	Slower    bool               `json:"slower"`              // asymptotically worse than the reference
+	Message   string             `json:"message,omitempty"`
+	Samples   []ComplexitySample `json:"samples"`
+}
+
+// ComplexitySample is the mean time of one call at one input size
+type ComplexitySample struct {
+	N           int     `json:"n"`
+	LearnerMs   float64 `json:"learnerMs,omitempty"` // missing past a timeout
+	ReferenceMs float64 `json:"referenceMs,omitempty"`
+}
+
+// growthClass is a candidate curve, in increasing order of growth
+type growthClass struct {
+	name string
+	f    func(n float64) float64
+}
+
+var growthClasses = []growthClass{
+	{"O(1)", func(n float64) float64 { return 1 }},
+	{"O(log n)", func(n float64) float64 { return math.Log2(n + 1) }},
+	{"O(n)", func(n float64) float64 { return n }},
+	{"O(n log n)", func(n float64) float64 { return n * math.Log2(n+1) }},
+	{"O(n²)", func(n float64) float64 { return n * n }},
+	{"O(n³)", func(n float64) float64 { return n * n * n }},
+}
+
+// estimateComplexity times the learner's code and the exercise's reference
+// solution on the generator's inputs. It returns nil when the exercise has
+// no generator or the learner's code could not be timed at enough sizes.
+func estimateComplexity(ctx context.Context, runner Runner, lang, code, entry string, spec *exerciseSpec) (*ComplexityReport, error) {
+	if spec.Generator == nil {
+		return nil, nil
+	}
+	inputs, err := spec.Generator.Generate()
+	if err != nil {
+		return nil, nil
+	}
+
+	// The programs take turns so load on the machine slows both alike. A
+	// program that stops before the last size is not run again: it would
+	// only time out again.
+	var learnerRuns, referenceRuns [][]float64
+	stopped := func(runs [][]float64) bool {
+		return len(runs) > 0 && len(runs[len(runs)-1]) < len(inputs)
+	}
+	refEntry := spec.entryFor(lang, spec.Solution)
+	for run := 0; run < benchRuns; run++ {
+		if !stopped(learnerRuns) {
+			times, err := benchmark(ctx, runner, lang, code, entry, spec.Signature, inputs, spec.Limits)
+			if err != nil {
+				return nil, err
+			}
+			learnerRuns = append(learnerRuns, times)
+		}
+		if spec.Solution != "" && !stopped(referenceRuns) {
+			times, err := benchmark(ctx, runner, lang, spec.Solution, refEntry, spec.Signature, inputs, spec.Limits)
+			if err != nil {
+				return nil, err
+			}
+			referenceRuns = append(referenceRuns, times)
+		}
+	}
+	learner, reference := medianTimes(learnerRuns), medianTimes(referenceRuns)
+
+	sizes := spec.Generator.Sizes
+	report := &ComplexityReport{}
+	for i, n := range sizes {
+		if i >= len(learner) && i >= len(reference) {
+			break
+		}
+		sample := ComplexitySample{N: n}
+		if i < len(learner) {
+			sample.LearnerMs = nsToMs(learner[i])
+		}
+		if i < len(reference) {
+			sample.ReferenceMs = nsToMs(reference[i])
+		}
+		report.Samples = append(report.Samples, sample)
+	}
+
+	if len(reference) >= minBenchSizes && len(learner) < len(reference) {
+		// The learner's code ran out of time where the reference did not
+		n := sizes[len(learner)]
+		report.Growth = "unknown"
+		refGrowth, _ := fitGrowth(sizes, reference)
+		report.Reference = growthClasses[refGrowth].name
+		report.Slower = true
+		report.Message = fmt.Sprintf("Your solution ran out of time at n = %d, which the reference solution handles in %s ms. Look for loops nested inside loops.", n, formatMs(reference[len(learner)]))
+		return report, nil
+	}
+	if len(learner) < minBenchSizes {
+		return nil, nil
+	}
+
+	growth, slope := fitGrowth(sizes, learner)
+	report.Growth = growthClasses[growth].name
+	if len(reference) < minBenchSizes {
+		return report, nil
+	}
+	refGrowth, refSlope := fitGrowth(sizes, reference)
+	report.Reference = growthClasses[refGrowth].name
+
+	// Both the class and the measured slope must agree before flagging, so
+	// timing noise alone does not
+	if growth > refGrowth && slope-refSlope >= 0.5 {
+		report.Slower = true
+		report.Message = fmt.Sprintf("Your solution grows like %s while the reference grows like %s: doubling the input makes yours about %.0f× slower. Look for work repeated inside a loop.",
+			report.Growth, report.Reference, math.Pow(2, slope))
+	}
+	return report, nil
+}
+
+// benchmark runs code in bench mode and returns the mean nanoseconds per
+// call for each size it finished, in order. Sizes after a timeout or
+// error are missing.
+func benchmark(ctx context.Context, runner Runner, lang, code, entry string, sig *Signature, inputs [][]interface{}, limits Limits) ([]float64, error) {
+	files, problem := harnessFiles(lang, code, entry, sig)
+	if problem != "" {
+		return nil, nil
+	}
+	marker, err := newMarker()
+	if err != nil {
+		return nil, err
+	}
+	input, err := json.Marshal(harnessInput{Marker: marker, Args: []interface{}{}, Bench: inputs, BudgetNs: benchBudget.Nanoseconds()})
+	if err != nil {
+		return nil, nil
+	}
+	files[harnessInputFile] = string(input)
+
+	limits.WallTime = benchTimeout
+	limits.CPUTime = benchTimeout
+	res, err := runner.Run(ctx, Program{Language: lang, Files: files, Limits: limits})
+	if err != nil {
+		return nil, err
+	}
+
+	var times []float64
+	for _, line := range strings.Split(res.Stdout, "\n") {
+		idx := strings.Index(line, marker)
+		if idx < 0 {
+			continue
+		}
+		var outcome harnessOutcome
+		if json.Unmarshal([]byte(line[idx+len(marker):]), &outcome) != nil || outcome.Kind != "bench" || outcome.Size != len(times) {
+			break
+		}
+		times = append(times, outcome.Ns)
+	}
+	return times, nil
+}
+
+// medianTimes combines repeated benchmark runs into the median time per
+// size, over the runs that finished it. A size is kept while at least half
+// the runs finished it, so one slow run cannot cut the series short.
+func medianTimes(runs [][]float64) []float64 {
+	var out []float64
+	for i := 0; ; i++ {
+		var times []float64
+		for _, run := range runs {
+			if i < len(run) {
+				times = append(times, run[i])
+			}
+		}
+		if len(times) == 0 || 2*len(times) < len(runs) {
+			return out
+		}
+		sort.Float64s(times)
+		mid := len(times) / 2
+		if len(times)%2 == 0 {
+			out = append(out, (times[mid-1]+times[mid])/2)
+		} else {
+			out = append(out, times[mid])
+		}
+	}
+}
+
+// fitGrowth picks the growth class whose curve, scaled by a constant,
+// best matches the timings in log space. It also returns the log-log
+// slope of the timings.
+func fitGrowth(sizes []int, ns []float64) (int, float64) {
+	k := len(ns)
+	xs := make([]float64, k)
+	ys := make([]float64, k)
+	for i := 0; i < k; i++ {
+		xs[i] = math.Log(float64(sizes[i]))
+		ys[i] = math.Log(math.Max(ns[i], 1))
+	}
+	slope := regressionSlope(xs, ys)
+
+	// Timings that barely change are constant, whatever the noise says
+	if slope < 0.1 {
+		return 0, slope
+	}
+
+	best, bestVar := 0, math.Inf(1)
+	for c, class := range growthClasses {
+		// Residuals of log t - log f(n); the constant factor is their mean
+		var mean, sq float64
+		for i := 0; i < k; i++ {
+			r := ys[i] - math.Log(class.f(float64(sizes[i])))
+			mean += r
+			sq += r * r
+		}
+		mean /= float64(k)
+		if v := sq/float64(k) - mean*mean; v < bestVar {
+			best, bestVar = c, v
+		}
+	}
+	return best, slope
+}
+
+// nsToMs converts a timing to milliseconds at microsecond precision
+func nsToMs(ns float64) float64 {
+	return math.Round(ns/1e3) / 1e3
+}
+
+// formatMs renders a timing for a message
+func formatMs(ns float64) string {
+	if ms := nsToMs(ns); ms > 0 {
+		return strconv.FormatFloat(ms, 'f', -1, 64)
+	}
+	return "under 0.001"
+}
+
+// regressionSlope is the least-squares slope of ys against xs
+func regressionSlope(xs, ys []float64) float64 {
+	n := float64(len(xs))
+	var sx, sy, sxx, sxy float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+		sxx += xs[i] * xs[i]
+		sxy += xs[i] * ys[i]
+	}
+	d := n*sxx - sx*sx
+	if d == 0 {
+		return 0
+	}
+	return (n*sxy - sx*sy) / d
+}
@@ -0,0 +1,72 @@
+package sandbox
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestFitGrowth(t *testing.T) {
+	sizes := []int{100, 200, 400, 800, 1600}
+	curve := func(f func(n float64) float64, scale float64, noise ...float64) []float64 {
+		ns := make([]float64, len(sizes))
+		for i, n := range sizes {
+			ns[i] = scale * f(float64(n))
+			if i < len(noise) {
+				ns[i] *= noise[i]
+			}
+		}
+		return ns
+	}
+	linear := func(n float64) float64 { return n }
+	tests := []struct {
+		name  string
+		ns    []float64
+		class string
+		slope float64 // expected log-log slope, within 0.15
+	}{
+		{"constant", curve(func(float64) float64 { return 1 }, 50), "O(1)", 0},
+		{"constant with noise", curve(func(float64) float64 { return 1 }, 50, 1.1, 0.9, 1.05, 1, 1.1), "O(1)", 0},
+		{"logarithmic", curve(math.Log2, 100), "O(log n)", 0.13},
+		{"linear", curve(linear, 3), "O(n)", 1},
+		{"linear with noise", curve(linear, 3, 1.2, 0.9, 1.1, 1, 0.95), "O(n)", 1},
+		{"n log n", curve(func(n float64) float64 { return n * math.Log2(n) }, 3), "O(n log n)", 1.13},
+		{"quadratic", curve(func(n float64) float64 { return n * n }, 0.5), "O(n²)", 2},
+		{"cubic", curve(func(n float64) float64 { return n * n * n }, 0.01), "O(n³)", 3},
+		{"below a nanosecond", curve(func(float64) float64 { return 0.2 }, 1), "O(1)", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class, slope := fitGrowth(sizes, tt.ns)
+			if got := growthClasses[class].name; got != tt.class {
+				t.Errorf("class = %s, want %s", got, tt.class)
+			}
+			if math.Abs(slope-tt.slope) > 0.15 {
+				t.Errorf("slope = %.2f, want about %.2f", slope, tt.slope)
+			}
+		})
+	}
+}
+
+func TestMedianTimes(t *testing.T) {
+	tests := []struct {
+		name string
+		runs [][]float64
+		want []float64
+	}{
+		{"no runs", nil, nil},
+		{"one run", [][]float64{{1, 2, 3}}, []float64{1, 2, 3}},
+		{"odd runs", [][]float64{{1, 20, 3}, {2, 2, 30}, {3, 4, 4}}, []float64{2, 4, 4}},
+		{"even runs", [][]float64{{1, 2}, {3, 6}}, []float64{2, 4}},
+		{"one short run", [][]float64{{1, 2, 3}, {1, 2}}, []float64{1, 2, 3}},
+		{"most runs short", [][]float64{{1, 2, 3}, {1, 2}, {1}}, []float64{1, 2}},
+		{"slow outlier", [][]float64{{10, 20, 40}, {10, 900, 40}, {11, 21, 41}}, []float64{10, 21, 40}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := medianTimes(tt.runs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("medianTimes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
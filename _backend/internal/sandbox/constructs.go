@@ -0,0 +1,329 @@
+package sandbox
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+// Constructs an exercise can require or forbid. Any other name refers to a
+// call of that function, method or Go package, such as sum, reduce or sort.
+const (
+	ConstructLoop        = "loop"        // any loop, comprehensions included
+	ConstructFor         = "for"         // a for statement
+	ConstructWhile       = "while"       // a while loop, or a condition-only for in Go
+	ConstructConditional = "conditional" // if, switch, match or a conditional expression
+	ConstructRecursion   = "recursion"   // a function that calls itself
+	ConstructFunction    = "function"    // a function besides the entry point
+)
+
+var constructLabels = map[string]string{
+	ConstructLoop:        "a loop",
+	ConstructFor:         "a for loop",
+	ConstructWhile:       "a while loop",
+	ConstructConditional: "a conditional",
+	ConstructRecursion:   "recursion",
+	ConstructFunction:    "a helper function",
+}
+
+// Calls that stand for the same construct across languages
+var constructCalls = map[string][]string{
+	"reduce":  {"reduce", "reduceRight"},
+	"reverse": {"reverse", "reversed", "toReversed", "slices.Reverse"},
+	"sort":    {"sort", "sorted", "toSorted", "slices.Sort", "slices.SortFunc", "slices.SortStableFunc"},
+	"sum":     {"sum", "fsum"},
+}
+
+var constructNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// ValidateConstructs checks an exercise's construct lists. Required
+// entries must be structural constructs; forbidden ones may also name calls.
+func ValidateConstructs(required, forbidden []string) error {
+	for _, c := range required {
+		if _, ok := constructLabels[c]; !ok {
+			return fmt.Errorf("unknown required construct %q", c)
+		}
+	}
+	for _, c := range forbidden {
+		if !constructNamePattern.MatchString(c) {
+			return fmt.Errorf("invalid forbidden construct %q", c)
+		}
+	}
+	return nil
+}
+
+// constructSet records the first line each construct or call appears on
+type constructSet map[string]int
+
+func (cs constructSet) add(name string, line int) {
+	if _, ok := cs[name]; !ok {
+		cs[name] = line
+	}
+}
+
+// find returns the line a construct first appears on, or 0
+func (cs constructSet) find(construct string) int {
+	names := constructCalls[construct]
+	if names == nil {
+		names = []string{construct}
+	}
+	for _, name := range names {
+		if line := cs[name]; line > 0 {
+			return line
+		}
+	}
+	return 0
+}
+
+// checkConstructs reports each required and forbidden construct as a test
+// result. Code that cannot be analyzed yields no results; it fails to
+// compile anyway.
+func (spec *exerciseSpec) checkConstructs(lang, code, entry string) []TestResult {
+	if len(spec.Required) == 0 && len(spec.Forbidden) == 0 {
+		return nil
+	}
+	var cs constructSet
+	switch dialect(lang) {
+	case LangGo:
+		cs = goConstructs(code, entry)
+	case LangJavaScript:
+		cs = jsConstructs(code, entry)
+	case LangPython:
+		cs = pyConstructs(code, entry)
+	}
+	if cs == nil {
+		return nil
+	}
+
+	var results []TestResult
+	for _, c := range spec.Required {
+		line := cs.find(c)
+		r := TestResult{ID: "required:" + c, Name: "Uses " + constructLabel(c), Passed: line > 0}
+		if r.Passed {
+			r.Message = fmt.Sprintf("Uses %s on line %d", constructLabel(c), line)
+		} else {
+			r.Message = fmt.Sprintf("This exercise practices %s; solve it using %s", constructLabel(c), constructLabel(c))
+			r.ErrorType = ErrorConstruct
+		}
+		results = append(results, r)
+	}
+	for _, c := range spec.Forbidden {
+		line := cs.find(c)
+		r := TestResult{ID: "forbidden:" + c, Name: "Avoids " + constructLabel(c), Passed: line == 0}
+		if r.Passed {
+			r.Message = "Does not use " + constructLabel(c)
+		} else {
+			r.Message = fmt.Sprintf("Line %d uses %s; solve this exercise without it", line, constructLabel(c))
+			r.ErrorType = ErrorConstruct
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+func constructLabel(c string) string {
+	if label, ok := constructLabels[c]; ok {
+		return label
+	}
+	return c + "()"
+}
+
+// goConstructs walks a Go program's AST
+func goConstructs(code, entry string) constructSet {
+	src := goSource(code)
+	offset := strings.Count(src, "\n") - strings.Count(code, "\n")
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, 0)
+	if err != nil {
+		return nil
+	}
+	line := func(p token.Pos) int { return fset.Position(p).Line - offset }
+
+	cs := constructSet{}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		if fn.Name.Name != entry && fn.Name.Name != "main" {
+			cs.add(ConstructFunction, line(fn.Pos()))
+		}
+
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.ForStmt:
+				cs.add(ConstructLoop, line(n.Pos()))
+				if n.Init == nil && n.Post == nil {
+					cs.add(ConstructWhile, line(n.Pos()))
+				} else {
+					cs.add(ConstructFor, line(n.Pos()))
+				}
+			case *ast.RangeStmt:
+				cs.add(ConstructLoop, line(n.Pos()))
+				cs.add(ConstructFor, line(n.Pos()))
+			case *ast.IfStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+				cs.add(ConstructConditional, line(n.Pos()))
+			case *ast.CallExpr:
+				at := line(n.Pos())
+				switch fun := n.Fun.(type) {
+				case *ast.Ident:
+					cs.add(fun.Name, at)
+					if fn.Recv == nil && fun.Name == fn.Name.Name {
+						cs.add(ConstructRecursion, at)
+					}
+				case *ast.SelectorExpr:
+					cs.add(fun.Sel.Name, at)
+					if pkg, ok := fun.X.(*ast.Ident); ok {
+						cs.add(pkg.Name, at)
+						cs.add(pkg.Name+"."+fun.Sel.Name, at)
+					}
+					if fn.Recv != nil && fun.Sel.Name == fn.Name.Name {
+						cs.add(ConstructRecursion, at)
+					}
+				}
+			}
+			return true
+		})
+	}
+	return cs
+}
+
+// jsConstructs scans JavaScript tokens
+func jsConstructs(code, entry string) constructSet {
+	toks := significant(jsTokens(code))
+	match := matchBrackets(toks)
+	at := func(i int) lexeme { return tokenAt(toks, i) }
+	isArrow := func(i int) bool {
+		return at(i).text == "=" && at(i+1).text == ">" && at(i+1).line == at(i).line && at(i+1).col == at(i).col+1
+	}
+
+	// Function bodies by brace index, for recursion
+	type body struct {
+		name  string
+		close int
+	}
+	var bodies []body
+
+	cs := constructSet{}
+	for i, t := range toks {
+		switch {
+		case t.kind == tokIdent && (t.text == "for" || t.text == "while") && at(i+1).text == "(":
+			cs.add(ConstructLoop, t.line)
+			cs.add(t.text, t.line)
+		case t.kind == tokIdent && t.text == "do" && at(i+1).text == "{":
+			cs.add(ConstructLoop, t.line)
+			cs.add(ConstructWhile, t.line)
+		case t.kind == tokIdent && (t.text == "if" || t.text == "switch") && at(i+1).text == "(":
+			cs.add(ConstructConditional, t.line)
+		case t.kind == tokPunct && t.text == "?" && at(i+1).text != "?" && at(i-1).text != "?":
+			cs.add(ConstructConditional, t.line)
+		case t.kind == tokPunct && t.text == "{":
+			name, ok := jsFunctionName(toks, match, i, isArrow)
+			if !ok || match[i] < 0 {
+				continue
+			}
+			if name == "" && at(i-1).text == ")" {
+				open := match[i-1]
+				switch {
+				case at(open-1).text == "function" && at(open-2).text == "=" && at(open-3).kind == tokIdent:
+					// const name = function (...) {
+					name = at(open - 3).text
+				case at(open-1).kind == tokIdent && at(open-1).text != "function":
+					// method shorthand
+					name = at(open - 1).text
+				}
+			}
+			if name != "" && name != entry {
+				cs.add(ConstructFunction, t.line)
+			}
+			bodies = append(bodies, body{name, match[i]})
+		case t.kind == tokIdent && at(i+1).text == "(" && !jsKeywords[t.text] && at(i-1).text != "function":
+			cs.add(t.text, t.line)
+			member := at(i-1).text == "." || at(i-1).text == "?."
+			if member && at(i-2).kind == tokIdent {
+				cs.add(at(i-2).text+"."+t.text, t.line)
+			}
+			// A call to an enclosing function by its own name
+			for j := len(bodies) - 1; j >= 0; j-- {
+				if bodies[j].close < i {
+					continue
+				}
+				if bodies[j].name == t.text && (!member || at(i-2).text == "this") {
+					cs.add(ConstructRecursion, t.line)
+				}
+				break
+			}
+		}
+	}
+	return cs
+}
+
+// pyConstructs scans Python tokens, reading function bodies from
+// indentation
+func pyConstructs(code, entry string) constructSet {
+	toks := significant(pyTokens(code))
+
+	type def struct {
+		name string
+		col  int
+	}
+	var defs []def
+
+	cs := constructSet{}
+	stmtStart := true
+	brackets := 0
+	for i, t := range toks {
+		at := func(j int) lexeme { return tokenAt(toks, j) }
+
+		// A dedent ends the functions indented deeper
+		if i == 0 || at(i-1).kind == tokNewline {
+			for len(defs) > 0 && defs[len(defs)-1].col >= t.col {
+				defs = defs[:len(defs)-1]
+			}
+		}
+
+		start := stmtStart
+		stmtStart = t.kind == tokNewline || t.text == ":" && brackets == 0 || t.text == ";"
+		switch t.text {
+		case "(", "[", "{":
+			brackets++
+		case ")", "]", "}":
+			brackets--
+		}
+		if t.kind != tokIdent {
+			continue
+		}
+
+		switch {
+		case t.text == "def" && start && at(i+1).kind == tokIdent:
+			name := at(i + 1).text
+			if name != entry {
+				cs.add(ConstructFunction, t.line)
+			}
+			defs = append(defs, def{name, t.col})
+		case t.text == "for":
+			cs.add(ConstructLoop, t.line)
+			if start {
+				cs.add(ConstructFor, t.line)
+			}
+		case t.text == "while" && start:
+			cs.add(ConstructLoop, t.line)
+			cs.add(ConstructWhile, t.line)
+		case t.text == "if" || t.text == "elif" || t.text == "match" && start && at(i+1).text != "=":
+			cs.add(ConstructConditional, t.line)
+		case at(i+1).text == "(" && at(i-1).text != "def" && at(i-1).text != "class":
+			cs.add(t.text, t.line)
+			member := at(i-1).text == "."
+			if member && at(i-2).kind == tokIdent {
+				cs.add(at(i-2).text+"."+t.text, t.line)
+			}
+			if len(defs) > 0 && defs[len(defs)-1].name == t.text && (!member || at(i-2).text == "self" || at(i-2).text == "cls") {
+				cs.add(ConstructRecursion, t.line)
+			}
+		}
+	}
+	return cs
+}
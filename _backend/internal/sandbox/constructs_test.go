@@ -0,0 +1,100 @@
+package sandbox
+
+import "testing"
+
+func TestConstructs(t *testing.T) {
+	tests := []struct {
+		name      string
+		lang      string
+		code      string
+		construct string
+		line      int // line the construct is found on, 0 when absent
+	}{
+		{"go range loop", LangGo, "func total(xs []int) int {\n\ts := 0\n\tfor _, x := range xs {\n\t\ts += x\n\t}\n\treturn s\n}\n", ConstructFor, 3},
+		{"go condition-only for is a while", LangGo, "func halve(n int) int {\n\tfor n > 1 {\n\t\tn /= 2\n\t}\n\treturn n\n}\n", ConstructWhile, 2},
+		{"go three-clause for is not a while", LangGo, "func f(n int) {\n\tfor i := 0; i < n; i++ {\n\t}\n}\n", ConstructWhile, 0},
+		{"go switch", LangGo, "func sign(n int) int {\n\tswitch {\n\tcase n < 0:\n\t\treturn -1\n\t}\n\treturn 1\n}\n", ConstructConditional, 2},
+		{"go recursion", LangGo, "func fact(n int) int {\n\tif n < 2 {\n\t\treturn 1\n\t}\n\treturn n * fact(n-1)\n}\n", ConstructRecursion, 5},
+		{"go helper", LangGo, "func total(n int) int { return double(n) }\n\nfunc double(n int) int { return 2 * n }\n", ConstructFunction, 3},
+		{"go entry is not a helper", LangGo, "func total(n int) int { return n }\n", ConstructFunction, 0},
+		{"go package call", LangGo, "import \"slices\"\n\nfunc f(xs []int) { slices.Sort(xs) }\n", "slices.Sort", 3},
+		{"go formula has no loop", LangGo, "func total(n int) int {\n\treturn n * (n + 1) / 2\n}\n", ConstructLoop, 0},
+
+		{"js for", LangJavaScript, "function total(xs) {\n  let s = 0\n  for (const x of xs) s += x\n  return s\n}\n", ConstructFor, 3},
+		{"js do while", LangJavaScript, "function f(n) {\n  do { n-- } while (n > 0)\n}\n", ConstructWhile, 2},
+		{"js ternary", LangJavaScript, "const sign = (n) => n < 0 ? -1 : 1\n", ConstructConditional, 1},
+		{"js nullish is not a conditional", LangJavaScript, "const pick = (a, b) => a ?? b\n", ConstructConditional, 0},
+		{"js recursion", LangJavaScript, "function fact(n) {\n  return n < 2 ? 1 : n * fact(n - 1)\n}\n", ConstructRecursion, 2},
+		{"js method recursion through this", LangJavaScript, "class T {\n  depth(n) {\n    return n ? 1 + this.depth(n.next) : 0\n  }\n}\n", ConstructRecursion, 3},
+		{"js arrow helper", LangJavaScript, "function total(n) { return double(n) }\nconst double = (n) => { return 2 * n }\n", ConstructFunction, 2},
+		{"js reduce", LangJavaScript, "function total(xs) {\n  return xs.reduce((a, b) => a + b, 0)\n}\n", "reduce", 2},
+		{"js formula has no loop", LangJavaScript, "function total(n) {\n  return n * (n + 1) / 2\n}\n", ConstructLoop, 0},
+
+		{"py comprehension is a loop", LangPython, "def squares(xs):\n    return [x * x for x in xs]\n", ConstructLoop, 2},
+		{"py comprehension is not a for statement", LangPython, "def squares(xs):\n    return [x * x for x in xs]\n", ConstructFor, 0},
+		{"py while", LangPython, "def halve(n):\n    while n > 1:\n        n //= 2\n    return n\n", ConstructWhile, 2},
+		{"py conditional expression", LangPython, "def sign(n):\n    return -1 if n < 0 else 1\n", ConstructConditional, 2},
+		{"py recursion", LangPython, "def fact(n):\n    if n < 2:\n        return 1\n    return n * fact(n - 1)\n", ConstructRecursion, 4},
+		{"py call after a dedent is not recursion", LangPython, "def fact(n):\n    return 1\n\nfact(3)\n", ConstructRecursion, 0},
+		{"py helper", LangPython, "def total(n):\n    return double(n)\n\ndef double(n):\n    return 2 * n\n", ConstructFunction, 4},
+		{"py sum", LangPython, "def total(n):\n    return sum(range(n + 1))\n", "sum", 2},
+		{"py formula has no loop", LangPython, "def total(n):\n    return n * (n + 1) // 2\n", ConstructLoop, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cs constructSet
+			switch tt.lang {
+			case LangGo:
+				cs = goConstructs(tt.code, "total")
+			case LangJavaScript:
+				cs = jsConstructs(tt.code, "total")
+			case LangPython:
+				cs = pyConstructs(tt.code, "total")
+			}
+			if got := cs.find(tt.construct); got != tt.line {
+				t.Errorf("%s found on line %d, want %d (%v)", tt.construct, got, tt.line, cs)
+			}
+		})
+	}
+}
+
+func TestCheckConstructs(t *testing.T) {
+	formula := map[string]string{
+		LangGo:         "func total(n int) int {\n\treturn n * (n + 1) / 2\n}\n",
+		LangJavaScript: "function total(n) {\n  return n * (n + 1) / 2\n}\n",
+		LangPython:     "def total(n):\n    return n * (n + 1) // 2\n",
+	}
+	loop := &exerciseSpec{Required: []string{ConstructLoop}}
+	for lang, code := range formula {
+		results := loop.checkConstructs(lang, code, "total")
+		if len(results) != 1 || results[0].Passed || results[0].ErrorType != ErrorConstruct {
+			t.Errorf("%s: n*(n+1)/2 with a required loop gave %+v, want a construct failure", lang, results)
+		}
+	}
+
+	noSum := &exerciseSpec{Forbidden: []string{"sum"}}
+	results := noSum.checkConstructs(LangPython, "def total(n):\n    return sum(range(n + 1))\n", "total")
+	if len(results) != 1 || results[0].Passed || results[0].Message != "Line 2 uses sum(); solve this exercise without it" {
+		t.Errorf("sum(...) with sum forbidden gave %+v, want a failure on line 2", results)
+	}
+	results = noSum.checkConstructs(LangPython, "def total(n):\n    s = 0\n    for i in range(n + 1):\n        s += i\n    return s\n", "total")
+	if len(results) != 1 || !results[0].Passed {
+		t.Errorf("a loop with sum forbidden gave %+v, want a pass", results)
+	}
+
+	if results := loop.checkConstructs(LangGo, "func total(n int) int {", "total"); results != nil {
+		t.Errorf("unparsable Go gave %+v, want no results", results)
+	}
+}
+
+func TestValidateConstructs(t *testing.T) {
+	if err := ValidateConstructs([]string{ConstructLoop, ConstructRecursion}, []string{"sum", "slices.Sort"}); err != nil {
+		t.Errorf("valid constructs: %v", err)
+	}
+	if err := ValidateConstructs([]string{"sum"}, nil); err == nil {
+		t.Error("a call accepted as a required construct")
+	}
+	if err := ValidateConstructs(nil, []string{"sum()"}); err == nil {
+		t.Error("an invalid forbidden name accepted")
+	}
+}
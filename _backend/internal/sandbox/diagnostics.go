@@ -0,0 +1,279 @@
+package sandbox
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is a compiler or runtime error located in the learner's code.
+// File, Line and Column are empty when the error has no position there.
+type Diagnostic struct {
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Type     string `json:"type"`           // ErrorSyntax or ErrorRuntime
+	Rule     string `json:"rule,omitempty"` // policy rule for security violations
+}
+
+// sourceMap relates the files a program ran as to the learner's sources,
+// keyed by the name the file was written under
+type sourceMap map[string]sourceFile
+
+// sourceFile describes where the learner's code sits inside a run file
+type sourceFile struct {
+	Name   string // file name shown to the learner
+	Offset int    // generated lines above the learner's code
+	Lines  int    // learner lines; anything after is generated
+	Source string // the learner's code
+}
+
+// identityMap maps every file onto itself, for programs run unmodified
+func identityMap(files map[string]string) sourceMap {
+	m := make(sourceMap, len(files))
+	for name, source := range files {
+		m[name] = sourceFile{Name: name, Lines: countLines(source), Source: source}
+	}
+	return m
+}
+
+// locate translates a position reported by a runtime. Paths may be
+// absolute or relative to the work directory. ok is false for positions
+// in generated code or outside the program.
+func (m sourceMap) locate(file string, line int) (sourceFile, int, bool) {
+	file = path.Clean(strings.ReplaceAll(file, "\\", "/"))
+	for name, sf := range m {
+		if file != name && !strings.HasSuffix(file, "/"+name) {
+			continue
+		}
+		line -= sf.Offset
+		if line < 1 || line > sf.Lines {
+			return sourceFile{}, 0, false
+		}
+		return sf, line, true
+	}
+	return sourceFile{}, 0, false
+}
+
+// sourceLine returns a 1-based line of the learner's code
+func (sf sourceFile) sourceLine(line int) string {
+	lines := strings.Split(sf.Source, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return lines[line-1]
+}
+
+func countLines(s string) int {
+	return strings.Count(strings.TrimSuffix(s, "\n"), "\n") + 1
+}
+
+// diagnose parses a runtime's error output. It returns nil when the text
+// holds no recognizable error.
+func diagnose(lang, text string, m sourceMap) []Diagnostic {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	switch dialect(lang) {
+	case LangJavaScript:
+		return diagnoseNode(text, m)
+	case LangPython:
+		return diagnosePython(text, m)
+	case LangGo:
+		return diagnoseGo(text, m)
+	}
+	return nil
+}
+
+var (
+	nodeHeaderPattern = regexp.MustCompile(`^(\S+\.[cm]?js):(\d+)$`)
+	nodeFramePattern  = regexp.MustCompile(`^\s+at (?:.*\()?(\S+?\.[cm]?js):(\d+):(\d+)\)?$`)
+	nodeErrorPattern  = regexp.MustCompile(`^(?:Uncaught )?([A-Z]\w*(?:Error|Exception)|Error)(?: \[\w+\])?: (.*)$`)
+)
+
+// diagnoseNode reads node's uncaught exception report, or an error's
+// stack as captured by the harness
+func diagnoseNode(text string, m sourceMap) []Diagnostic {
+	lines := strings.Split(text, "\n")
+	d := Diagnostic{Severity: SeverityError, Type: ErrorRuntime}
+
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if sm := nodeErrorPattern.FindStringSubmatch(line); sm != nil && d.Message == "" {
+			d.Message = sm[1] + ": " + sm[2]
+			if sm[1] == "SyntaxError" {
+				d.Type = ErrorSyntax
+			}
+			continue
+		}
+		if d.File != "" {
+			continue
+		}
+		if sm := nodeFramePattern.FindStringSubmatch(line); sm != nil {
+			n, _ := strconv.Atoi(sm[2])
+			if sf, at, ok := m.locate(sm[1], n); ok {
+				d.File, d.Line = sf.Name, at
+				d.Column, _ = strconv.Atoi(sm[3])
+			}
+			continue
+		}
+		// The header names the failing line and underlines it with a caret
+		if sm := nodeHeaderPattern.FindStringSubmatch(line); sm != nil && i == firstNonEmpty(lines) {
+			n, _ := strconv.Atoi(sm[2])
+			if sf, at, ok := m.locate(sm[1], n); ok {
+				d.File, d.Line = sf.Name, at
+				if i+2 < len(lines) {
+					if col := strings.IndexByte(lines[i+2], '^'); col >= 0 && strings.Trim(lines[i+2], " ^") == "" {
+						d.Column = col + 1
+					}
+				}
+			}
+		}
+	}
+
+	if d.Message == "" {
+		return nil
+	}
+	return []Diagnostic{d}
+}
+
+var (
+	pythonFramePattern = regexp.MustCompile(`^\s*File "(.+)", line (\d+)`)
+	pythonErrorPattern = regexp.MustCompile(`^([A-Za-z_][\w.]*(?:Error|Exception|Interrupt|Exit|Warning))(?::\s?(.*))?$`)
+	pythonMarkPattern  = regexp.MustCompile(`^\s*[~^]+[~^\s]*$`)
+)
+
+// diagnosePython reads a traceback, locating the innermost frame in the
+// learner's code
+func diagnosePython(text string, m sourceMap) []Diagnostic {
+	lines := strings.Split(text, "\n")
+	d := Diagnostic{Severity: SeverityError, Type: ErrorRuntime}
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r")
+		if sm := pythonFramePattern.FindStringSubmatch(line); sm != nil {
+			n, _ := strconv.Atoi(sm[2])
+			sf, at, ok := m.locate(sm[1], n)
+			if !ok {
+				continue
+			}
+			d.File, d.Line, d.Column = sf.Name, at, 0
+			// The source line follows, optionally underlined
+			if i+2 < len(lines) && pythonMarkPattern.MatchString(lines[i+2]) {
+				d.Column = pythonColumn(lines[i+1], lines[i+2], sf.sourceLine(at))
+			}
+			continue
+		}
+		if sm := pythonErrorPattern.FindStringSubmatch(line); sm != nil {
+			d.Message = strings.TrimSuffix(sm[1]+": "+sm[2], ": ")
+			switch sm[1] {
+			case "SyntaxError", "IndentationError", "TabError":
+				d.Type = ErrorSyntax
+			default:
+				d.Type = ErrorRuntime
+			}
+		}
+	}
+
+	if d.Message == "" {
+		return nil
+	}
+	return []Diagnostic{d}
+}
+
+// pythonColumn converts the position of an underline beneath a printed
+// source line into a column in the original line. Python strips the
+// line's own indentation and indents it by its own amount.
+func pythonColumn(printed, marks, original string) int {
+	at := strings.IndexAny(marks, "~^")
+	printedIndent := len(printed) - len(strings.TrimLeft(printed, " \t"))
+	originalIndent := len(original) - len(strings.TrimLeft(original, " \t"))
+	col := at - printedIndent + originalIndent + 1
+	if at < 0 || col < 1 {
+		return 0
+	}
+	return col
+}
+
+var (
+	goBuildPattern = regexp.MustCompile(`^(\S+\.go):(\d+):(\d+): (.*)$`)
+	goPanicPattern = regexp.MustCompile(`^(panic|fatal error): (.*?)(?: \[recovered\])?$`)
+	goFramePattern = regexp.MustCompile(`^\t(\S+\.go):(\d+)(?: \+0x[0-9a-f]+)?$`)
+)
+
+// diagnoseGo reads `go build` errors or a panic's goroutine trace
+func diagnoseGo(text string, m sourceMap) []Diagnostic {
+	var diags []Diagnostic
+	lines := strings.Split(text, "\n")
+
+	for _, line := range lines {
+		sm := goBuildPattern.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if sm == nil {
+			continue
+		}
+		d := Diagnostic{Severity: SeverityError, Type: ErrorSyntax, Message: sm[4]}
+		n, _ := strconv.Atoi(sm[2])
+		if sf, at, ok := m.locate(sm[1], n); ok {
+			d.File, d.Line = sf.Name, at
+			d.Column, _ = strconv.Atoi(sm[3])
+		}
+		diags = append(diags, d)
+	}
+	if len(diags) > 0 {
+		return diags
+	}
+
+	d := Diagnostic{Severity: SeverityError, Type: ErrorRuntime}
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if sm := goPanicPattern.FindStringSubmatch(line); sm != nil && d.Message == "" {
+			d.Message = sm[1] + ": " + sm[2]
+			continue
+		}
+		if sm := goFramePattern.FindStringSubmatch(line); sm != nil && d.Message != "" && d.File == "" {
+			n, _ := strconv.Atoi(sm[2])
+			if sf, at, ok := m.locate(sm[1], n); ok {
+				d.File, d.Line = sf.Name, at
+			}
+		}
+	}
+	if d.Message == "" {
+		return nil
+	}
+	return []Diagnostic{d}
+}
+
+func firstNonEmpty(lines []string) int {
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// mergeDiagnostics appends diagnostics not already present in dst
+func mergeDiagnostics(dst []Diagnostic, src ...Diagnostic) []Diagnostic {
+	for _, d := range src {
+		seen := false
+		for _, e := range dst {
+			if e == d {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			dst = append(dst, d)
+		}
+	}
+	return dst
+}
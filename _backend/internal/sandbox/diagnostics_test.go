@@ -0,0 +1,137 @@
+package sandbox
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	// Each program has two generated lines above the learner's code and a
+	// generated call below it
+	pyMap := sourceMap{"main.py": {Name: "solution.py", Offset: 2, Lines: 4, Source: "def f(xs):\n    total = 0\n    return total + xs[3]\n\n"}}
+	jsMap := sourceMap{"main.js": {Name: "solution.js", Offset: 2, Lines: 3, Source: "function f(xs) {\n  return xs.foo.bar;\n}\n"}}
+	goMap := sourceMap{"main.go": {Name: "solution.go", Offset: 3, Lines: 3, Source: "func f(xs []int) int {\n\treturn xs[3] + y\n}\n"}}
+
+	tests := []struct {
+		name string
+		lang string
+		text string
+		m    sourceMap
+		want []Diagnostic
+	}{
+		{"empty", LangPython, "  \n", pyMap, nil},
+		{
+			"python traceback", LangPython,
+			"Traceback (most recent call last):\n" +
+				"  File \"/tmp/run/main.py\", line 7, in <module>\n    f([1])\n" +
+				"  File \"/tmp/run/main.py\", line 5, in f\n    return total + xs[3]\n                   ~~^^^\n" +
+				"IndexError: list index out of range\n",
+			pyMap,
+			[]Diagnostic{{File: "solution.py", Line: 3, Column: 20, Severity: SeverityError, Message: "IndexError: list index out of range", Type: ErrorRuntime}},
+		},
+		{
+			"python frames only in generated code", LangPython,
+			"Traceback (most recent call last):\n  File \"/tmp/run/main.py\", line 7, in <module>\n    f()\nTypeError: f() missing 1 required positional argument: 'xs'\n",
+			pyMap,
+			[]Diagnostic{{Severity: SeverityError, Message: "TypeError: f() missing 1 required positional argument: 'xs'", Type: ErrorRuntime}},
+		},
+		{
+			"python syntax error", LangPython,
+			"  File \"/tmp/run/main.py\", line 1\n    def f(:\n          ^\nSyntaxError: invalid syntax\n",
+			identityMap(map[string]string{"main.py": "def f(:\n    pass\n"}),
+			[]Diagnostic{{File: "main.py", Line: 1, Column: 7, Severity: SeverityError, Message: "SyntaxError: invalid syntax", Type: ErrorSyntax}},
+		},
+		{
+			"python bare exception", LangPython,
+			"Traceback (most recent call last):\n  File \"main.py\", line 3, in f\n    return total + xs[3]\nKeyboardInterrupt\n",
+			pyMap,
+			[]Diagnostic{{File: "solution.py", Line: 1, Severity: SeverityError, Message: "KeyboardInterrupt", Type: ErrorRuntime}},
+		},
+		{
+			"node uncaught exception", LangJavaScript,
+			"/tmp/run/main.js:4\n  return xs.foo.bar;\n                ^\n\n" +
+				"TypeError: Cannot read properties of undefined (reading 'bar')\n" +
+				"    at f (/tmp/run/main.js:4:17)\n    at Object.<anonymous> (/tmp/run/main.js:6:1)\n" +
+				"    at Module._compile (node:internal/modules/cjs/loader:1521:14)\n\nNode.js v20.19.5\n",
+			jsMap,
+			[]Diagnostic{{File: "solution.js", Line: 2, Column: 17, Severity: SeverityError, Message: "TypeError: Cannot read properties of undefined (reading 'bar')", Type: ErrorRuntime}},
+		},
+		{
+			"node stack from the harness", LangJavaScript,
+			"RangeError: Maximum call stack size exceeded\n    at f (/tmp/run/main.js:5:3)\n    at f (/tmp/run/main.js:4:10)\n",
+			jsMap,
+			[]Diagnostic{{File: "solution.js", Line: 3, Column: 3, Severity: SeverityError, Message: "RangeError: Maximum call stack size exceeded", Type: ErrorRuntime}},
+		},
+		{
+			"node syntax error past the end", LangJavaScript,
+			"/tmp/run/main.js:6\n\n\n\nSyntaxError: Unexpected end of input\n    at wrapSafe (node:internal/modules/cjs/loader:1464:18)\n",
+			jsMap,
+			[]Diagnostic{{Severity: SeverityError, Message: "SyntaxError: Unexpected end of input", Type: ErrorSyntax}},
+		},
+		{
+			"go build errors", LangGo,
+			"# sandbox\n./main.go:5:17: undefined: y\n./main.go:9:2: declared and not used: z\n",
+			goMap,
+			[]Diagnostic{
+				{File: "solution.go", Line: 2, Column: 17, Severity: SeverityError, Message: "undefined: y", Type: ErrorSyntax},
+				{Severity: SeverityError, Message: "declared and not used: z", Type: ErrorSyntax},
+			},
+		},
+		{
+			"go panic", LangGo,
+			"panic: runtime error: index out of range [3] with length 0\n\ngoroutine 1 [running]:\n" +
+				"main.f(...)\n\t/tmp/run/main.go:5\nmain.main()\n\t/tmp/run/main.go:8 +0xa\n",
+			goMap,
+			[]Diagnostic{{File: "solution.go", Line: 2, Severity: SeverityError, Message: "panic: runtime error: index out of range [3] with length 0", Type: ErrorRuntime}},
+		},
+		{"unrecognized", LangGo, "killed\n", goMap, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diagnose(tt.lang, tt.text, tt.m); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diagnose =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceMapLocate(t *testing.T) {
+	m := sourceMap{"main.py": {Name: "solution.py", Offset: 2, Lines: 4}}
+	tests := []struct {
+		file string
+		line int
+		want int // 0 when the position is not in the learner's code
+	}{
+		{"main.py", 3, 1},
+		{"/tmp/run/main.py", 6, 4},
+		{"C:\\run\\main.py", 4, 2},
+		{"./main.py", 3, 1},
+		{"main.py", 2, 0},
+		{"main.py", 7, 0},
+		{"other_main.py", 3, 0},
+		{"/usr/lib/python3.11/json/__init__.py", 3, 0},
+	}
+	for _, tt := range tests {
+		sf, line, ok := m.locate(tt.file, tt.line)
+		if ok != (tt.want > 0) || line != tt.want || (ok && sf.Name != "solution.py") {
+			t.Errorf("locate(%q, %d) = %q, %d, %v; want line %d", tt.file, tt.line, sf.Name, line, ok, tt.want)
+		}
+	}
+}
+
+func TestPythonColumn(t *testing.T) {
+	tests := []struct {
+		printed, marks, original string
+		want                     int
+	}{
+		{"    return xs[3]", "           ^^^^^", "    return xs[3]", 12},
+		{"    return xs[3]", "           ^^^^^", "\t\treturn xs[3]", 10},
+		{"    x = 1 +", "           ^", "x = 1 +", 8},
+		{"    x", "", "x", 0},
+	}
+	for _, tt := range tests {
+		if got := pythonColumn(tt.printed, tt.marks, tt.original); got != tt.want {
+			t.Errorf("pythonColumn(%q, %q, %q) = %d, want %d", tt.printed, tt.marks, tt.original, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package sandbox
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// NewRunnerFromEnv creates the runners configured by the SANDBOX_*
+// environment variables, the same for the API server and its tools.
+// Programs run as subprocesses, as SANDBOX_UID in their own namespaces;
+// SANDBOX_UNISOLATED=1 runs them as the current user instead, for
+// development only. SANDBOX_READ_PATHS adds colon-separated host paths
+// isolated programs may read; the database's directory stays hidden.
+// Languages run on WebAssembly when SANDBOX_WASM_DIR holds the runtimes
+// and the languages table or SANDBOX_WASM_LANGUAGES assigns them to the
+// wasm backend.
+func NewRunnerFromEnv() (Runner, error) {
+	cfg := DefaultProcessConfig()
+	if dir := os.Getenv("SANDBOX_DIR"); dir != "" {
+		cfg.WorkDir = filepath.Join(dir, "work")
+		cfg.CacheDir = filepath.Join(dir, "cache")
+	}
+	cfg.UID = envInt("SANDBOX_UID", -1)
+	cfg.GID = envInt("SANDBOX_GID", cfg.UID)
+	cfg.Unisolated = os.Getenv("SANDBOX_UNISOLATED") == "1"
+	cfg.BuildCacheMax = int64(envInt("SANDBOX_BUILD_CACHE_MB", int(cfg.BuildCacheMax>>20))) << 20
+	if paths := os.Getenv("SANDBOX_READ_PATHS"); paths != "" {
+		cfg.ReadPaths = append(append([]string{}, cfg.ReadPaths...), filepath.SplitList(paths)...)
+	}
+	dbPath := os.Getenv("DATABASE_PATH")
+	if dbPath == "" {
+		dbPath = "./data/programprimitives.db"
+	}
+	if data, err := filepath.Abs(filepath.Dir(dbPath)); err == nil {
+		cfg.Hide = append(cfg.Hide, data)
+	}
+	process, err := NewProcessRunner(cfg)
+	if err != nil {
+		return nil, err
+	}
+	runners := map[string]Runner{BackendProcess: process}
+
+	if dir := os.Getenv("SANDBOX_WASM_DIR"); dir != "" {
+		wasmConfig := DefaultWasmConfig()
+		wasmConfig.ModuleDir = dir
+		wasmConfig.CacheDir = filepath.Join(cfg.CacheDir, "wasm")
+		wasmConfig.FuelPerSecond = int64(envInt("SANDBOX_WASM_FUEL", int(wasmConfig.FuelPerSecond)))
+		wasm, err := NewWasmRunner(wasmConfig)
+		if err != nil {
+			return nil, err
+		}
+		runners[BackendWasm] = wasm
+		for _, lang := range strings.Split(os.Getenv("SANDBOX_WASM_LANGUAGES"), ",") {
+			if lang = strings.TrimSpace(lang); lang == "" {
+				continue
+			}
+			if err := SetBackend(lang, BackendWasm); err != nil {
+				return nil, err
+			}
+		}
+		log.Printf("🧪 Sandbox: WebAssembly runtimes from %s", dir)
+	}
+	return NewBackendRunner(runners), nil
+}
+
+// envInt gets an integer environment variable with fallback
+func envInt(key string, fallback int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,255 @@
+package sandbox
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ErrExerciseNotFound is returned when an exercise is missing or unpublished
+var ErrExerciseNotFound = errors.New("exercise not found")
+
+// exerciseSpec is everything the grader needs to know about an exercise
+type exerciseSpec struct {
+	ID               string
+	EstimatedMinutes int
+	Entry            string // entry point for the requested language
+	Starter          string // starter code for the requested language
+	Solution         string // reference solution for the requested language
+	Tests            []TestCase
+	Limits           Limits // per-case timeouts are applied on top
+	Policy           Policy
+	BestPractices    []string // from the exercise's primitive
+	Required         []string // constructs the solution must use
+	Forbidden        []string // constructs the solution must not use
+	Generator        *InputGenerator
+	Schema           *InputSchema // random inputs checked against the reference solution
+	Signature        *Signature   // language-neutral entry point, if declared
+	Deterministic    bool         // tests run with seeded randomness and a frozen clock
+}
+
+// loadExercise reads a published exercise's grading data. Hidden cases are
+// only loaded when includeHidden is set; they never leave the server
+// unredacted.
+func (h *Handler) loadExercise(id, lang string, includeHidden bool) (*exerciseSpec, error) {
+	if h.db == nil {
+		return nil, ErrExerciseNotFound
+	}
+	return readExercise(h.db, id, lang, includeHidden, true)
+}
+
+// readExercise reads an exercise's grading data, unpublished ones too
+// unless publishedOnly is set
+func readExercise(db Querier, id, lang string, includeHidden, publishedOnly bool) (*exerciseSpec, error) {
+	if id == "" {
+		return nil, ErrExerciseNotFound
+	}
+
+	spec := &exerciseSpec{ID: id, Limits: languageLimits(lang)}
+	var memoryMB sql.NullInt64
+	var allowedImports, bestPractices, required, forbidden, generator, schema, signature sql.NullString
+	err := db.QueryRow(`
+		SELECT e.estimated_minutes, e.memory_limit_mb, e.allowed_imports,
+		       e.required_constructs, e.forbidden_constructs, e.input_generator, e.input_schema,
+		       e.signature, COALESCE(e.deterministic, 0), p.best_practices
+		FROM exercises e LEFT JOIN primitives p ON p.id = e.primitive_id
+		WHERE e.id = ? AND (e.is_published = 1 OR NOT ?)
+	`, id, publishedOnly).Scan(&spec.EstimatedMinutes, &memoryMB, &allowedImports, &required, &forbidden, &generator, &schema, &signature, &spec.Deterministic, &bestPractices)
+	if err == sql.ErrNoRows {
+		return nil, ErrExerciseNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load exercise: %w", err)
+	}
+	if memoryMB.Valid && memoryMB.Int64 > 0 {
+		spec.Limits.MemoryBytes = memoryMB.Int64 << 20
+	}
+	if allowedImports.Valid && allowedImports.String != "" {
+		if err := json.Unmarshal([]byte(allowedImports.String), &spec.Policy.AllowedImports); err != nil {
+			log.Printf("Exercise %s has invalid allowed_imports: %v", id, err)
+		}
+	}
+	if bestPractices.Valid && bestPractices.String != "" {
+		json.Unmarshal([]byte(bestPractices.String), &spec.BestPractices)
+	}
+	if required.Valid && required.String != "" {
+		json.Unmarshal([]byte(required.String), &spec.Required)
+	}
+	if forbidden.Valid && forbidden.String != "" {
+		json.Unmarshal([]byte(forbidden.String), &spec.Forbidden)
+	}
+	if generator.Valid && generator.String != "" {
+		if spec.Generator, err = ParseInputGenerator([]byte(generator.String)); err != nil {
+			log.Printf("Exercise %s has an invalid input generator: %v", id, err)
+		}
+	}
+	if schema.Valid && schema.String != "" {
+		if spec.Schema, err = ParseInputSchema([]byte(schema.String)); err != nil {
+			log.Printf("Exercise %s has an invalid input schema: %v", id, err)
+		}
+	}
+	if signature.Valid && signature.String != "" {
+		if spec.Signature, err = ParseSignature([]byte(signature.String)); err != nil {
+			log.Printf("Exercise %s has an invalid signature: %v", id, err)
+		}
+	}
+
+	var entry, starter, solution sql.NullString
+	err = db.QueryRow(`
+		SELECT entry_point, starter_code, solution_code FROM exercise_starter_code
+		WHERE exercise_id = ? AND language = ?
+	`, id, lang).Scan(&entry, &starter, &solution)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to load starter code: %w", err)
+	}
+	spec.Entry = entry.String
+	spec.Starter = starter.String
+	spec.Solution = solution.String
+	spec.applySignature(lang)
+	if spec.Entry == "" && starter.Valid {
+		spec.Entry = detectEntryPoint(lang, starter.String)
+	}
+
+	query := `
+		SELECT id, name, input, expected_output, is_hidden, timeout_ms, checker, clock
+		FROM exercise_test_cases WHERE exercise_id = ?
+	`
+	if !includeHidden {
+		query += " AND is_hidden = 0"
+	}
+	query += " ORDER BY sequence_order, created_at"
+
+	rows, err := db.Query(query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load test cases: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tc TestCase
+		var input, expected string
+		var checker, clock sql.NullString
+		if err := rows.Scan(&tc.ID, &tc.Name, &input, &expected, &tc.Hidden, &tc.TimeoutMs, &checker, &clock); err != nil {
+			return nil, fmt.Errorf("failed to read test case: %w", err)
+		}
+		tc.Input = decodeStored(input)
+		tc.Expected = decodeStored(expected)
+		if checker.Valid && checker.String != "" {
+			if tc.Checker, err = ParseChecker([]byte(checker.String)); err != nil {
+				log.Printf("Test case %s has an invalid checker: %v", tc.ID, err)
+			}
+		}
+		tc.Deterministic = spec.Deterministic
+		if clock.Valid && clock.String != "" {
+			if t, err := ParseClock(clock.String); err != nil {
+				log.Printf("Test case %s has an invalid clock: %v", tc.ID, err)
+			} else {
+				tc.Clock = &t
+			}
+		}
+		spec.Tests = append(spec.Tests, tc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read test cases: %w", err)
+	}
+
+	return spec, nil
+}
+
+// exerciseFor resolves the exercise a request is graded against, preferring
+// the {id} path value over the body. On failure it returns nil and the HTTP
+// status to respond with.
+func (h *Handler) exerciseFor(r *http.Request, bodyID, lang string, includeHidden bool) (*exerciseSpec, int) {
+	id := r.PathValue("id")
+	if id == "" {
+		id = bodyID
+	}
+
+	spec, err := h.loadExercise(id, lang, includeHidden)
+	if err == ErrExerciseNotFound {
+		return nil, http.StatusNotFound
+	}
+	if err != nil {
+		log.Printf("Failed to load exercise %s: %v", id, err)
+		return nil, http.StatusInternalServerError
+	}
+	// An exercise without tests would pass any code
+	if len(spec.Tests) == 0 {
+		return nil, http.StatusUnprocessableEntity
+	}
+	if spec.Deterministic && !DeterministicLanguage(lang) {
+		return nil, http.StatusBadRequest
+	}
+	return spec, http.StatusOK
+}
+
+// applySignature names the entry point after the exercise's signature and
+// generates starter code from it, unless the author gave their own
+func (spec *exerciseSpec) applySignature(lang string) {
+	if spec.Signature == nil {
+		return
+	}
+	if spec.Entry == "" {
+		spec.Entry = spec.Signature.EntryName(lang)
+	}
+	if strings.TrimSpace(spec.Starter) == "" {
+		spec.Starter = spec.Signature.Starter(lang)
+	}
+}
+
+// entryFor returns the exercise's entry point for a solution, detecting it
+// from the code when the exercise does not name one. Programs graded only
+// on what they print have none unless named: they run as scripts.
+func (spec *exerciseSpec) entryFor(lang, code string) string {
+	if spec.Entry != "" {
+		return spec.Entry
+	}
+	if printsOnly(spec.Tests) {
+		return ""
+	}
+	return detectEntryPoint(lang, code)
+}
+
+// checkPolicy checks a learner's single-file solution against the
+// exercise's policy
+func (spec *exerciseSpec) checkPolicy(lang, code string) []Diagnostic {
+	tc, _ := lookupToolchain(lang)
+	return checkPolicy(lang, map[string]string{tc.MainFile: code}, spec.Policy)
+}
+
+// decodeStored parses a JSON column, treating non-JSON text as a string
+func decodeStored(s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s
+	}
+	return v
+}
+
+// redactHidden strips anything that would reveal a hidden case's data
+func redactHidden(results []TestResult) {
+	for i := range results {
+		redactResult(&results[i])
+	}
+}
+
+// redactResult redacts a single result if its case is hidden
+func redactResult(result *TestResult) {
+	if !result.Hidden {
+		return
+	}
+	result.Expected = ""
+	result.Actual = ""
+	switch {
+	case result.Passed:
+		result.Message = "Hidden test passed"
+	case result.ErrorType == ErrorTimeout:
+		result.Message = "Hidden test exceeded the time limit"
+	default:
+		result.Message = "Hidden test failed"
+	}
+}
@@ -0,0 +1,193 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// Bounds on what a generator may produce
+const (
+	maxGeneratorSizes = 8
+	maxGeneratorSize  = 1_000_000
+	maxGeneratedBytes = 512 << 10 // encoded input for all sizes together
+)
+
+// InputGenerator describes how to build an exercise's input at a given
+// size n. Input is a JSON template; besides plain JSON values it may use:
+//
+//	"$n"                                  the size itself
+//	{"$range": N}                         [0, 1, ..., N-1]
+//	{"$ints": N, "min": a, "max": b}      N random integers in [a, b]
+//	{"$string": N, "alphabet": "abc"}     a random string of length N
+//	{"$repeat": N, "value": template}     N instances of template
+//
+// where N is "$n" or a number. The input is passed to the entry point the
+// same way a test case's input is.
+type InputGenerator struct {
+	Sizes []int           `json:"sizes"`
+	Input json.RawMessage `json:"input"`
+	Seed  int64           `json:"seed,omitempty"`
+}
+
+// ParseInputGenerator decodes and validates a generator
+func ParseInputGenerator(raw []byte) (*InputGenerator, error) {
+	var g InputGenerator
+	if err := json.Unmarshal(raw, &g); err != nil {
+		return nil, fmt.Errorf("invalid input generator: %w", err)
+	}
+	if len(g.Sizes) < 3 || len(g.Sizes) > maxGeneratorSizes {
+		return nil, fmt.Errorf("input generator needs between 3 and %d sizes", maxGeneratorSizes)
+	}
+	for i, n := range g.Sizes {
+		if n < 1 || n > maxGeneratorSize {
+			return nil, fmt.Errorf("input generator sizes must be between 1 and %d", maxGeneratorSize)
+		}
+		if i > 0 && n <= g.Sizes[i-1] {
+			return nil, errors.New("input generator sizes must increase")
+		}
+	}
+	if len(g.Input) == 0 {
+		return nil, errors.New("input generator has no input template")
+	}
+	if _, err := g.Generate(); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// Generate builds the argument lists for every size. The same generator
+// always produces the same inputs.
+func (g *InputGenerator) Generate() ([][]interface{}, error) {
+	var template interface{}
+	if err := json.Unmarshal(g.Input, &template); err != nil {
+		return nil, fmt.Errorf("invalid input template: %w", err)
+	}
+
+	rng := rand.New(rand.NewSource(g.Seed))
+	inputs := make([][]interface{}, len(g.Sizes))
+	total := 0
+	for i, n := range g.Sizes {
+		value, err := expandTemplate(template, n, rng)
+		if err != nil {
+			return nil, err
+		}
+		inputs[i] = testArgs(value)
+
+		encoded, _ := json.Marshal(inputs[i])
+		if total += len(encoded); total > maxGeneratedBytes {
+			return nil, fmt.Errorf("generated input exceeds %d KB", maxGeneratedBytes>>10)
+		}
+	}
+	return inputs, nil
+}
+
+func expandTemplate(t interface{}, n int, rng *rand.Rand) (interface{}, error) {
+	switch t := t.(type) {
+	case string:
+		if t == "$n" {
+			return n, nil
+		}
+		return t, nil
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, v := range t {
+			var err error
+			if out[i], err = expandTemplate(v, n, rng); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case map[string]interface{}:
+		return expandDirective(t, n, rng)
+	}
+	return t, nil
+}
+
+func expandDirective(t map[string]interface{}, n int, rng *rand.Rand) (interface{}, error) {
+	count := func(key string) (int, error) {
+		switch v := t[key].(type) {
+		case string:
+			if v == "$n" {
+				return n, nil
+			}
+		case float64:
+			if v >= 0 && v <= maxGeneratorSize && v == float64(int(v)) {
+				return int(v), nil
+			}
+		}
+		return 0, fmt.Errorf("%s must be \"$n\" or a count", key)
+	}
+	number := func(key string, def int) int {
+		if v, ok := t[key].(float64); ok {
+			return int(v)
+		}
+		return def
+	}
+
+	switch {
+	case t["$range"] != nil:
+		k, err := count("$range")
+		if err != nil {
+			return nil, err
+		}
+		out := make([]interface{}, k)
+		for i := range out {
+			out[i] = i
+		}
+		return out, nil
+	case t["$ints"] != nil:
+		k, err := count("$ints")
+		if err != nil {
+			return nil, err
+		}
+		lo, hi := number("min", 0), number("max", 1000)
+		if hi < lo {
+			return nil, errors.New("$ints max is below min")
+		}
+		out := make([]interface{}, k)
+		for i := range out {
+			out[i] = lo + rng.Intn(hi-lo+1)
+		}
+		return out, nil
+	case t["$string"] != nil:
+		k, err := count("$string")
+		if err != nil {
+			return nil, err
+		}
+		alphabet, _ := t["alphabet"].(string)
+		if alphabet == "" {
+			alphabet = "abcdefghijklmnopqrstuvwxyz"
+		}
+		runes := []rune(alphabet)
+		var b strings.Builder
+		for i := 0; i < k; i++ {
+			b.WriteRune(runes[rng.Intn(len(runes))])
+		}
+		return b.String(), nil
+	case t["$repeat"] != nil:
+		k, err := count("$repeat")
+		if err != nil {
+			return nil, err
+		}
+		out := make([]interface{}, k)
+		for i := range out {
+			if out[i], err = expandTemplate(t["value"], n, rng); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+
+	// A plain object
+	out := make(map[string]interface{}, len(t))
+	for key, v := range t {
+		var err error
+		if out[key], err = expandTemplate(v, n, rng); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
@@ -2,11 +2,19 @@
 package sandbox
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/programprimitives/api/internal/auth"
 )
 
 // Supported languages
@@ -18,54 +26,87 @@ const (
 
 // Error types
 const (
-	ErrorSyntax   = "syntax"
-	ErrorRuntime  = "runtime"
-	ErrorLogic    = "logic"
-	ErrorTimeout  = "timeout"
-	ErrorEdgeCase = "edge-case"
+	ErrorSyntax    = "syntax"
+	ErrorRuntime   = "runtime"
+	ErrorLogic     = "logic"
+	ErrorTimeout   = "timeout"
+	ErrorEdgeCase  = "edge-case"
+	ErrorConstruct = "construct" // a required construct is missing or a forbidden one is used
 )
 
-// RunRequest represents a code execution request
+// RunRequest represents a code execution request. Code is shorthand for a
+// single-file program; Files holds a multi-file one started from Entry.
 type RunRequest struct {
-	Code     string `json:"code"`
-	Language string `json:"language"`
-	Input    string `json:"input,omitempty"`
+	Code     string            `json:"code"`
+	Language string            `json:"language"`
+	Input    string            `json:"input,omitempty"` // fed to the program's stdin
+	Files    map[string]string `json:"files,omitempty"`
+	Entry    string            `json:"entry,omitempty"`
+	Trace    bool              `json:"trace,omitempty"`    // record a step-by-step timeline
+	MaxSteps int               `json:"maxSteps,omitempty"` // trace: steps to record, capped at maxTraceSteps
+	Version  string            `json:"version,omitempty"`  // runtime version to run on, such as 3.12; any when empty
 }
 
+// Request size limits for programs and their input
+const (
+	maxProgramFiles = 20
+	maxSourceBytes  = 256 << 10
+	maxStdinBytes   = 64 << 10
+	maxRequestBytes = 1 << 20 // a whole request body, with room for JSON escaping
+)
+
 // RunResponse represents code execution result
 type RunResponse struct {
-	Success     bool   `json:"success"`
-	Output      string `json:"output"`
-	Error       string `json:"error,omitempty"`
-	ErrorType   string `json:"errorType,omitempty"`
-	ExecutionMs int64  `json:"executionMs"`
+	Success     bool            `json:"success"`
+	Output      string          `json:"output"`
+	Stderr      string          `json:"stderr,omitempty"`
+	ExitCode    int             `json:"exitCode"`
+	TimedOut    bool            `json:"timedOut,omitempty"`
+	Truncated   bool            `json:"truncated,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	ErrorType   string          `json:"errorType,omitempty"`
+	Diagnostics []Diagnostic    `json:"diagnostics,omitempty"`
+	ExecutionMs int64           `json:"executionMs"`
+	Trace       *ExecutionTrace `json:"trace,omitempty"`
+	Runtime     string          `json:"runtime,omitempty"` // the runtime that ran the program, such as "cpython 3.12.1"
 }
 
 // TestCase for validation
 type TestCase struct {
-	ID       string      `json:"id"`
-	Name     string      `json:"name"`
-	Input    interface{} `json:"input"`
-	Expected interface{} `json:"expected"`
-	Hidden   bool        `json:"hidden"`
+	ID        string      `json:"id"`
+	Name      string      `json:"name"`
+	Input     interface{} `json:"input"`
+	Expected  interface{} `json:"expected"`
+	Hidden    bool        `json:"hidden"`
+	TimeoutMs int         `json:"timeoutMs,omitempty"`
+	Checker   *Checker    `json:"checker,omitempty"` // exact comparison when nil
+
+	// Deterministic runs get a seeded random number generator and a frozen
+	// clock, at Clock or defaultClock
+	Deterministic bool       `json:"deterministic,omitempty"`
+	Clock         *time.Time `json:"clock,omitempty"`
 }
 
-// TestRequest for running tests
+// TestRequest for running tests. Test cases are loaded from the exercise;
+// the exercise ID comes from the URL when routed under /api/exercises/{id}.
 type TestRequest struct {
-	Code      string     `json:"code"`
-	Language  string     `json:"language"`
-	TestCases []TestCase `json:"testCases"`
+	Code       string `json:"code"`
+	Language   string `json:"language"`
+	ExerciseID string `json:"exerciseId"`
 }
 
 // TestResult from running a test
 type TestResult struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Passed   bool   `json:"passed"`
-	Expected string `json:"expected,omitempty"`
-	Actual   string `json:"actual,omitempty"`
-	Message  string `json:"message,omitempty"`
-	Hidden   bool   `json:"hidden"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Passed    bool   `json:"passed"`
+	Expected  string `json:"expected,omitempty"`
+	Actual    string `json:"actual,omitempty"`
+	Message   string `json:"message,omitempty"`
+	ErrorType string `json:"errorType,omitempty"`
+	Hidden    bool   `json:"hidden"`
+
+	diagnostics []Diagnostic // reported on the response, never for hidden cases
 }
 
 // TestResponse with all results
@@ -76,58 +117,80 @@ type TestResponse struct {
 	Results     []TestResult `json:"results"`
 	ExecutionMs int64        `json:"executionMs"`
 	ErrorType   string       `json:"errorType,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
 }
 
 // SubmitRequest for scoring
 type SubmitRequest struct {
-	Code             string     `json:"code"`
-	Language         string     `json:"language"`
-	TestCases        []TestCase `json:"testCases"`
-	HintsUsed        int        `json:"hintsUsed"`
-	TimeSpentSeconds int        `json:"timeSpentSeconds"`
-	ExpectedMinutes  int        `json:"expectedMinutes"`
+	Code             string `json:"code"`
+	Language         string `json:"language"`
+	ExerciseID       string `json:"exerciseId"`
+	HintsUsed        int    `json:"hintsUsed"`
+	TimeSpentSeconds int    `json:"timeSpentSeconds"`
 }
 
 // SubmitResponse with score
 type SubmitResponse struct {
-	Success     bool         `json:"success"`
-	Score       int          `json:"score"`
-	Passed      bool         `json:"passed"`
-	TestResults []TestResult `json:"testResults"`
-	XPEarned    int          `json:"xpEarned"`
-	Feedback    string       `json:"feedback,omitempty"`
-	ErrorType   string       `json:"errorType,omitempty"`
+	Success     bool              `json:"success"`
+	Score       int               `json:"score"`
+	Passed      bool              `json:"passed"`
+	TestResults []TestResult      `json:"testResults"`
+	XPEarned    int               `json:"xpEarned"`
+	Feedback    string            `json:"feedback,omitempty"`
+	ErrorType   string            `json:"errorType,omitempty"`
+	Diagnostics []Diagnostic      `json:"diagnostics,omitempty"`
+	Strength    *StrengthReport   `json:"strength,omitempty"`   // code quality breakdown
+	Complexity  *ComplexityReport `json:"complexity,omitempty"` // growth compared with the reference solution
 }
 
-// Blocked patterns for security
-var blocked = map[string][]*regexp.Regexp{
-	LangJavaScript: {
-		regexp.MustCompile(`(?i)\beval\s*\(`),
-		regexp.MustCompile(`(?i)\bFunction\s*\(`),
-		regexp.MustCompile(`(?i)\brequire\s*\(`),
-		regexp.MustCompile(`(?i)\bimport\s+`),
-		regexp.MustCompile(`(?i)\bfetch\s*\(`),
-		regexp.MustCompile(`(?i)\bprocess\.`),
-	},
-	LangPython: {
-		regexp.MustCompile(`(?i)\bimport\s+os\b`),
-		regexp.MustCompile(`(?i)\bimport\s+subprocess\b`),
-		regexp.MustCompile(`(?i)\bexec\s*\(`),
-		regexp.MustCompile(`(?i)\b__import__`),
-	},
-	LangGo: {
-		regexp.MustCompile(`(?i)"os"`),
-		regexp.MustCompile(`(?i)"os/exec"`),
-		regexp.MustCompile(`(?i)"net`),
-	},
+// Handler for sandbox operations
+type Handler struct {
+	db          *sql.DB
+	runner      Runner
+	scheduler   *Scheduler
+	authHandler *auth.Handler
 }
 
-// Handler for sandbox operations
-type Handler struct{}
+// NewHandler creates a new sandbox handler that grades against exercises
+// in db and executes code with runner, admitted through scheduler
+func NewHandler(db *sql.DB, runner Runner, scheduler *Scheduler, authHandler *auth.Handler) *Handler {
+	return &Handler{
+		db:          db,
+		runner:      runner,
+		scheduler:   scheduler,
+		authHandler: authHandler,
+	}
+}
 
-// NewHandler creates a new sandbox handler
-func NewHandler() *Handler {
-	return &Handler{}
+// sandboxStats is the HandleStats response
+type sandboxStats struct {
+	SchedulerStats
+	BuildCache *BuildCacheStats `json:"buildCache,omitempty"`
+}
+
+// HandleStats reports worker pool utilization and, for runners that
+// cache builds, the build cache's hit ratio
+func (h *Handler) HandleStats(w http.ResponseWriter, r *http.Request) {
+	stats := sandboxStats{SchedulerStats: h.scheduler.Stats()}
+	if c, ok := h.runner.(interface {
+		BuildCacheStats() (BuildCacheStats, bool)
+	}); ok {
+		if bc, enabled := c.BuildCacheStats(); enabled {
+			stats.BuildCache = &bc
+		}
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// HandleLanguages lists the languages the sandbox can run
+func (h *Handler) HandleLanguages(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Languages())
+}
+
+// HandleRuntimes lists what the runtime inventory found for each language,
+// including the runtimes that are missing
+func (h *Handler) HandleRuntimes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Runtimes())
 }
 
 // HandleRun executes code and returns output
@@ -138,10 +201,14 @@ func (h *Handler) HandleRun(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req RunRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, RunResponse{
+	if status := decodeRequest(w, r, &req); status != 0 {
+		msg := "Invalid request"
+		if status == http.StatusRequestEntityTooLarge {
+			msg = "Request is too large"
+		}
+		writeJSON(w, status, RunResponse{
 			Success:   false,
-			Error:     "Invalid request",
+			Error:     msg,
 			ErrorType: ErrorSyntax,
 		})
 		return
@@ -156,20 +223,110 @@ func (h *Handler) HandleRun(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := checkSecurity(req.Code, req.Language); err != "" {
+	lang, problem := pinnedLanguage(req.Language, req.Version)
+	if problem != "" {
+		writeJSON(w, http.StatusBadRequest, RunResponse{
+			Success: false,
+			Error:   problem,
+		})
+		return
+	}
+	req.Language = lang
+
+	tc, _ := lookupToolchain(req.Language)
+	files, entry, problem := programFiles(req, tc)
+	if problem != "" {
+		writeJSON(w, http.StatusBadRequest, RunResponse{
+			Success: false,
+			Error:   problem,
+		})
+		return
+	}
+
+	if req.Trace && !canTrace(req.Language) {
+		writeJSON(w, http.StatusBadRequest, RunResponse{
+			Success: false,
+			Error:   "Tracing is only available for Python and JavaScript",
+		})
+		return
+	}
+
+	if violations := checkPolicy(req.Language, files, Policy{}); len(violations) > 0 {
 		writeJSON(w, http.StatusOK, RunResponse{
-			Success:   false,
-			Error:     err,
-			ErrorType: ErrorSyntax,
+			Success:     false,
+			Error:       policyError(violations),
+			ErrorType:   ErrorSyntax,
+			Diagnostics: violations,
 		})
 		return
 	}
 
+	release, ok := h.admit(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+
+	prog := Program{
+		Language: req.Language,
+		Files:    files,
+		Entry:    entry,
+		Stdin:    req.Input,
+		Limits:   languageLimits(req.Language),
+	}
+
+	marker := ""
+	if req.Trace {
+		var err error
+		if prog, marker, err = traceProgram(prog, tc, req.MaxSteps); err != nil {
+			log.Printf("Sandbox trace failed: %v", err)
+			writeJSON(w, http.StatusInternalServerError, RunResponse{
+				Success: false,
+				Error:   "Code execution is unavailable",
+			})
+			return
+		}
+	}
+
+	var stream *eventStream
+	if wantsStream(r) {
+		stream = newEventStream(w)
+		// Traced output carries step records; it is only sent once parsed
+		if !req.Trace {
+			prog.OnOutput = stream.output
+		}
+	}
+
 	start := time.Now()
-	result := execute(req.Code, req.Language)
+	res, err := h.runner.Run(r.Context(), prog)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		log.Printf("Sandbox run failed: %v", err)
+		reply(w, stream, http.StatusInternalServerError, RunResponse{
+			Success: false,
+			Error:   "Code execution is unavailable",
+		})
+		return
+	}
+
+	var trace *ExecutionTrace
+	if req.Trace {
+		trace = parseTrace(res, marker, languageLimits(req.Language).OutputBytes)
+	}
+
+	result := runResponse(res)
 	result.ExecutionMs = time.Since(start).Milliseconds()
+	result.Trace = trace
+	if rt, ok := runtimeFor(req.Language); ok {
+		result.Runtime = rt.Detail
+	}
+	if res.Failed() {
+		result.Diagnostics = diagnose(req.Language, res.Stderr, identityMap(files))
+	}
 
-	writeJSON(w, http.StatusOK, result)
+	reply(w, stream, http.StatusOK, result)
 }
 
 // HandleTest runs code against test cases
@@ -180,8 +337,12 @@ func (h *Handler) HandleTest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req TestRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, TestResponse{Success: false})
+	if status := decodeRequest(w, r, &req); status != 0 {
+		writeJSON(w, status, TestResponse{Success: false})
+		return
+	}
+	if len(req.Code) > maxSourceBytes {
+		writeJSON(w, http.StatusRequestEntityTooLarge, TestResponse{Success: false})
 		return
 	}
 
@@ -190,41 +351,74 @@ func (h *Handler) HandleTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := checkSecurity(req.Code, req.Language); err != "" {
+	spec, status := h.exerciseFor(r, req.ExerciseID, req.Language, false)
+	if spec == nil {
+		writeJSON(w, status, TestResponse{Success: false})
+		return
+	}
+
+	if violations := spec.checkPolicy(req.Language, req.Code); len(violations) > 0 {
+		h.recordAttempt(r, Attempt{ExerciseID: spec.ID, Language: req.Language, Kind: AttemptRun, Code: req.Code, ErrorType: ErrorSyntax})
 		writeJSON(w, http.StatusOK, TestResponse{
-			Success:   false,
-			ErrorType: ErrorSyntax,
+			Success:     false,
+			ErrorType:   ErrorSyntax,
+			Diagnostics: violations,
 		})
 		return
 	}
 
-	start := time.Now()
-	results := runTests(req.Code, req.Language, req.TestCases)
+	release, ok := h.admit(w, r)
+	if !ok {
+		return
+	}
+	defer release()
 
-	passed, failed := 0, 0
-	var errType string
-	for _, r := range results {
-		if r.Passed {
-			passed++
-		} else {
-			failed++
-			if errType == "" {
-				if r.Hidden {
-					errType = ErrorEdgeCase
-				} else {
-					errType = ErrorLogic
-				}
-			}
+	var stream *eventStream
+	if wantsStream(r) {
+		stream = newEventStream(w)
+	}
+
+	start := time.Now()
+	entry := spec.entryFor(req.Language, req.Code)
+	checks := spec.checkConstructs(req.Language, req.Code, entry)
+	hooks := stream.hooks(len(spec.Tests) + len(checks))
+
+	results, err := runTests(r.Context(), h.runner, req.Language, req.Code, entry, spec.Signature, spec.Tests, spec.Limits, hooks)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
 		}
+		log.Printf("Sandbox test run failed: %v", err)
+		reply(w, stream, http.StatusInternalServerError, TestResponse{Success: false})
+		return
 	}
+	redactHidden(results)
+	results = append(results, checks...)
+	hooks.report(len(spec.Tests), checks)
+
+	passed, failed, errType := summarize(results)
+	elapsed := time.Since(start).Milliseconds()
+	h.recordAttempt(r, Attempt{
+		ExerciseID:  spec.ID,
+		Language:    req.Language,
+		Kind:        AttemptRun,
+		Code:        req.Code,
+		Passed:      failed == 0,
+		TestsPassed: passed,
+		TestsFailed: failed,
+		ErrorType:   errType,
+		ExecutionMs: elapsed,
+		Results:     results,
+	})
 
-	writeJSON(w, http.StatusOK, TestResponse{
+	reply(w, stream, http.StatusOK, TestResponse{
 		Success:     failed == 0,
 		Passed:      passed,
 		Failed:      failed,
 		Results:     results,
-		ExecutionMs: time.Since(start).Milliseconds(),
+		ExecutionMs: elapsed,
 		ErrorType:   errType,
+		Diagnostics: visibleDiagnostics(results),
 	})
 }
 
@@ -236,8 +430,12 @@ func (h *Handler) HandleSubmit(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req SubmitRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, SubmitResponse{Success: false})
+	if status := decodeRequest(w, r, &req); status != 0 {
+		writeJSON(w, status, SubmitResponse{Success: false})
+		return
+	}
+	if len(req.Code) > maxSourceBytes {
+		writeJSON(w, http.StatusRequestEntityTooLarge, SubmitResponse{Success: false, Feedback: "Program is too large"})
 		return
 	}
 
@@ -246,41 +444,102 @@ func (h *Handler) HandleSubmit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := checkSecurity(req.Code, req.Language); err != "" {
+	spec, status := h.exerciseFor(r, req.ExerciseID, req.Language, true)
+	if spec == nil {
+		writeJSON(w, status, SubmitResponse{Success: false})
+		return
+	}
+
+	if violations := spec.checkPolicy(req.Language, req.Code); len(violations) > 0 {
+		h.recordAttempt(r, Attempt{ExerciseID: spec.ID, Language: req.Language, Kind: AttemptSubmit, Code: req.Code, ErrorType: ErrorSyntax})
 		writeJSON(w, http.StatusOK, SubmitResponse{
-			Success:   false,
-			Passed:    false,
-			ErrorType: ErrorSyntax,
-			Feedback:  "Security check failed",
+			Success:     false,
+			Passed:      false,
+			ErrorType:   ErrorSyntax,
+			Feedback:    policyError(violations),
+			Diagnostics: violations,
 		})
 		return
 	}
 
-	results := runTests(req.Code, req.Language, req.TestCases)
+	release, ok := h.admit(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+
+	var stream *eventStream
+	if wantsStream(r) {
+		stream = newEventStream(w)
+	}
 
-	passed, failed := 0, 0
-	var errType string
-	for _, r := range results {
-		if r.Passed {
-			passed++
-		} else {
-			failed++
-			if errType == "" {
-				if r.Hidden {
-					errType = ErrorEdgeCase
-				} else {
-					errType = ErrorLogic
-				}
+	start := time.Now()
+	entry := spec.entryFor(req.Language, req.Code)
+	checks := spec.checkConstructs(req.Language, req.Code, entry)
+	total := len(spec.Tests) + len(checks)
+	if spec.hasProperties() {
+		total++
+	}
+	hooks := stream.hooks(total)
+
+	results, err := runTests(r.Context(), h.runner, req.Language, req.Code, entry, spec.Signature, spec.Tests, spec.Limits, hooks)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		log.Printf("Sandbox submission failed: %v", err)
+		reply(w, stream, http.StatusInternalServerError, SubmitResponse{Success: false})
+		return
+	}
+	redactHidden(results)
+	results = append(results, checks...)
+	hooks.report(len(spec.Tests), checks)
+
+	random, err := checkProperties(r.Context(), h.runner, req.Language, req.Code, entry, spec)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		log.Printf("Random input check failed: %v", err)
+	}
+	if random != nil {
+		hooks.report(len(results), []TestResult{*random})
+		results = append(results, *random)
+	}
+
+	passed, failed, errType := summarize(results)
+
+	// Only a correct solution is worth timing
+	var complexity *ComplexityReport
+	if failed == 0 {
+		complexity, err = estimateComplexity(r.Context(), h.runner, req.Language, req.Code, entry, spec)
+		if err != nil {
+			if r.Context().Err() != nil {
+				return
 			}
+			log.Printf("Complexity estimation failed: %v", err)
 		}
 	}
 
-	total := len(req.TestCases)
-	score := calcScore(passed, total, req.HintsUsed, req.TimeSpentSeconds, req.ExpectedMinutes)
+	total = len(results)
+	score := calcScore(passed, total, req.HintsUsed, req.TimeSpentSeconds, spec.EstimatedMinutes)
 	xp := calcXP(score, failed == 0)
 	feedback := genFeedback(passed, failed, score)
+	h.recordAttempt(r, Attempt{
+		ExerciseID:  spec.ID,
+		Language:    req.Language,
+		Kind:        AttemptSubmit,
+		Code:        req.Code,
+		Passed:      failed == 0,
+		TestsPassed: passed,
+		TestsFailed: failed,
+		Score:       &score,
+		ErrorType:   errType,
+		ExecutionMs: time.Since(start).Milliseconds(),
+		Results:     results,
+	})
 
-	writeJSON(w, http.StatusOK, SubmitResponse{
+	reply(w, stream, http.StatusOK, SubmitResponse{
 		Success:     true,
 		Score:       score,
 		Passed:      failed == 0,
@@ -288,92 +547,209 @@ func (h *Handler) HandleSubmit(w http.ResponseWriter, r *http.Request) {
 		XPEarned:    xp,
 		Feedback:    feedback,
 		ErrorType:   errType,
+		Strength:    analyzeStrength(req.Language, req.Code, spec.Starter, entry, spec.BestPractices),
+		Complexity:  complexity,
 	})
 }
 
 // Helpers
 
-func validLang(lang string) bool {
-	return lang == LangJavaScript || lang == LangPython || lang == LangGo
+// visibleDiagnostics collects the diagnostics of non-hidden test cases
+func visibleDiagnostics(results []TestResult) []Diagnostic {
+	var diags []Diagnostic
+	for _, r := range results {
+		if !r.Hidden {
+			diags = mergeDiagnostics(diags, r.diagnostics...)
+		}
+	}
+	return diags
 }
 
-func checkSecurity(code, lang string) string {
-	patterns := blocked[lang]
-	for _, p := range patterns {
-		if p.MatchString(code) {
-			return "Security violation: Blocked pattern detected"
+// admit waits for a sandbox worker. When it cannot get one it writes the
+// response itself and returns ok=false.
+func (h *Handler) admit(w http.ResponseWriter, r *http.Request) (func(), bool) {
+	ticket := Ticket{IP: h.scheduler.clientIP(r)}
+	if h.authHandler != nil {
+		if user := h.authHandler.GetUserFromSession(r); user != nil {
+			ticket.UserID = user.ID
 		}
 	}
-	return ""
+
+	release, err := h.scheduler.Acquire(r.Context(), ticket)
+	if err == nil {
+		return release, true
+	}
+	if r.Context().Err() != nil {
+		// The client went away while queued; nobody is listening
+		return nil, false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(h.scheduler.RetryAfter())))
+	msg := "The sandbox is busy, please try again shortly"
+	if err == ErrTooManyInFlight {
+		msg = "Too many runs in progress, wait for one to finish"
+	}
+	writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+		"success": false,
+		"error":   msg,
+	})
+	return nil, false
+}
+
+// validLang accepts registered languages whose runtime has not failed its
+// check
+func validLang(lang string) bool {
+	if _, ok := lookupToolchain(lang); !ok {
+		return false
+	}
+	rt, checked := runtimeFor(lang)
+	return !checked || rt.Available
 }
 
-func execute(code, lang string) RunResponse {
-	var output strings.Builder
+// decodeRequest reads a JSON request body into v, refusing bodies over
+// maxRequestBytes before reading them whole. It returns 0 on success or
+// the status to reply with.
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) int {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	err := json.NewDecoder(r.Body).Decode(v)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge
+	case err != nil:
+		return http.StatusBadRequest
+	}
+	return 0
+}
 
-	switch lang {
-	case LangJavaScript:
-		re := regexp.MustCompile(`console\.log\s*\(\s*["']([^"']+)["']\s*\)`)
-		for _, m := range re.FindAllStringSubmatch(code, -1) {
-			if len(m) > 1 {
-				output.WriteString(m[1] + "\n")
-			}
+// programFiles validates a run request's sources and picks the entry file
+func programFiles(req RunRequest, tc Toolchain) (map[string]string, string, string) {
+	if len(req.Input) > maxStdinBytes {
+		return nil, "", "Input is too large"
+	}
+
+	if len(req.Files) == 0 {
+		if len(req.Code) > maxSourceBytes {
+			return nil, "", "Program is too large"
 		}
-	case LangPython:
-		re := regexp.MustCompile(`print\s*\(\s*["']([^"']+)["']\s*\)`)
-		for _, m := range re.FindAllStringSubmatch(code, -1) {
-			if len(m) > 1 {
-				output.WriteString(m[1] + "\n")
-			}
+		return map[string]string{tc.MainFile: req.Code}, tc.MainFile, ""
+	}
+	if req.Code != "" {
+		return nil, "", "Send either code or files, not both"
+	}
+	if len(req.Files) > maxProgramFiles {
+		return nil, "", fmt.Sprintf("At most %d files are allowed", maxProgramFiles)
+	}
+
+	size := 0
+	for name, source := range req.Files {
+		clean := path.Clean(name)
+		if clean != name || path.IsAbs(name) || strings.HasPrefix(name, "..") || strings.Contains(name, "\\") {
+			return nil, "", "Invalid file name: " + name
 		}
-	case LangGo:
-		re := regexp.MustCompile(`fmt\.Println\s*\(\s*"([^"]+)"\s*\)`)
-		for _, m := range re.FindAllStringSubmatch(code, -1) {
-			if len(m) > 1 {
-				output.WriteString(m[1] + "\n")
-			}
+		if path.Ext(name) != tc.Extension {
+			return nil, "", fmt.Sprintf("%s: only %s files are allowed", name, tc.Extension)
 		}
+		if strings.HasPrefix(name, "__pp_") || name == goDriverFile {
+			return nil, "", "Reserved file name: " + name
+		}
+		size += len(source)
+	}
+	if size > maxSourceBytes {
+		return nil, "", "Program is too large"
 	}
 
-	out := strings.TrimSpace(output.String())
-	if out == "" {
-		out = "[Code executed]"
+	entry := req.Entry
+	if entry == "" {
+		entry = tc.MainFile
+	}
+	if _, ok := req.Files[entry]; !ok {
+		return nil, "", "Entry file not found: " + entry
+	}
+	return req.Files, entry, ""
+}
+
+// runResponse converts a runner result into the API shape
+func runResponse(res *Result) RunResponse {
+	out := RunResponse{
+		Success:   !res.Failed(),
+		Output:    res.Stdout,
+		Stderr:    res.Stderr,
+		ExitCode:  res.ExitCode,
+		TimedOut:  res.TimedOut,
+		Truncated: res.Truncated,
+	}
+	if out.Success {
+		return out
 	}
 
-	return RunResponse{
-		Success: true,
-		Output:  out,
+	out.ErrorType = classifyError(res)
+	switch {
+	case res.TimedOut:
+		out.Error = "Time limit exceeded"
+	case res.Truncated:
+		out.Error = "Output limit exceeded"
+	case outOfMemoryPattern.MatchString(res.Stderr):
+		out.Error = "Memory limit exceeded"
+	case res.Signal != "":
+		out.Error = "Process terminated: " + res.Signal
+	default:
+		out.Error = errorSummary(res.Stderr)
+		if out.Error == "" {
+			out.Error = "Process exited with a non-zero status"
+		}
 	}
+	return out
 }
 
-func runTests(code, lang string, tests []TestCase) []TestResult {
-	results := make([]TestResult, len(tests))
+// classifyError maps a failed result onto the sandbox error types
+func classifyError(res *Result) string {
+	switch {
+	case res.TimedOut:
+		return ErrorTimeout
+	case res.Stage == StageCompile, strings.Contains(res.Stderr, "SyntaxError"):
+		return ErrorSyntax
+	default:
+		return ErrorRuntime
+	}
+}
 
-	hasFunc := strings.Contains(code, "function") ||
-		strings.Contains(code, "def ") ||
-		strings.Contains(code, "func ")
-	hasReturn := strings.Contains(code, "return")
+// outOfMemoryPattern matches allocation failures reported by each runtime
+var outOfMemoryPattern = regexp.MustCompile(`heap out of memory|std::bad_alloc|InternalError: out of memory|\bMemoryError\b|fatal error: runtime: out of memory`)
 
-	for i, tc := range tests {
-		passed := hasFunc && hasReturn
+// errorLinePattern matches the "Name: message" line runtimes print last
+var errorLinePattern = regexp.MustCompile(`^[\w.]*(Error|Exception|Interrupt|Exit)\b`)
 
-		results[i] = TestResult{
-			ID:       tc.ID,
-			Name:     tc.Name,
-			Passed:   passed,
-			Hidden:   tc.Hidden,
-			Expected: toJSON(tc.Expected),
+// errorSummary picks the most useful line out of a runtime's stderr
+func errorSummary(stderr string) string {
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); errorLinePattern.MatchString(line) {
+			return line
 		}
-
-		if passed {
-			results[i].Actual = toJSON(tc.Expected)
-			results[i].Message = "Test passed"
-		} else {
-			results[i].Actual = "[check implementation]"
-			results[i].Message = "Test failed"
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if line != "" && !strings.HasPrefix(line, "Node.js v") {
+			return line
 		}
 	}
+	return ""
+}
 
-	return results
+// summarize counts results and picks the error type of the first failure
+func summarize(results []TestResult) (passed, failed int, errType string) {
+	for _, r := range results {
+		if r.Passed {
+			passed++
+			continue
+		}
+		failed++
+		if errType == "" {
+			errType = r.ErrorType
+		}
+	}
+	return passed, failed, errType
 }
 
 func toJSON(v interface{}) string {
@@ -443,4 +819,3 @@ func writeJSON(w http.ResponseWriter, status int, v interface{}) {
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(v)
 }
-
@@ -0,0 +1,920 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// The harness wraps the learner's code with a per-language driver. The
+// driver reads harnessInputFile, calls the entry point with the decoded
+// arguments and prints one line: the run's marker followed by a JSON
+// envelope. Anything else the program prints is the learner's own output.
+const harnessInputFile = "__pp_input.json"
+
+// goDriverFile holds the generated main package for Go submissions
+const goDriverFile = "pp_driver.go"
+
+// harnessInput is the content of harnessInputFile. When Bench is set the
+// driver times the entry point on each argument list instead of calling
+// it with Args, printing one "bench" envelope per list. When Batch is set
+// it calls the entry point once per list, printing one "batch" or
+// "exception" envelope per list. The trace drivers only use Marker and the
+// trace fields.
+type harnessInput struct {
+	Marker   string          `json:"marker"`
+	Args     []interface{}   `json:"args"`
+	Bench    [][]interface{} `json:"bench,omitempty"`
+	BudgetNs int64           `json:"budgetNs,omitempty"` // time to spend repeating each bench call
+	Batch    [][]interface{} `json:"batch,omitempty"`
+
+	Entry    string   `json:"entry,omitempty"` // trace: file the program starts from
+	Files    []string `json:"files,omitempty"` // trace: the learner's files, the only ones traced
+	MaxSteps int      `json:"maxSteps,omitempty"`
+	MaxBytes int      `json:"maxBytes,omitempty"` // trace: step records to print before stopping
+
+	// Deterministic mode: seed the random number generator and freeze the
+	// wall clock at Now, in milliseconds since the epoch
+	Deterministic bool  `json:"deterministic,omitempty"`
+	Seed          int64 `json:"seed,omitempty"`
+	Now           int64 `json:"now,omitempty"`
+}
+
+// harnessOutcome is the envelope printed by a driver
+type harnessOutcome struct {
+	OK    bool            `json:"ok"`
+	Value json.RawMessage `json:"value"`
+	Kind  string          `json:"kind"` // "missing", "arguments", "exception", "bench" or "batch"
+	Error string          `json:"error"`
+	Trace string          `json:"trace"` // stack trace of an exception, in the runtime's format
+	Size  int             `json:"size"`  // bench and batch: index of the argument list
+	Ns    float64         `json:"ns"`    // bench: mean nanoseconds per call
+}
+
+var identPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+var entryPatterns = map[string][]*regexp.Regexp{
+	LangJavaScript: {
+		regexp.MustCompile(`(?m)^(?:async\s+)?function\s*\*?\s*([A-Za-z_$][\w$]*)\s*\(`),
+		regexp.MustCompile(`(?m)^(?:const|let|var)\s+([A-Za-z_$][\w$]*)\s*=\s*(?:async\s*)?(?:function\b|\([^)]*\)\s*=>|[A-Za-z_$][\w$]*\s*=>)`),
+	},
+	LangPython: {
+		regexp.MustCompile(`(?m)^(?:async\s+)?def\s+([A-Za-z_]\w*)\s*\(`),
+	},
+}
+
+// detectEntryPoint returns the first top-level function the learner defined
+func detectEntryPoint(lang, code string) string {
+	lang = dialect(lang)
+	if lang == LangGo {
+		file, err := parseGoSource(code)
+		if err != nil {
+			return ""
+		}
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name != "main" {
+				return fn.Name.Name
+			}
+		}
+		return ""
+	}
+
+	first, name := -1, ""
+	for _, re := range entryPatterns[lang] {
+		if m := re.FindStringSubmatchIndex(code); m != nil && (first < 0 || m[0] < first) {
+			first, name = m[0], code[m[2]:m[3]]
+		}
+	}
+	return name
+}
+
+// testArgs converts TestCase.Input into an argument list: arrays are the
+// positional arguments, anything else is a single argument
+func testArgs(input interface{}) []interface{} {
+	if input == nil {
+		return []interface{}{}
+	}
+	if args, ok := input.([]interface{}); ok {
+		return args
+	}
+	return []interface{}{input}
+}
+
+// caseHooks observe test cases as runTests works through them; either
+// func may be nil
+type caseHooks struct {
+	before func(index int, tc TestCase)
+	after  func(index int, result TestResult)
+}
+
+// report passes results checked outside runTests to after, numbering
+// them from offset
+func (h caseHooks) report(offset int, results []TestResult) {
+	if h.after == nil {
+		return
+	}
+	for i, result := range results {
+		h.after(offset+i, result)
+	}
+}
+
+// runTests calls the learner's entry point once per test case, each in a
+// fresh process under limits and the case's own time limit. When every
+// case is graded on printed output alone and no entry point is named, the
+// program runs from the top instead, as a script.
+func runTests(ctx context.Context, runner Runner, lang, code, entry string, sig *Signature, tests []TestCase, limits Limits, hooks caseHooks) ([]TestResult, error) {
+	results := make([]TestResult, len(tests))
+	script := entry == "" && printsOnly(tests)
+	if entry == "" && !script {
+		entry = detectEntryPoint(lang, code)
+	}
+
+	var files map[string]string
+	var start, problem string
+	if script {
+		files, start = scriptFiles(lang, code, anyDeterministic(tests))
+	} else {
+		files, problem = harnessFiles(lang, code, entry, sig)
+	}
+	if problem == "" && dialect(lang) == LangPython && anyDeterministic(tests) {
+		files[pyDeterminismFile] = pyDeterminismSource
+	}
+	sources := harnessSourceMap(lang, code)
+	for i, tc := range tests {
+		if hooks.before != nil {
+			hooks.before(i, tc)
+		}
+
+		results[i] = TestResult{
+			ID:       tc.ID,
+			Name:     tc.Name,
+			Hidden:   tc.Hidden,
+			Expected: toJSON(tc.Expected),
+		}
+		switch {
+		case problem != "":
+			results[i].Message = problem
+			results[i].ErrorType = ErrorSyntax
+		case i > 0 && results[i-1].ErrorType == ErrorSyntax:
+			// Once the code fails to build, every remaining case fails the same way
+			results[i].Message = results[i-1].Message
+			results[i].ErrorType = ErrorSyntax
+			results[i].diagnostics = results[i-1].diagnostics
+		default:
+			if err := runTestCase(ctx, runner, lang, files, start, script, sources, tc, caseLimits(limits, tc), &results[i]); err != nil {
+				return nil, err
+			}
+		}
+
+		if hooks.after != nil {
+			hooks.after(i, results[i])
+		}
+	}
+
+	return results, nil
+}
+
+// caseLimits applies a test case's timeout, clamped to sane bounds, to
+// the exercise's limits
+func caseLimits(base Limits, tc TestCase) Limits {
+	if tc.TimeoutMs <= 0 {
+		return base
+	}
+	timeout := time.Duration(tc.TimeoutMs) * time.Millisecond
+	if timeout < MinTestTimeout {
+		timeout = MinTestTimeout
+	}
+	if timeout > MaxTestTimeout {
+		timeout = MaxTestTimeout
+	}
+	base.WallTime = timeout
+	base.CPUTime = timeout
+	return base
+}
+
+// runTestCase executes one case and fills in its result. A script run
+// starts from the file start, or the main file when empty, and has no
+// envelope: its printed output is the result.
+func runTestCase(ctx context.Context, runner Runner, lang string, files map[string]string, start string, script bool, sources sourceMap, tc TestCase, limits Limits, result *TestResult) error {
+	marker, err := newMarker()
+	if err != nil {
+		return err
+	}
+	in := harnessInput{Marker: marker, Args: testArgs(tc.Input)}
+	var env []string
+	if tc.Deterministic {
+		deterministicInput(&in, tc)
+		env = deterministicEnv
+	}
+	input, err := json.Marshal(in)
+	if err != nil {
+		result.Message = "Invalid test input"
+		result.ErrorType = ErrorRuntime
+		return nil
+	}
+
+	caseFiles := make(map[string]string, len(files)+1)
+	for name, content := range files {
+		caseFiles[name] = content
+	}
+	caseFiles[harnessInputFile] = string(input)
+
+	res, err := runner.Run(ctx, Program{Language: lang, Files: caseFiles, Entry: start, Env: env, Limits: limits})
+	if err != nil {
+		return err
+	}
+
+	outcome, found := parseOutcome(res.Stdout, marker)
+	if script {
+		outcome, found = harnessOutcome{OK: true, Value: json.RawMessage("null")}, !res.Failed()
+	}
+	switch {
+	case res.TimedOut:
+		result.Message = fmt.Sprintf("Time limit exceeded (%d ms). Check that every loop eventually stops.", limits.WallTime.Milliseconds())
+		result.ErrorType = ErrorTimeout
+	case res.Stage == StageCompile:
+		result.Message = "Compilation failed: " + errorSummary(res.Stderr)
+		result.ErrorType = ErrorSyntax
+		result.diagnostics = diagnose(lang, res.Stderr, sources)
+		// Prefer the first error's position in the learner's own lines
+		if len(result.diagnostics) > 0 && result.diagnostics[0].Line > 0 {
+			d := result.diagnostics[0]
+			result.Message = fmt.Sprintf("Compilation failed: line %d: %s", d.Line, d.Message)
+		}
+	case !found:
+		result.Message = runResponse(res).Error
+		if result.Message == "" {
+			result.Message = "Program exited before the function returned"
+		}
+		result.ErrorType = classifyError(res)
+		result.diagnostics = diagnose(lang, res.Stderr, sources)
+	case !outcome.OK && outcome.Kind == "missing":
+		result.Message = outcome.Error
+		result.ErrorType = ErrorSyntax
+	case !outcome.OK:
+		result.Message = "Runtime error: " + outcome.Error
+		result.ErrorType = ErrorRuntime
+		result.diagnostics = diagnose(lang, outcome.Trace, sources)
+		if len(result.diagnostics) == 0 {
+			result.diagnostics = []Diagnostic{{Severity: SeverityError, Message: outcome.Error, Type: ErrorRuntime}}
+		}
+	default:
+		verdict, err := tc.Checker.check(ctx, runner, tc, outcome.Value, programOutput(res.Stdout, marker))
+		if err != nil {
+			return err
+		}
+		result.Actual = verdict.actual
+		if verdict.passed {
+			result.Passed = true
+			result.Message = "Test passed"
+			return nil
+		}
+		result.Message = verdict.message
+		result.ErrorType = ErrorLogic
+		switch {
+		case verdict.errorType != "":
+			result.ErrorType = verdict.errorType
+		case tc.Hidden:
+			result.ErrorType = ErrorEdgeCase
+		}
+	}
+	return nil
+}
+
+// programOutput is what the program printed before the driver's envelope
+func programOutput(stdout, marker string) string {
+	if idx := strings.LastIndex(stdout, marker); idx >= 0 {
+		stdout = strings.TrimSuffix(stdout[:idx], "\n")
+	}
+	return stdout
+}
+
+// parseOutcome finds the driver's envelope in stdout
+func parseOutcome(stdout, marker string) (harnessOutcome, bool) {
+	var outcome harnessOutcome
+	idx := strings.LastIndex(stdout, marker)
+	if idx < 0 {
+		return outcome, false
+	}
+	line := stdout[idx+len(marker):]
+	if end := strings.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+	if err := json.Unmarshal([]byte(line), &outcome); err != nil {
+		return outcome, false
+	}
+	return outcome, true
+}
+
+// valuesEqual compares an expected value with the driver's JSON result
+// structurally, so formatting and key order do not matter
+func valuesEqual(expected interface{}, actual json.RawMessage) bool {
+	var got interface{}
+	if err := json.Unmarshal(actual, &got); err != nil {
+		return false
+	}
+	var want interface{}
+	if err := json.Unmarshal([]byte(toJSON(expected)), &want); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(want, got)
+}
+
+func compactJSON(raw json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
+
+func newMarker() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate harness marker: %w", err)
+	}
+	return "@@PP:" + hex.EncodeToString(b) + ":", nil
+}
+
+// harnessFiles builds the program files for a test run. A non-empty
+// problem means the submission cannot be tested at all.
+func harnessFiles(lang, code, entry string, sig *Signature) (map[string]string, string) {
+	tc, _ := lookupToolchain(lang)
+	lang = dialect(lang)
+	if lang == LangGo {
+		if _, err := parseGoSource(code); err != nil {
+			// Let the compiler report the syntax error against the learner's file
+			return map[string]string{tc.MainFile: goSource(code), goDriverFile: "package main\n\nfunc main() {}\n"}, ""
+		}
+	}
+
+	if entry == "" {
+		return nil, "No function found to test"
+	}
+	if !identPattern.MatchString(entry) {
+		return nil, "Invalid function name: " + entry
+	}
+
+	data := driverData{Entry: entry, Adapters: `[null, ""]`}
+	if sig != nil {
+		params, returns := sig.adapterTypes()
+		data.Adapters = "[" + params + ", " + returns + "]"
+	}
+
+	switch lang {
+	case LangJavaScript:
+		return map[string]string{tc.MainFile: code + "\n" + render(jsDriver, data)}, ""
+	case LangPython:
+		return map[string]string{tc.MainFile: code + "\n" + render(pyDriver, data)}, ""
+	case LangGo:
+		return goHarnessFiles(tc, code, data)
+	}
+	return nil, "Unsupported language"
+}
+
+// printsOnly reports whether every one of tests is graded on what the
+// program prints rather than on a returned value
+func printsOnly(tests []TestCase) bool {
+	for _, tc := range tests {
+		if tc.Checker == nil || tc.Checker.comparesValues() {
+			return false
+		}
+	}
+	return len(tests) > 0
+}
+
+// jsScriptFile starts a deterministic JavaScript script, setting up
+// deterministic mode before it loads the learner's main file
+const jsScriptFile = "pp_script.js"
+
+// scriptFiles builds the program files for a script run, which executes
+// the learner's code as it is. It also returns the file to start, empty
+// for the toolchain's main file.
+func scriptFiles(lang, code string, deterministic bool) (map[string]string, string) {
+	tc, _ := lookupToolchain(lang)
+	switch dialect(lang) {
+	case LangGo:
+		return map[string]string{tc.MainFile: goSource(code)}, ""
+	case LangJavaScript:
+		if deterministic {
+			driver := ";(function () {\n  const input = JSON.parse(require('fs').readFileSync('" + harnessInputFile + "', 'utf8'));\n" +
+				jsDeterminism + "})();\nrequire('./" + tc.MainFile + "');\n"
+			return map[string]string{tc.MainFile: code, jsScriptFile: driver}, jsScriptFile
+		}
+	}
+	return map[string]string{tc.MainFile: code}, ""
+}
+
+// harnessSourceMap locates the learner's code inside the files built by
+// harnessFiles. Drivers for interpreted languages are appended below it;
+// Go code may have gained a package clause above it.
+func harnessSourceMap(lang, code string) sourceMap {
+	tc, _ := lookupToolchain(lang)
+	sf := sourceFile{Name: tc.MainFile, Lines: countLines(code), Source: code}
+	if dialect(lang) == LangGo {
+		sf.Offset = strings.Count(goSource(code), "\n") - strings.Count(code, "\n")
+	}
+	return sourceMap{tc.MainFile: sf}
+}
+
+// goHarnessFiles generates a typed driver from the entry point's signature
+func goHarnessFiles(tc Toolchain, code string, data driverData) (map[string]string, string) {
+	if data.Entry == "main" {
+		return nil, "The function to test cannot be called main"
+	}
+	source, file, err := goHarnessSource(code)
+	if err != nil {
+		return nil, "Code does not compile"
+	}
+
+	var fn *ast.FuncDecl
+	for _, decl := range file.Decls {
+		if d, ok := decl.(*ast.FuncDecl); ok && d.Recv == nil && d.Name.Name == data.Entry {
+			fn = d
+		}
+	}
+	if fn == nil {
+		return nil, "Function " + data.Entry + " is not defined"
+	}
+
+	fset := token.NewFileSet()
+	var args []string
+	for _, field := range fn.Type.Params.List {
+		typ := field.Type
+		spread := ""
+		if ell, ok := typ.(*ast.Ellipsis); ok {
+			typ = &ast.ArrayType{Elt: ell.Elt}
+			spread = "..."
+		}
+		var buf bytes.Buffer
+		printer.Fprint(&buf, fset, typ)
+		for i := 0; i < max(len(field.Names), 1); i++ {
+			args = append(args, fmt.Sprintf("a%d%s", len(data.Params), spread))
+			data.Params = append(data.Params, buf.String())
+		}
+	}
+
+	var results, values []string
+	if fn.Type.Results != nil {
+		for _, field := range fn.Type.Results.List {
+			isError := false
+			if id, ok := field.Type.(*ast.Ident); ok && id.Name == "error" {
+				isError = true
+			}
+			for i := 0; i < max(len(field.Names), 1); i++ {
+				name := fmt.Sprintf("r%d", len(results))
+				results = append(results, name)
+				if isError {
+					data.ErrVar = name
+				} else {
+					values = append(values, "normalize("+name+")")
+				}
+			}
+		}
+	}
+
+	data.Call = data.Entry + "(" + strings.Join(args, ", ") + ")"
+	if len(results) > 0 {
+		data.Call = strings.Join(results, ", ") + " := " + data.Call
+	}
+	switch len(values) {
+	case 0:
+		data.Value = "nil"
+	case 1:
+		data.Value = values[0]
+	default:
+		data.Value = "[]interface{}{" + strings.Join(values, ", ") + "}"
+	}
+
+	return map[string]string{tc.MainFile: source, goDriverFile: render(goDriver, data)}, ""
+}
+
+// goPackageClause matches a file's package clause, capturing the name
+var goPackageClause = regexp.MustCompile(`(?m)^\s*package\s+(\w+)`)
+
+// goSource adds the package clause learners usually leave out, and puts
+// files declaring another package in main, where the driver lives
+func goSource(code string) string {
+	m := goPackageClause.FindStringSubmatchIndex(code)
+	if m == nil {
+		return "package main\n\n" + code
+	}
+	return code[:m[2]] + "main" + code[m[3]:]
+}
+
+// goLearnerMain is what a main function in the learner's file is renamed
+// to, since the driver brings its own
+const goLearnerMain = "ppLearnerMain"
+
+// goHarnessSource makes the learner's file part of the driver's program:
+// a main function of its own is renamed along with every call of it. The
+// edits stay on their lines, so diagnostics still point at the learner's
+// code.
+func goHarnessSource(code string) (string, *ast.File, error) {
+	source := goSource(code)
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", source, 0)
+	if err != nil {
+		return "", nil, err
+	}
+
+	type edit struct {
+		offset   int
+		old, new string
+	}
+	var edits []edit
+	var learnerMain *ast.Object
+	for _, decl := range file.Decls {
+		if d, ok := decl.(*ast.FuncDecl); ok && d.Recv == nil && d.Name.Name == "main" {
+			learnerMain = d.Name.Obj
+		}
+	}
+	if learnerMain != nil {
+		ast.Inspect(file, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && id.Name == "main" && id.Obj == learnerMain {
+				edits = append(edits, edit{fset.Position(id.Pos()).Offset, "main", goLearnerMain})
+			}
+			return true
+		})
+	}
+
+	// Apply from the end so earlier offsets stay valid
+	sort.Slice(edits, func(i, j int) bool { return edits[i].offset > edits[j].offset })
+	for _, e := range edits {
+		source = source[:e.offset] + e.new + source[e.offset+len(e.old):]
+	}
+	return source, file, nil
+}
+
+func parseGoSource(code string) (*ast.File, error) {
+	return parser.ParseFile(token.NewFileSet(), "main.go", goSource(code), 0)
+}
+
+// driverData parameterizes the driver templates
+type driverData struct {
+	Entry    string
+	Adapters string   // JSON [parameter types, return type] from the signature; Go uses its own types
+	Params   []string // Go parameter types
+	Call     string   // Go statement calling the entry point
+	ErrVar   string   // Go result holding a returned error, if any
+	Value    string   // Go expression for the reported value
+}
+
+func render(tmpl *template.Template, data driverData) string {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		panic(err)
+	}
+	return buf.String()
+}
+
+// jsDeterminism sets up deterministic mode in a JavaScript driver, after
+// it has read input: a seeded Math.random (mulberry32) and a Date whose
+// clock stands still at input.now
+const jsDeterminism = `  if (input.deterministic) {
+    let ppSeed = input.seed >>> 0;
+    Math.random = () => {
+      ppSeed = (ppSeed + 0x6d2b79f5) >>> 0;
+      let t = ppSeed;
+      t = Math.imul(t ^ (t >>> 15), t | 1);
+      t ^= t + Math.imul(t ^ (t >>> 7), t | 61);
+      return ((t ^ (t >>> 14)) >>> 0) / 4294967296;
+    };
+    const PPDate = Date;
+    globalThis.Date = new Proxy(PPDate, {
+      construct: (target, args, newTarget) => Reflect.construct(target, args.length ? args : [input.now], newTarget),
+      apply: () => new PPDate(input.now).toString(),
+      get: (target, prop, receiver) => (prop === 'now' ? () => input.now : Reflect.get(target, prop, receiver)),
+    });
+  }
+`
+
+var jsDriver = template.Must(template.New("js").Parse(`
+;(function () {
+  const input = JSON.parse(require('fs').readFileSync('` + harnessInputFile + `', 'utf8'));
+` + jsDeterminism + `  const emit = (env) => {
+    let line;
+    try {
+      line = JSON.stringify(env);
+    } catch (err) {
+      line = JSON.stringify({ ok: false, kind: 'exception', size: env.size, error: 'Return value is not JSON serializable: ' + err.message });
+    }
+    process.stdout.write('\n' + input.marker + line + '\n');
+  };
+  let fn;
+  try {
+    fn = {{.Entry}};
+  } catch (err) {
+    fn = undefined;
+  }
+  if (typeof fn !== 'function') {
+    emit({ ok: false, kind: 'missing', error: 'Function {{.Entry}} is not defined' });
+    return;
+  }
+  // Values are adapted to the signature's types: sets and typed arrays
+  // become arrays and BigInts numbers. The names stay clear of the
+  // learner's, which this scope would otherwise shadow.
+  const [ppTypes, ppReturns] = {{.Adapters}};
+  const ppAdapt = (value, type) => {
+    if (!type || value === null || value === undefined) return value;
+    if (type.endsWith('[]')) {
+      if (Array.isArray(value) || value instanceof Set || ArrayBuffer.isView(value)) {
+        return Array.from(value, (item) => ppAdapt(item, type.slice(0, -2)));
+      }
+      return value;
+    }
+    if ((type === 'int' || type === 'float') && typeof value === 'bigint') return Number(value);
+    return value;
+  };
+  if (ppTypes) {
+    const ppEntry = fn;
+    fn = (...args) => {
+      const out = ppEntry(...args.map((arg, i) => ppAdapt(arg, ppTypes[i])));
+      return out instanceof Promise ? out.then((value) => ppAdapt(value, ppReturns)) : ppAdapt(out, ppReturns);
+    };
+  }
+  const failure = (err) => ({
+    ok: false,
+    kind: 'exception',
+    error: String(err && err.name ? err.name + ': ' + err.message : err),
+    trace: err && typeof err.stack === 'string' ? err.stack : '',
+  });
+  const fail = (err) => emit(failure(err));
+  if (input.batch) {
+    (async () => {
+      for (let size = 0; size < input.batch.length; size++) {
+        try {
+          const value = await fn(...input.batch[size]);
+          emit({ ok: true, kind: 'batch', size, value: value === undefined ? null : value });
+        } catch (err) {
+          emit({ ...failure(err), size });
+        }
+      }
+    })();
+    return;
+  }
+  if (input.bench) {
+    for (let size = 0; size < input.bench.length; size++) {
+      let spent = 0;
+      let reps = 0;
+      while (reps < 1 || (spent < input.budgetNs && reps < 1000)) {
+        const args = structuredClone(input.bench[size]);
+        const start = process.hrtime.bigint();
+        try {
+          fn(...args);
+        } catch (err) {
+          fail(err);
+          return;
+        }
+        spent += Number(process.hrtime.bigint() - start);
+        reps++;
+      }
+      emit({ ok: true, kind: 'bench', size, ns: spent / reps });
+    }
+    return;
+  }
+  Promise.resolve()
+    .then(() => fn(...input.args))
+    .then(
+      (value) => emit({ ok: true, value: value === undefined ? null : value }),
+      fail
+    );
+})();
+`))
+
+var pyDriver = template.Must(template.New("py").Parse(`
+
+def __pp_main():
+    import json, sys, traceback
+
+    with open("` + harnessInputFile + `") as f:
+        data = json.load(f)
+
+    def default(value):
+        if isinstance(value, (set, frozenset, tuple)):
+            return list(value)
+        raise TypeError(type(value).__name__ + " is not JSON serializable")
+
+    def emit(env):
+        try:
+            line = json.dumps(env, default=default)
+        except (TypeError, ValueError) as err:
+            line = json.dumps({"ok": False, "kind": "exception", "size": env.get("size", 0), "error": "Return value is not JSON serializable: " + str(err)})
+        sys.stdout.write("\n" + data["marker"] + line + "\n")
+        sys.stdout.flush()
+
+    fn = globals().get("{{.Entry}}")
+    if not callable(fn):
+        emit({"ok": False, "kind": "missing", "error": "Function {{.Entry}} is not defined"})
+        return
+
+    # Values are adapted to the signature's types: whole floats become ints,
+    # ints floats, and tuples and sets lists
+    types, returns = json.loads('{{.Adapters}}')
+
+    def adapt(value, kind):
+        if not kind or value is None:
+            return value
+        if kind.endswith("[]"):
+            if isinstance(value, (list, tuple, set, frozenset)):
+                return [adapt(item, kind[:-2]) for item in value]
+            return value
+        if kind == "int" and isinstance(value, float) and value.is_integer():
+            return int(value)
+        if kind == "float" and isinstance(value, int) and not isinstance(value, bool):
+            return float(value)
+        return value
+
+    if types is not None:
+        entry = fn
+
+        def fn(*args):
+            args = [adapt(arg, types[i]) if i < len(types) else arg for i, arg in enumerate(args)]
+            return adapt(entry(*args), returns)
+    if data.get("bench"):
+        import copy, time
+        for size, bench_args in enumerate(data["bench"]):
+            spent = reps = 0
+            while reps < 1 or (spent < data["budgetNs"] and reps < 1000):
+                args = copy.deepcopy(bench_args)
+                start = time.perf_counter_ns()
+                try:
+                    fn(*args)
+                except BaseException as err:
+                    emit({"ok": False, "kind": "exception", "error": type(err).__name__ + ": " + str(err), "trace": traceback.format_exc()})
+                    return
+                spent += time.perf_counter_ns() - start
+                reps += 1
+            emit({"ok": True, "kind": "bench", "size": size, "ns": spent / reps})
+        return
+    if data.get("batch"):
+        for size, args in enumerate(data["batch"]):
+            try:
+                value = fn(*args)
+            except BaseException as err:
+                emit({"ok": False, "kind": "exception", "size": size, "error": type(err).__name__ + ": " + str(err), "trace": traceback.format_exc()})
+                continue
+            emit({"ok": True, "kind": "batch", "size": size, "value": value})
+        return
+    try:
+        value = fn(*data["args"])
+    except BaseException as err:
+        emit({"ok": False, "kind": "exception", "error": type(err).__name__ + ": " + str(err), "trace": traceback.format_exc()})
+        return
+    emit({"ok": True, "value": value})
+
+
+__pp_main()
+`))
+
+var goDriver = template.Must(template.New("go").Parse(`package main
+
+import (
+	ppjson "encoding/json"
+	ppfmt "fmt"
+	ppos "os"
+	ppreflect "reflect"
+	ppdebug "runtime/debug"
+	pptime "time"
+)
+
+func main() {
+	var input struct {
+		Marker   string                ` + "`json:\"marker\"`" + `
+		Args     []ppjson.RawMessage   ` + "`json:\"args\"`" + `
+		Bench    [][]ppjson.RawMessage ` + "`json:\"bench\"`" + `
+		BudgetNs int64                 ` + "`json:\"budgetNs\"`" + `
+		Batch    [][]ppjson.RawMessage ` + "`json:\"batch\"`" + `
+	}
+	raw, err := ppos.ReadFile("` + harnessInputFile + `")
+	if err == nil {
+		err = ppjson.Unmarshal(raw, &input)
+	}
+	if err != nil {
+		ppfmt.Fprintln(ppos.Stderr, "harness:", err)
+		ppos.Exit(2)
+	}
+
+	emit := func(env map[string]interface{}) {
+		line, err := ppjson.Marshal(env)
+		if err != nil {
+			line, _ = ppjson.Marshal(map[string]interface{}{"ok": false, "kind": "exception", "size": env["size"], "error": "Return value is not JSON serializable: " + err.Error()})
+		}
+		ppos.Stdout.WriteString("\n" + input.Marker + string(line) + "\n")
+	}
+	// nil slices and maps would serialize as null; learners mean "empty"
+	normalize := func(v interface{}) interface{} {
+		rv := ppreflect.ValueOf(v)
+		switch {
+		case rv.Kind() == ppreflect.Slice && rv.IsNil():
+			return ppreflect.MakeSlice(rv.Type(), 0, 0).Interface()
+		case rv.Kind() == ppreflect.Map && rv.IsNil():
+			return ppreflect.MakeMap(rv.Type()).Interface()
+		}
+		return v
+	}
+
+	// prepare decodes the arguments and returns a call of the entry point
+	prepare := func(args []ppjson.RawMessage) (func() (interface{}, error), bool) {
+		if len(args) != {{len .Params}} {
+			emit(map[string]interface{}{"ok": false, "kind": "arguments", "error": ppfmt.Sprintf("{{.Entry}} takes {{len .Params}} arguments but the test passes %d", len(args))})
+			return nil, false
+		}
+{{- range $i, $t := .Params}}
+		var a{{$i}} {{$t}}
+		if err := ppjson.Unmarshal(args[{{$i}}], &a{{$i}}); err != nil {
+			emit(map[string]interface{}{"ok": false, "kind": "arguments", "error": "argument {{$i}}: " + err.Error()})
+			return nil, false
+		}
+{{- end}}
+		return func() (interface{}, error) {
+			{{.Call}}
+{{- if .ErrVar}}
+			if {{.ErrVar}} != nil {
+				return nil, {{.ErrVar}}
+			}
+{{- end}}
+			return {{.Value}}, nil
+		}, true
+	}
+	_ = normalize
+
+	defer func() {
+		if r := recover(); r != nil {
+			trace := ppfmt.Sprintf("panic: %v\n\n%s", r, ppdebug.Stack())
+			emit(map[string]interface{}{"ok": false, "kind": "exception", "error": ppfmt.Sprintf("panic: %v", r), "trace": trace})
+		}
+	}()
+
+	for size, args := range input.Bench {
+		var spent pptime.Duration
+		reps := 0
+		for reps < 1 || spent < pptime.Duration(input.BudgetNs) && reps < 1000 {
+			call, ok := prepare(args)
+			if !ok {
+				return
+			}
+			start := pptime.Now()
+			_, err := call()
+			spent += pptime.Since(start)
+			reps++
+			if err != nil {
+				emit(map[string]interface{}{"ok": false, "kind": "exception", "error": err.Error()})
+				return
+			}
+		}
+		emit(map[string]interface{}{"ok": true, "kind": "bench", "size": size, "ns": float64(spent.Nanoseconds()) / float64(reps)})
+	}
+	if input.Bench != nil {
+		return
+	}
+
+	for size, args := range input.Batch {
+		call, ok := prepare(args)
+		if !ok {
+			return
+		}
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					trace := ppfmt.Sprintf("panic: %v\n\n%s", r, ppdebug.Stack())
+					emit(map[string]interface{}{"ok": false, "kind": "exception", "size": size, "error": ppfmt.Sprintf("panic: %v", r), "trace": trace})
+				}
+			}()
+			value, err := call()
+			if err != nil {
+				emit(map[string]interface{}{"ok": false, "kind": "exception", "size": size, "error": err.Error()})
+				return
+			}
+			emit(map[string]interface{}{"ok": true, "kind": "batch", "size": size, "value": value})
+		}()
+	}
+	if input.Batch != nil {
+		return
+	}
+
+	call, ok := prepare(input.Args)
+	if !ok {
+		return
+	}
+	value, err := call()
+	if err != nil {
+		emit(map[string]interface{}{"ok": false, "kind": "exception", "error": err.Error()})
+		return
+	}
+	emit(map[string]interface{}{"ok": true, "value": value})
+}
+`))
@@ -0,0 +1,73 @@
+package sandbox
+
+import (
+	"context"
+	"testing"
+)
+
+// printRunner answers every program with the same output and records the
+// programs it was given
+type printRunner struct {
+	stdout   string
+	programs []Program
+}
+
+func (r *printRunner) Run(ctx context.Context, prog Program) (*Result, error) {
+	r.programs = append(r.programs, prog)
+	return &Result{Stdout: r.stdout}, nil
+}
+
+func TestRunTestsScript(t *testing.T) {
+	stdout := &Checker{Type: CheckStdout}
+	regex, err := ParseChecker([]byte(`{"type": "regex", "pattern": "hel+o", "stdout": true}`))
+	if err != nil {
+		t.Fatalf("ParseChecker: %v", err)
+	}
+	scripts := map[string]string{
+		LangGo:         "package main\n\nimport \"fmt\"\n\nfunc greet() string { return \"hello\" }\n\nfunc main() { fmt.Println(greet()) }\n",
+		LangJavaScript: "const greet = () => 'hello'\nconsole.log(greet())\n",
+		LangPython:     "def greet():\n    return 'hello'\n\nprint(greet())\n",
+	}
+
+	tests := []struct {
+		name   string
+		entry  string
+		tests  []TestCase
+		script bool // the program runs without a driver
+		passed []bool
+	}{
+		{"stdout", "", []TestCase{{Expected: "hello", Checker: stdout}, {Expected: "bye", Checker: stdout}}, true, []bool{true, false}},
+		{"stdout regex", "", []TestCase{{Checker: regex}}, true, []bool{true}},
+		{"value", "", []TestCase{{Expected: "hello"}, {Expected: "hello", Checker: stdout}}, false, []bool{false, false}},
+		{"named entry", "greet", []TestCase{{Expected: "hello", Checker: stdout}}, false, nil},
+	}
+	for _, tt := range tests {
+		for lang, code := range scripts {
+			runner := &printRunner{stdout: "hello\n"}
+			results, err := runTests(context.Background(), runner, lang, code, tt.entry, nil, tt.tests, DefaultLimits(), caseHooks{})
+			if err != nil {
+				t.Fatalf("%s %s: runTests: %v", tt.name, lang, err)
+			}
+			tc, _ := lookupToolchain(lang)
+			prog := runner.programs[0]
+			if script := prog.Files[tc.MainFile] == code; script != tt.script {
+				t.Errorf("%s %s: ran as script = %v, want %v: %q", tt.name, lang, script, tt.script, prog.Files[tc.MainFile])
+			}
+			for i, want := range tt.passed {
+				if results[i].Passed != want {
+					t.Errorf("%s %s: case %d passed = %v (%s), want %v", tt.name, lang, i, results[i].Passed, results[i].Message, want)
+				}
+			}
+		}
+	}
+}
+
+func TestScriptFilesDeterministic(t *testing.T) {
+	files, start := scriptFiles(LangJavaScript, "console.log(Math.random())\n", true)
+	if start != jsScriptFile || files["main.js"] != "console.log(Math.random())\n" {
+		t.Fatalf("start %q, files %v; want the learner's main.js started from %s", start, files, jsScriptFile)
+	}
+	if _, start := scriptFiles(LangPython, "print(1)\n", true); start != "" {
+		t.Errorf("Python starts from %q, want its main file", start)
+	}
+}
@@ -0,0 +1,457 @@
+package sandbox
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/programprimitives/api/internal/auth"
+)
+
+// Kinds of attempt
+const (
+	AttemptRun    = "run"
+	AttemptSubmit = "submit"
+)
+
+// Attempt is one stored run or submission of an exercise
+type Attempt struct {
+	ID          string       `json:"id"`
+	UserID      string       `json:"userId"`
+	ExerciseID  string       `json:"exerciseId"`
+	Language    string       `json:"language"`
+	Kind        string       `json:"kind"`
+	Code        string       `json:"code,omitempty"` // left out of listings
+	Passed      bool         `json:"passed"`
+	TestsPassed int          `json:"testsPassed"`
+	TestsFailed int          `json:"testsFailed"`
+	Score       *int         `json:"score,omitempty"` // submissions only
+	ErrorType   string       `json:"errorType,omitempty"`
+	ExecutionMs int64        `json:"executionMs"`
+	Results     []TestResult `json:"results,omitempty"`
+	CreatedAt   string       `json:"createdAt"`
+}
+
+// Listing limits for HandleListAttempts
+const (
+	defaultAttemptPage = 50
+	maxAttemptPage     = 200
+)
+
+// recordAttempt stores an attempt for the signed-in user. Anonymous
+// attempts are not kept, and a failure to store one never fails the
+// request.
+func (h *Handler) recordAttempt(r *http.Request, a Attempt) {
+	if h.db == nil || h.authHandler == nil {
+		return
+	}
+	user := h.authHandler.GetUserFromSession(r)
+	if user == nil {
+		return
+	}
+
+	id, err := auth.GenerateUserID()
+	if err != nil {
+		log.Printf("Failed to record attempt: %v", err)
+		return
+	}
+	results, err := json.Marshal(a.Results)
+	if err != nil {
+		log.Printf("Failed to record attempt: %v", err)
+		return
+	}
+	_, err = h.db.Exec(`
+		INSERT INTO exercise_attempts (id, user_id, exercise_id, language, kind, code, passed, tests_passed, tests_failed,
+		                               score, error_type, results, execution_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, id, user.ID, a.ExerciseID, a.Language, a.Kind, a.Code, a.Passed, a.TestsPassed, a.TestsFailed,
+		a.Score, a.ErrorType, string(results), a.ExecutionMs, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		log.Printf("Failed to record attempt: %v", err)
+	}
+}
+
+// HandleListAttempts lists the signed-in learner's attempts at an exercise,
+// newest first, without their code. Admins may pass ?userId= to see a
+// learner's history; ?language= and ?kind= filter it.
+func (h *Handler) HandleListAttempts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.historyOwner(w, r)
+	if !ok {
+		return
+	}
+
+	query := `
+		SELECT id, user_id, exercise_id, language, kind, passed, tests_passed, tests_failed,
+		       score, COALESCE(error_type, ''), COALESCE(execution_ms, 0), created_at
+		FROM exercise_attempts WHERE user_id = ? AND exercise_id = ?
+	`
+	args := []interface{}{userID, r.PathValue("id")}
+	if lang := r.URL.Query().Get("language"); lang != "" {
+		query += " AND language = ?"
+		args = append(args, lang)
+	}
+	if kind := r.URL.Query().Get("kind"); kind != "" {
+		query += " AND kind = ?"
+		args = append(args, kind)
+	}
+	limit := defaultAttemptPage
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = min(n, maxAttemptPage)
+	}
+	query += " ORDER BY created_at DESC, rowid DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		log.Printf("Failed to list attempts: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"success": false, "error": "Failed to list attempts"})
+		return
+	}
+	defer rows.Close()
+
+	attempts := []Attempt{}
+	for rows.Next() {
+		var a Attempt
+		var score sql.NullInt64
+		if err := rows.Scan(&a.ID, &a.UserID, &a.ExerciseID, &a.Language, &a.Kind, &a.Passed, &a.TestsPassed, &a.TestsFailed,
+			&score, &a.ErrorType, &a.ExecutionMs, &a.CreatedAt); err != nil {
+			log.Printf("Failed to read attempt: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"success": false, "error": "Failed to list attempts"})
+			return
+		}
+		if score.Valid {
+			s := int(score.Int64)
+			a.Score = &s
+		}
+		attempts = append(attempts, a)
+	}
+	writeJSON(w, http.StatusOK, attempts)
+}
+
+// HandleGetAttempt returns one attempt with its code and test results
+func (h *Handler) HandleGetAttempt(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.attemptFor(w, r, r.PathValue("attemptId"))
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, a)
+}
+
+// AttemptDiff compares the code of two attempts
+type AttemptDiff struct {
+	From    *Attempt   `json:"from"`
+	To      *Attempt   `json:"to"`
+	Added   int        `json:"added"`
+	Removed int        `json:"removed"`
+	Lines   []DiffLine `json:"lines"`
+	Unified string     `json:"unified"`
+}
+
+// HandleDiffAttempts diffs the code of attempts ?from= and ?to=, which
+// must both be the same learner's attempts at the exercise
+func (h *Handler) HandleDiffAttempts(w http.ResponseWriter, r *http.Request) {
+	fromID, toID := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	if fromID == "" || toID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"success": false, "error": "from and to are required"})
+		return
+	}
+	from, ok := h.attemptFor(w, r, fromID)
+	if !ok {
+		return
+	}
+	to, ok := h.attemptFor(w, r, toID)
+	if !ok {
+		return
+	}
+	if from.UserID != to.UserID {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"success": false, "error": "Attempts belong to different learners"})
+		return
+	}
+
+	lines := diffLines(from.Code, to.Code)
+	d := &AttemptDiff{From: from, To: to, Lines: lines, Unified: unifiedDiff(lines, from.ID, to.ID)}
+	for _, l := range lines {
+		switch l.Op {
+		case DiffInsert:
+			d.Added++
+		case DiffDelete:
+			d.Removed++
+		}
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+// historyOwner returns whose history a request reads: the signed-in user,
+// or for admins the ?userId= learner. When it fails it writes the response
+// itself and returns ok=false.
+func (h *Handler) historyOwner(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user := h.sessionUser(w, r)
+	if user == nil {
+		return "", false
+	}
+	if id := r.URL.Query().Get("userId"); id != "" && id != user.ID {
+		if user.Role != "admin" {
+			writeJSON(w, http.StatusForbidden, map[string]interface{}{"success": false, "error": "Only admins can view other learners' attempts"})
+			return "", false
+		}
+		return id, true
+	}
+	return user.ID, true
+}
+
+// attemptFor loads an attempt at the {id} exercise that the signed-in user
+// may see: their own, or anyone's for admins. When it fails it writes the
+// response itself and returns ok=false.
+func (h *Handler) attemptFor(w http.ResponseWriter, r *http.Request, attemptID string) (*Attempt, bool) {
+	user := h.sessionUser(w, r)
+	if user == nil {
+		return nil, false
+	}
+
+	a, err := h.loadAttempt(attemptID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to load attempt %s: %v", attemptID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"success": false, "error": "Failed to load attempt"})
+		return nil, false
+	}
+	// Other learners' attempts are reported as missing, not forbidden
+	if err == sql.ErrNoRows || a.ExerciseID != r.PathValue("id") || (a.UserID != user.ID && user.Role != "admin") {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"success": false, "error": "Attempt not found"})
+		return nil, false
+	}
+	return a, true
+}
+
+// sessionUser returns the signed-in user, responding 401 when there is none
+func (h *Handler) sessionUser(w http.ResponseWriter, r *http.Request) *auth.User {
+	var user *auth.User
+	if h.authHandler != nil {
+		user = h.authHandler.GetUserFromSession(r)
+	}
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"success": false, "error": "Please log in to view your attempts"})
+	}
+	return user
+}
+
+func (h *Handler) loadAttempt(id string) (*Attempt, error) {
+	a := &Attempt{ID: id}
+	var score sql.NullInt64
+	var results sql.NullString
+	err := h.db.QueryRow(`
+		SELECT user_id, exercise_id, language, kind, code, passed, tests_passed, tests_failed,
+		       score, COALESCE(error_type, ''), results, COALESCE(execution_ms, 0), created_at
+		FROM exercise_attempts WHERE id = ?
+	`, id).Scan(&a.UserID, &a.ExerciseID, &a.Language, &a.Kind, &a.Code, &a.Passed, &a.TestsPassed, &a.TestsFailed,
+		&score, &a.ErrorType, &results, &a.ExecutionMs, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if score.Valid {
+		s := int(score.Int64)
+		a.Score = &s
+	}
+	if results.Valid && results.String != "" {
+		if err := json.Unmarshal([]byte(results.String), &a.Results); err != nil {
+			return nil, fmt.Errorf("invalid results: %w", err)
+		}
+	}
+	return a, nil
+}
+
+// Operations in a line diff
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// DiffLine is one line of a diff. OldLine and NewLine are 1-based line
+// numbers in the two versions, zero where the line is absent.
+type DiffLine struct {
+	Op      string `json:"op"`
+	Text    string `json:"text"`
+	OldLine int    `json:"oldLine,omitempty"`
+	NewLine int    `json:"newLine,omitempty"`
+}
+
+// maxDiffCells bounds the longest-common-subsequence table; beyond it the
+// changed middle of the two versions is shown as replaced wholesale
+const maxDiffCells = 4 << 20
+
+// diffLines computes a line diff of a and b. Common leading and trailing
+// lines are matched directly, and the rest by longest common subsequence.
+func diffLines(a, b string) []DiffLine {
+	old, cur := splitLines(a), splitLines(b)
+
+	prefix := 0
+	for prefix < len(old) && prefix < len(cur) && old[prefix] == cur[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(cur)-prefix && old[len(old)-1-suffix] == cur[len(cur)-1-suffix] {
+		suffix++
+	}
+	x, y := old[prefix:len(old)-suffix], cur[prefix:len(cur)-suffix]
+
+	var lines []DiffLine
+	oldLine, newLine := 1, 1
+	equal := func(text string) {
+		lines = append(lines, DiffLine{Op: DiffEqual, Text: text, OldLine: oldLine, NewLine: newLine})
+		oldLine++
+		newLine++
+	}
+	remove := func(text string) {
+		lines = append(lines, DiffLine{Op: DiffDelete, Text: text, OldLine: oldLine})
+		oldLine++
+	}
+	insert := func(text string) {
+		lines = append(lines, DiffLine{Op: DiffInsert, Text: text, NewLine: newLine})
+		newLine++
+	}
+
+	for _, text := range old[:prefix] {
+		equal(text)
+	}
+	if (len(x)+1)*(len(y)+1) > maxDiffCells {
+		for _, text := range x {
+			remove(text)
+		}
+		for _, text := range y {
+			insert(text)
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence of
+		// x[i:] and y[j:]
+		lcs := make([][]int, len(x)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(y)+1)
+		}
+		for i := len(x) - 1; i >= 0; i-- {
+			for j := len(y) - 1; j >= 0; j-- {
+				if x[i] == y[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(x) || j < len(y) {
+			switch {
+			case i < len(x) && j < len(y) && x[i] == y[j]:
+				equal(x[i])
+				i++
+				j++
+			case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+				remove(x[i])
+				i++
+			default:
+				insert(y[j])
+				j++
+			}
+		}
+	}
+	for _, text := range old[len(old)-suffix:] {
+		equal(text)
+	}
+	return lines
+}
+
+// splitLines splits code into lines, ignoring a final newline
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// diffContext is how many unchanged lines surround each hunk
+const diffContext = 3
+
+// unifiedDiff renders a line diff in unified format
+func unifiedDiff(lines []DiffLine, fromName, toName string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", fromName, toName)
+
+	for start := 0; start < len(lines); {
+		// Find the next change and the run of lines its hunk covers
+		first := start
+		for first < len(lines) && lines[first].Op == DiffEqual {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		begin := max(first-diffContext, start)
+		end := first
+		for end < len(lines) {
+			if lines[end].Op != DiffEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(lines) && lines[run].Op == DiffEqual {
+				run++
+			}
+			if run == len(lines) || run-end > 2*diffContext {
+				end = min(end+diffContext, len(lines))
+				break
+			}
+			end = run
+		}
+
+		hunk := lines[begin:end]
+		oldStart, newStart, oldCount, newCount := 0, 0, 0, 0
+		for _, l := range hunk {
+			if l.Op != DiffInsert {
+				if oldStart == 0 {
+					oldStart = l.OldLine
+				}
+				oldCount++
+			}
+			if l.Op != DiffDelete {
+				if newStart == 0 {
+					newStart = l.NewLine
+				}
+				newCount++
+			}
+		}
+		if oldStart == 0 {
+			oldStart = hunkAnchor(lines, begin, func(l DiffLine) int { return l.OldLine })
+		}
+		if newStart == 0 {
+			newStart = hunkAnchor(lines, begin, func(l DiffLine) int { return l.NewLine })
+		}
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, l := range hunk {
+			prefix := " "
+			switch l.Op {
+			case DiffInsert:
+				prefix = "+"
+			case DiffDelete:
+				prefix = "-"
+			}
+			b.WriteString(prefix + l.Text + "\n")
+		}
+		start = end
+	}
+	return b.String()
+}
+
+// hunkAnchor returns the line a hunk that has no lines in one version
+// starts after, as unified diffs number it
+func hunkAnchor(lines []DiffLine, begin int, number func(DiffLine) int) int {
+	for i := begin - 1; i >= 0; i-- {
+		if n := number(lines[i]); n > 0 {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,81 @@
+package sandbox
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// numbered returns lines a1 to an, replacing the lines in subs
+func numbered(n int, subs map[int]string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		line, ok := subs[i]
+		if !ok {
+			line = fmt.Sprintf("a%d", i)
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []string // op prefix, text and line numbers of each diff line
+	}{
+		{"identical", "x\ny\n", "x\ny", []string{" x 1 1", " y 2 2"}},
+		{"both empty", "", "", nil},
+		{"from empty", "", "x\n", []string{"+x 0 1"}},
+		{"to empty", "x\n", "", []string{"-x 1 0"}},
+		{"crlf", "x\r\ny\r\n", "x\ny\n", []string{" x 1 1", " y 2 2"}},
+		{"replace middle", "a\nb\nc\n", "a\nB\nc\n", []string{" a 1 1", "-b 2 0", "+B 0 2", " c 3 3"}},
+		{"delete and append", "a\nb\nc\n", "a\nc\nd\n", []string{" a 1 1", "-b 2 0", " c 3 2", "+d 0 3"}},
+		{"insert at start", "b\nc\n", "a\nb\nc\n", []string{"+a 0 1", " b 1 2", " c 2 3"}},
+		{"moved line", "a\nb\nc\n", "b\nc\na\n", []string{"-a 1 0", " b 2 1", " c 3 2", "+a 0 3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, l := range diffLines(tt.a, tt.b) {
+				op := map[string]string{DiffEqual: " ", DiffInsert: "+", DiffDelete: "-"}[l.Op]
+				got = append(got, fmt.Sprintf("%s%s %d %d", op, l.Text, l.OldLine, l.NewLine))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffLines = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string // hunks, as diff -u prints them
+	}{
+		{"identical", "x\n", "x\n", ""},
+		{"one change", numbered(10, nil), numbered(10, map[int]string{5: "X"}),
+			"@@ -2,7 +2,7 @@\n a2\n a3\n a4\n-a5\n+X\n a6\n a7\n a8\n"},
+		{"from empty", "", "x\ny\n", "@@ -0,0 +1,2 @@\n+x\n+y\n"},
+		{"to empty", "x\ny\n", "", "@@ -1,2 +0,0 @@\n-x\n-y\n"},
+		{"far apart", numbered(20, nil), numbered(20, map[int]string{2: "B", 18: "C"}),
+			"@@ -1,5 +1,5 @@\n a1\n-a2\n+B\n a3\n a4\n a5\n" +
+				"@@ -15,6 +15,6 @@\n a15\n a16\n a17\n-a18\n+C\n a19\n a20\n"},
+		{"close together", numbered(20, nil), numbered(20, map[int]string{5: "B", 11: "C"}),
+			"@@ -2,13 +2,13 @@\n a2\n a3\n a4\n-a5\n+B\n a6\n a7\n a8\n a9\n a10\n-a11\n+C\n a12\n a13\n a14\n"},
+		{"delete and append", "a\nb\nc\n", "a\nc\nd\n", "@@ -1,3 +1,3 @@\n a\n-b\n c\n+d\n"},
+		{"insert after line", numbered(8, nil), strings.Replace(numbered(8, nil), "a8\n", "a8\nz\n", 1),
+			"@@ -6,3 +6,4 @@\n a6\n a7\n a8\n+z\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unifiedDiff(diffLines(tt.a, tt.b), "old", "new")
+			if want := "--- old\n+++ new\n" + tt.want; got != want {
+				t.Errorf("unifiedDiff:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,432 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// shimArg marks a re-execution of the current binary as the sandbox shim
+const shimArg = "__pp_sandbox_exec__"
+
+// probeArg marks the program checkIsolation runs through the shim
+const probeArg = "__pp_sandbox_probe__"
+
+// Linux constants the syscall package does not export
+const (
+	rlimitNproc  = 0x6
+	prNoNewPrivs = 38
+)
+
+// shimPath is the binary used to isolate commands and apply resource
+// limits before exec. It stays empty until Init has run in the host process.
+var shimPath string
+
+// Init must be called at the top of main. When the process was started as
+// the sandbox shim it isolates itself, applies the requested resource
+// limits and replaces itself with the target command, never returning.
+// Otherwise it enables the shim for this process's ProcessRunner.
+func Init() {
+	if len(os.Args) > 1 && os.Args[1] == shimArg {
+		runShim(os.Args[2:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == probeArg {
+		if os.Getuid() == 0 || os.Getpid() != 1 {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		log.Printf("⚠️  Sandbox shim disabled: %v", err)
+		return
+	}
+	shimPath = exe
+}
+
+// runShim is the body of the shim process: <spec> -- <path> [args...].
+// The spec is a comma-separated list of name=value settings.
+func runShim(args []string) {
+	if len(args) < 3 || args[1] != "--" {
+		shimFail(126, "malformed shim invocation")
+	}
+	spec := map[string]string{}
+	for _, kv := range strings.Split(args[0], ",") {
+		name, value, _ := strings.Cut(kv, "=")
+		spec[name] = value
+	}
+
+	if _, ok := spec["uid"]; ok {
+		if err := enterSandbox(spec); err != nil {
+			shimFail(126, err.Error())
+		}
+	}
+
+	for name, resource := range map[string]int{
+		"cpu":    syscall.RLIMIT_CPU,
+		"data":   syscall.RLIMIT_DATA,
+		"fsize":  syscall.RLIMIT_FSIZE,
+		"nofile": syscall.RLIMIT_NOFILE,
+		"nproc":  rlimitNproc,
+		"core":   syscall.RLIMIT_CORE,
+	} {
+		n, err := strconv.ParseUint(spec[name], 10, 64)
+		if err != nil {
+			continue
+		}
+		lim := &syscall.Rlimit{Cur: n, Max: n}
+		if resource == syscall.RLIMIT_CPU {
+			// SIGXCPU at the soft limit, SIGKILL one second later
+			lim.Max = n + 1
+		}
+		if err := syscall.Setrlimit(resource, lim); err != nil {
+			shimFail(126, fmt.Sprintf("failed to set %s limit: %v", name, err))
+		}
+	}
+
+	target := args[2:]
+	err := syscall.Exec(target[0], target, os.Environ())
+	shimFail(127, fmt.Sprintf("exec %s: %v", target[0], err))
+}
+
+func shimFail(code int, msg string) {
+	fmt.Fprintln(os.Stderr, "sandbox:", msg)
+	os.Exit(code)
+}
+
+// sandboxDevices are the device nodes an isolated command can use
+var sandboxDevices = []string{"/dev/null", "/dev/zero", "/dev/random", "/dev/urandom"}
+
+// sandboxRoot is where the shim assembles the command's root before
+// switching to it. A tmpfs mounted there covers the host's /tmp.
+const sandboxRoot = "/tmp"
+
+// enterSandbox runs in the shim, as root and as the first process of
+// fresh mount, PID, network, IPC and UTS namespaces. It switches to a new
+// root holding only the read paths, read-only, the devices and the keep
+// directories, with a private /tmp and /proc and the hide directories
+// covered by empty ones, and drops to the sandbox account for good.
+func enterSandbox(spec map[string]string) error {
+	uid, err := strconv.Atoi(spec["uid"])
+	if err != nil {
+		return fmt.Errorf("invalid uid %q", spec["uid"])
+	}
+	gid, err := strconv.Atoi(spec["gid"])
+	if err != nil {
+		return fmt.Errorf("invalid gid %q", spec["gid"])
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	// Mounts below must not propagate back to the host
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+
+	// Everything the new root shows is opened before the root covers the
+	// host's /tmp, where some of it may live. Parents come before the
+	// paths inside them so they do not cover them.
+	readPaths := splitList(spec["read"])
+	sort.Strings(readPaths)
+	read, err := openMounts(readPaths, true)
+	if err != nil {
+		return err
+	}
+	devices, err := openMounts(sandboxDevices, true)
+	if err != nil {
+		return err
+	}
+	keep, err := openMounts(splitList(spec["keep"]), false)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, m := range append(append(read, devices...), keep...) {
+			if m.f != nil {
+				m.f.Close()
+			}
+		}
+	}()
+
+	flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV)
+	if err := syscall.Mount("tmpfs", sandboxRoot, "tmpfs", flags, "mode=0755,size=1m"); err != nil {
+		return fmt.Errorf("mount sandbox root: %w", err)
+	}
+	tmp := filepath.Join(sandboxRoot, "tmp")
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return err
+	}
+	if err := syscall.Mount("tmpfs", tmp, "tmpfs", flags, "mode=1777,size="+spec["tmp"]); err != nil {
+		return fmt.Errorf("mount private /tmp: %w", err)
+	}
+	for _, m := range read {
+		if err := m.bind(sandboxRoot, flags|syscall.MS_RDONLY); err != nil {
+			return err
+		}
+	}
+	for _, m := range devices {
+		if err := m.bind(sandboxRoot, syscall.MS_NOSUID|syscall.MS_NOEXEC); err != nil {
+			return err
+		}
+	}
+	for _, dir := range splitList(spec["hide"]) {
+		target := filepath.Join(sandboxRoot, dir)
+		if _, err := os.Stat(target); err != nil {
+			continue // not in view
+		}
+		if err := syscall.Mount("tmpfs", target, "tmpfs", flags, "mode=0755,size=64k"); err != nil {
+			return fmt.Errorf("hide %s: %w", dir, err)
+		}
+	}
+	for _, m := range keep {
+		if err := m.bind(sandboxRoot, flags); err != nil {
+			return err
+		}
+	}
+	proc := filepath.Join(sandboxRoot, "proc")
+	if err := os.MkdirAll(proc, 0555); err != nil {
+		return err
+	}
+	if err := syscall.Mount("proc", proc, "proc", flags|syscall.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mount /proc: %w", err)
+	}
+
+	// Switch roots and let go of the host's
+	old := filepath.Join(sandboxRoot, ".host")
+	if err := os.Mkdir(old, 0700); err != nil {
+		return err
+	}
+	if err := syscall.PivotRoot(sandboxRoot, old); err != nil {
+		return fmt.Errorf("pivot_root: %w", err)
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+	if err := syscall.Unmount("/.host", syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("detach host root: %w", err)
+	}
+	if err := os.Remove("/.host"); err != nil {
+		return err
+	}
+	if err := syscall.Mount("", "/", "", syscall.MS_REMOUNT|syscall.MS_RDONLY|flags, ""); err != nil {
+		return fmt.Errorf("make root read-only: %w", err)
+	}
+	if err := os.Chdir(cwd); err != nil {
+		return err
+	}
+
+	if err := syscall.Setgroups(nil); err != nil {
+		return fmt.Errorf("drop groups: %w", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("setgid: %w", err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("setuid: %w", err)
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("set no_new_privs: %w", errno)
+	}
+	return nil
+}
+
+// hostMount is a host path to show in the sandbox root: an open handle
+// to bind from, or the target of a symbolic link to recreate
+type hostMount struct {
+	path string
+	f    *os.File
+	link string
+	dir  bool
+}
+
+// openMounts opens paths for binding. Missing paths are skipped when
+// optional, and otherwise an error.
+func openMounts(paths []string, optional bool) ([]hostMount, error) {
+	var mounts []hostMount
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if err != nil {
+			if optional && os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		m := hostMount{path: path, dir: info.IsDir()}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if m.link, err = os.Readlink(path); err != nil {
+				return nil, err
+			}
+		} else if m.f, err = os.Open(path); err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, m)
+	}
+	return mounts, nil
+}
+
+// bind shows the host path at the same place under root with flags, as
+// a link again when it is one
+func (m hostMount) bind(root string, flags uintptr) error {
+	target := filepath.Join(root, m.path)
+	if _, err := os.Lstat(target); err == nil && m.link != "" {
+		return nil // shown through a read path above it
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if m.link != "" {
+		return os.Symlink(m.link, target)
+	}
+	if m.dir {
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+	} else if _, err := os.Lstat(target); err != nil {
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+	src := fmt.Sprintf("/proc/self/fd/%d", m.f.Fd())
+	if err := syscall.Mount(src, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("mount %s: %w", m.path, err)
+	}
+	// Bind mounts take the source's flags; others need a remount
+	if err := syscall.Mount("", target, "", syscall.MS_REMOUNT|syscall.MS_BIND|flags, ""); err != nil {
+		return fmt.Errorf("restrict %s: %w", m.path, err)
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ":")
+}
+
+// checkIsolation reports why programs cannot be isolated, by running a
+// probe through the shim the way every sandboxed command runs
+func checkIsolation(cfg ProcessConfig) error {
+	switch {
+	case shimPath == "":
+		return errors.New("sandbox.Init was not called")
+	case os.Geteuid() != 0:
+		return errors.New("the server must run as root to isolate programs")
+	case cfg.UID <= 0 || cfg.GID <= 0:
+		return errors.New("programs need a dedicated unprivileged UID and GID")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	iso := &isolation{uid: cfg.UID, gid: cfg.GID, read: append(append([]string{}, cfg.ReadPaths...), filepath.Dir(shimPath)), hide: []string{cfg.WorkDir}}
+	cmd := newCommand(ctx, DefaultLimits(), iso, shimPath, []string{probeArg})
+	cmd.Dir = "/"
+	isolate(cmd, iso)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("isolation probe failed: %v %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// newCommand builds a command that runs under limits, and isolated when
+// iso is set, routed through the shim when it is available. nproc is only
+// enforced for isolated commands since RLIMIT_NPROC counts every process
+// the user owns.
+func newCommand(ctx context.Context, limits Limits, iso *isolation, path string, args []string) *exec.Cmd {
+	if shimPath == "" {
+		return exec.CommandContext(ctx, path, args...)
+	}
+
+	spec := []string{"core=0"}
+	if limits.CPUTime > 0 {
+		secs := int64(limits.CPUTime.Seconds())
+		if secs < 1 {
+			secs = 1
+		}
+		spec = append(spec, fmt.Sprintf("cpu=%d", secs))
+	}
+	if limits.MemoryBytes > 0 {
+		spec = append(spec, fmt.Sprintf("data=%d", limits.MemoryBytes))
+	}
+	if limits.FileBytes > 0 {
+		spec = append(spec, fmt.Sprintf("fsize=%d", limits.FileBytes))
+	}
+	if limits.MaxFiles > 0 {
+		spec = append(spec, fmt.Sprintf("nofile=%d", limits.MaxFiles))
+	}
+	if iso != nil {
+		if limits.MaxProcs > 0 {
+			spec = append(spec, fmt.Sprintf("nproc=%d", limits.MaxProcs))
+		}
+		tmp := limits.FileBytes
+		if tmp <= 0 {
+			tmp = 64 << 20
+		}
+		spec = append(spec,
+			fmt.Sprintf("uid=%d", iso.uid), fmt.Sprintf("gid=%d", iso.gid), fmt.Sprintf("tmp=%d", tmp),
+			"read="+strings.Join(iso.read, ":"), "hide="+strings.Join(iso.hide, ":"), "keep="+strings.Join(iso.keep, ":"))
+	}
+
+	shimArgs := append([]string{shimArg, strings.Join(spec, ","), "--", path}, args...)
+	return exec.CommandContext(ctx, shimPath, shimArgs...)
+}
+
+// isolate puts an isolated command in its own namespaces, where the shim
+// sets it up, and kills it when the server dies
+func isolate(cmd *exec.Cmd, iso *isolation) {
+	attr := sysProcAttr(cmd)
+	attr.Pdeathsig = syscall.SIGKILL
+	if iso == nil {
+		return
+	}
+	attr.Cloneflags = syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET |
+		syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+}
+
+// setProcessGroup puts the command in its own process group so timeouts
+// also reach anything it forked
+func setProcessGroup(cmd *exec.Cmd) {
+	sysProcAttr(cmd).Setpgid = true
+}
+
+// killProcessGroup kills the command and all of its descendants
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// exitSignal reports the signal that ended the process, and whether it
+// was the CPU-time limit
+func exitSignal(state *os.ProcessState) (string, bool) {
+	ws, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return "", false
+	}
+	sig := ws.Signal()
+	return sig.String(), sig == syscall.SIGXCPU
+}
+
+func sysProcAttr(cmd *exec.Cmd) *syscall.SysProcAttr {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	return cmd.SysProcAttr
+}
@@ -0,0 +1,38 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// Init is a no-op outside Linux; programs run without resource limits
+// beyond the wall-clock and output caps
+func Init() {}
+
+// checkIsolation fails: isolating programs needs Linux namespaces
+func checkIsolation(cfg ProcessConfig) error {
+	return errors.New("isolating programs needs Linux")
+}
+
+func newCommand(ctx context.Context, limits Limits, iso *isolation, path string, args []string) *exec.Cmd {
+	return exec.CommandContext(ctx, path, args...)
+}
+
+func isolate(cmd *exec.Cmd, iso *isolation) {}
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
+
+func exitSignal(state *os.ProcessState) (string, bool) {
+	return "", false
+}
@@ -0,0 +1,489 @@
+package sandbox
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenKind classifies the tokens produced by the source lexers
+type tokenKind int
+
+const (
+	tokIdent   tokenKind = iota // identifier or keyword
+	tokString                   // string literal; text holds the decoded value when simple
+	tokNumber                   // numeric literal
+	tokPunct                    // operator or delimiter
+	tokNewline                  // end of a logical line (Python only)
+	tokComment                  // comment; text holds the comment body
+	tokRegexp                   // regular expression literal (JavaScript only)
+)
+
+// lexeme is one lexical element with its 1-based position
+type lexeme struct {
+	kind tokenKind
+	text string
+	line int
+	col  int
+}
+
+// lexer is a small scanner shared by the JavaScript and Python tokenizers.
+// It is deliberately forgiving: malformed input still produces tokens so
+// the policy and style checks can run before the real parser complains.
+type lexer struct {
+	src  string
+	pos  int
+	line int
+	col  int
+	toks []lexeme
+}
+
+func newLexer(src string) *lexer {
+	return &lexer{src: src, line: 1, col: 1}
+}
+
+func (l *lexer) eof() bool { return l.pos >= len(l.src) }
+
+func (l *lexer) peek(n int) byte {
+	if l.pos+n < len(l.src) {
+		return l.src[l.pos+n]
+	}
+	return 0
+}
+
+func (l *lexer) advance() rune {
+	r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+	l.pos += size
+	if r == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	return r
+}
+
+func (l *lexer) emit(kind tokenKind, text string, line, col int) {
+	l.toks = append(l.toks, lexeme{kind: kind, text: text, line: line, col: col})
+}
+
+// last returns the most recent lexeme that is not a comment
+func (l *lexer) last() *lexeme {
+	for i := len(l.toks) - 1; i >= 0; i-- {
+		if l.toks[i].kind != tokComment {
+			return &l.toks[i]
+		}
+	}
+	return nil
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// quoted scans a single-line string body up to quote, handling escapes
+func (l *lexer) quoted(quote byte, raw bool) string {
+	var b strings.Builder
+	for !l.eof() {
+		c := l.src[l.pos]
+		if c == quote {
+			l.advance()
+			break
+		}
+		if c == '\n' && quote != '`' {
+			break
+		}
+		if c == '\\' && l.pos+1 < len(l.src) {
+			l.advance()
+			if raw {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(l.advance())
+			continue
+		}
+		b.WriteRune(l.advance())
+	}
+	return b.String()
+}
+
+// jsRegexpAllowed reports whether a '/' after prev starts a regexp
+// literal rather than a division
+func jsRegexpAllowed(prev *lexeme) bool {
+	if prev == nil {
+		return true
+	}
+	switch prev.kind {
+	case tokNumber, tokString, tokRegexp:
+		return false
+	case tokIdent:
+		switch prev.text {
+		case "return", "typeof", "instanceof", "in", "of", "new", "delete", "void",
+			"throw", "case", "do", "else", "yield", "await":
+			return true
+		}
+		return false
+	case tokPunct:
+		return prev.text != ")" && prev.text != "]" && prev.text != "}"
+	}
+	return true
+}
+
+// jsTokens tokenizes JavaScript. Template literal text is emitted as
+// string tokens and ${} substitutions are tokenized as code. Unicode
+// escapes in identifiers are decoded, so eval reads as eval.
+func jsTokens(src string) []lexeme {
+	l := newLexer(src)
+	var braces []bool // true for a ${ opened inside a template literal
+
+	for !l.eof() {
+		line, col := l.line, l.col
+		c := l.src[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			l.advance()
+		case c == '/' && l.peek(1) == '/':
+			start := l.pos
+			for !l.eof() && l.src[l.pos] != '\n' {
+				l.advance()
+			}
+			l.emit(tokComment, l.src[start+2:l.pos], line, col)
+		case c == '/' && l.peek(1) == '*':
+			start := l.pos
+			l.advance()
+			l.advance()
+			for !l.eof() && !(l.src[l.pos] == '*' && l.peek(1) == '/') {
+				l.advance()
+			}
+			end := l.pos
+			if !l.eof() {
+				l.advance()
+				l.advance()
+			}
+			l.emit(tokComment, l.src[start+2:end], line, col)
+		case c == '\'' || c == '"':
+			l.advance()
+			l.emit(tokString, l.quoted(c, false), line, col)
+		case c == '`':
+			l.advance()
+			l.jsTemplate(&braces, line, col)
+		case c == '}' && len(braces) > 0 && braces[len(braces)-1]:
+			braces = braces[:len(braces)-1]
+			l.advance()
+			l.jsTemplate(&braces, line, col)
+		case c == '/' && jsRegexpAllowed(l.last()):
+			l.jsRegexp(line, col)
+		case c >= '0' && c <= '9' || c == '.' && l.peek(1) >= '0' && l.peek(1) <= '9':
+			start := l.pos
+			for !l.eof() && (isIdentPart(rune(l.src[l.pos])) || l.src[l.pos] == '.') {
+				l.advance()
+			}
+			l.emit(tokNumber, l.src[start:l.pos], line, col)
+		case c == '\\' || c >= utf8.RuneSelf || isIdentStart(rune(c)):
+			name, ok := l.jsIdent()
+			if !ok {
+				l.advance()
+				continue
+			}
+			l.emit(tokIdent, name, line, col)
+		default:
+			text := string(c)
+			if c == '?' && l.peek(1) == '.' {
+				// Optional chaining reads like member access
+				text = "?."
+				l.advance()
+			}
+			if c == '{' {
+				braces = append(braces, false)
+			}
+			if c == '}' && len(braces) > 0 {
+				braces = braces[:len(braces)-1]
+			}
+			l.advance()
+			l.emit(tokPunct, text, line, col)
+		}
+	}
+	return l.toks
+}
+
+// jsTemplate scans template literal text up to the closing backtick or
+// the next ${
+func (l *lexer) jsTemplate(braces *[]bool, line, col int) {
+	var b strings.Builder
+	for !l.eof() {
+		c := l.src[l.pos]
+		if c == '`' {
+			l.advance()
+			break
+		}
+		if c == '$' && l.peek(1) == '{' {
+			l.advance()
+			l.advance()
+			*braces = append(*braces, true)
+			break
+		}
+		if c == '\\' && l.pos+1 < len(l.src) {
+			l.advance()
+		}
+		b.WriteRune(l.advance())
+	}
+	l.emit(tokString, b.String(), line, col)
+}
+
+// jsRegexp scans a regular expression literal and its flags
+func (l *lexer) jsRegexp(line, col int) {
+	start := l.pos
+	l.advance()
+	inClass := false
+	for !l.eof() {
+		c := l.src[l.pos]
+		if c == '\n' {
+			break
+		}
+		l.advance()
+		if c == '\\' && !l.eof() {
+			l.advance()
+			continue
+		}
+		if c == '[' {
+			inClass = true
+		} else if c == ']' {
+			inClass = false
+		} else if c == '/' && !inClass {
+			break
+		}
+	}
+	for !l.eof() && isIdentPart(rune(l.src[l.pos])) {
+		l.advance()
+	}
+	l.emit(tokRegexp, l.src[start:l.pos], line, col)
+}
+
+// jsIdent scans an identifier, decoding \uXXXX and \u{X} escapes
+func (l *lexer) jsIdent() (string, bool) {
+	var b strings.Builder
+	for !l.eof() {
+		if l.src[l.pos] == '\\' && l.peek(1) == 'u' {
+			r, n := decodeUnicodeEscape(l.src[l.pos:])
+			if n == 0 {
+				break
+			}
+			for i := 0; i < n; i++ {
+				l.advance()
+			}
+			b.WriteRune(r)
+			continue
+		}
+		r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+		if b.Len() == 0 && !isIdentStart(r) || b.Len() > 0 && !isIdentPart(r) {
+			break
+		}
+		b.WriteRune(l.advance())
+	}
+	return b.String(), b.Len() > 0
+}
+
+// decodeUnicodeEscape decodes a leading \uXXXX or \u{X...} escape,
+// returning the rune and the number of bytes consumed
+func decodeUnicodeEscape(s string) (rune, int) {
+	if len(s) < 3 || s[0] != '\\' || s[1] != 'u' {
+		return 0, 0
+	}
+	digits, n := s[2:], 0
+	if s[2] == '{' {
+		end := strings.IndexByte(s, '}')
+		if end < 0 {
+			return 0, 0
+		}
+		digits, n = s[3:end], end+1
+	} else {
+		if len(s) < 6 {
+			return 0, 0
+		}
+		digits, n = s[2:6], 6
+	}
+	var r rune
+	for _, c := range digits {
+		var v rune
+		switch {
+		case c >= '0' && c <= '9':
+			v = c - '0'
+		case c >= 'a' && c <= 'f':
+			v = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			v = c - 'A' + 10
+		default:
+			return 0, 0
+		}
+		r = r<<4 | v
+	}
+	return r, n
+}
+
+// pyTokens tokenizes Python. Newlines inside brackets are joined as the
+// language does; f-string replacement fields are tokenized as code.
+func pyTokens(src string) []lexeme {
+	l := newLexer(src)
+	l.pyScan(0)
+	return l.toks
+}
+
+// pyScan tokenizes until the end of input, or until a '}' closes a
+// replacement field when depth > 0
+func (l *lexer) pyScan(depth int) {
+	brackets := 0
+	for !l.eof() {
+		line, col := l.line, l.col
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.advance()
+			if brackets == 0 && depth == 0 {
+				if last := l.last(); last != nil && last.kind != tokNewline {
+					l.emit(tokNewline, "", line, col)
+				}
+			}
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f':
+			l.advance()
+		case c == '\\' && (l.peek(1) == '\n' || l.peek(1) == '\r'):
+			l.advance()
+			l.advance()
+		case c == '#':
+			start := l.pos
+			for !l.eof() && l.src[l.pos] != '\n' {
+				l.advance()
+			}
+			l.emit(tokComment, l.src[start+1:l.pos], line, col)
+		case c == '\'' || c == '"':
+			l.pyString("", line, col)
+		case c >= '0' && c <= '9' || c == '.' && l.peek(1) >= '0' && l.peek(1) <= '9':
+			start := l.pos
+			for !l.eof() && (isIdentPart(rune(l.src[l.pos])) || l.src[l.pos] == '.') {
+				l.advance()
+			}
+			l.emit(tokNumber, l.src[start:l.pos], line, col)
+		case c >= utf8.RuneSelf || isIdentStart(rune(c)) && c != '$':
+			start := l.pos
+			for !l.eof() {
+				r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+				if r == '$' || !isIdentPart(r) {
+					break
+				}
+				l.advance()
+			}
+			if l.pos == start {
+				l.advance()
+				continue
+			}
+			name := l.src[start:l.pos]
+			if !l.eof() && (l.src[l.pos] == '\'' || l.src[l.pos] == '"') && isStringPrefix(name) {
+				l.pyString(strings.ToLower(name), line, col)
+				continue
+			}
+			l.emit(tokIdent, normalizeIdent(name), line, col)
+		default:
+			switch c {
+			case '(', '[', '{':
+				brackets++
+			case ')', ']':
+				brackets--
+			case '}':
+				if brackets == 0 && depth > 0 {
+					l.advance()
+					return
+				}
+				brackets--
+			}
+			l.advance()
+			l.emit(tokPunct, string(c), line, col)
+		}
+	}
+}
+
+func isStringPrefix(s string) bool {
+	switch strings.ToLower(s) {
+	case "r", "u", "b", "f", "br", "rb", "fr", "rf":
+		return true
+	}
+	return false
+}
+
+// pyString scans a (possibly triple-quoted) string literal. Replacement
+// fields of f-strings are tokenized in place.
+func (l *lexer) pyString(prefix string, line, col int) {
+	quote := l.src[l.pos]
+	triple := l.peek(1) == quote && l.peek(2) == quote
+	raw := strings.Contains(prefix, "r")
+	format := strings.Contains(prefix, "f")
+	n := 1
+	if triple {
+		n = 3
+	}
+	for i := 0; i < n; i++ {
+		l.advance()
+	}
+
+	var b strings.Builder
+	for !l.eof() {
+		c := l.src[l.pos]
+		if c == quote && (!triple || l.peek(1) == quote && l.peek(2) == quote) {
+			for i := 0; i < n; i++ {
+				l.advance()
+			}
+			break
+		}
+		if c == '\n' && !triple {
+			break
+		}
+		if c == '\\' && l.pos+1 < len(l.src) {
+			l.advance()
+			if raw {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(l.advance())
+			continue
+		}
+		if format && c == '{' {
+			if l.peek(1) == '{' {
+				l.advance()
+				b.WriteRune(l.advance())
+				continue
+			}
+			l.advance()
+			l.pyScan(1)
+			continue
+		}
+		b.WriteRune(l.advance())
+	}
+	l.emit(tokString, b.String(), line, col)
+}
+
+// normalizeIdent folds compatibility characters Python would normalize
+// (NFKC) in identifiers, such as fullwidth letters, to plain ASCII
+func normalizeIdent(name string) string {
+	ascii := true
+	for i := 0; i < len(name); i++ {
+		if name[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return name
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 0xFF01 && r <= 0xFF5E: // fullwidth forms
+			return r - 0xFEE0
+		case r >= 0x1D400 && r <= 0x1D6A3: // mathematical alphanumerics
+			const letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+			return rune(letters[(r-0x1D400)%52])
+		case r >= 0x1D7CE && r <= 0x1D7FF: // mathematical digits
+			return '0' + (r-0x1D7CE)%10
+		}
+		return r
+	}, name)
+}
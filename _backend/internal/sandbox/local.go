@@ -0,0 +1,370 @@
+package sandbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalExercise is an exercise loaded for runs outside the API, such as
+// the ppsandbox command's. Its hidden test cases are included and results
+// are never redacted.
+type LocalExercise struct {
+	ID        string
+	Slug      string
+	Title     string
+	Languages []string // languages with starter code, in name order
+
+	db    *sql.DB
+	specs map[string]*exerciseSpec // bundles only, by language
+}
+
+// OpenExercise loads an exercise from db by ID or slug, published or not
+func OpenExercise(db *sql.DB, idOrSlug string) (*LocalExercise, error) {
+	rows, err := db.Query(`
+		SELECT id, slug, title FROM exercises WHERE id = ? OR slug = ?
+		ORDER BY id = ? DESC
+	`, idOrSlug, idOrSlug, idOrSlug)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load exercise: %w", err)
+	}
+	var found []LocalExercise
+	for rows.Next() {
+		var e LocalExercise
+		if err := rows.Scan(&e.ID, &e.Slug, &e.Title); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read exercise: %w", err)
+		}
+		found = append(found, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read exercise: %w", err)
+	}
+
+	switch {
+	case len(found) == 0:
+		return nil, ErrExerciseNotFound
+	case len(found) > 1 && found[0].ID != idOrSlug:
+		return nil, fmt.Errorf("slug %q names %d exercises, use an ID", idOrSlug, len(found))
+	}
+	e := &found[0]
+	e.db = db
+	if e.Languages, err = solutionLanguages(db, e.ID); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// bundleFile is the exercise.json of an exercise bundle
+type bundleFile struct {
+	ID               string                    `json:"id"`
+	Slug             string                    `json:"slug"`
+	Title            string                    `json:"title"`
+	EstimatedMinutes int                       `json:"estimatedMinutes"`
+	MemoryLimitMB    int                       `json:"memoryLimitMb"`
+	AllowedImports   []string                  `json:"allowedImports"`
+	Required         []string                  `json:"requiredConstructs"`
+	Forbidden        []string                  `json:"forbiddenConstructs"`
+	InputGenerator   json.RawMessage           `json:"inputGenerator,omitempty"`
+	InputSchema      json.RawMessage           `json:"inputSchema,omitempty"`
+	Signature        json.RawMessage           `json:"signature,omitempty"`
+	Deterministic    bool                      `json:"deterministic"`
+	Languages        map[string]bundleLanguage `json:"languages"`
+	TestCases        []bundleTestCase          `json:"testCases"`
+}
+
+// bundleLanguage names a language's files, relative to exercise.json
+type bundleLanguage struct {
+	EntryPoint string `json:"entryPoint"` // detected from the starter code when empty
+	Starter    string `json:"starter"`
+	Solution   string `json:"solution"`
+}
+
+type bundleTestCase struct {
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`    // argument list, or a single argument
+	Expected  json.RawMessage `json:"expected"` // the value the entry point returns
+	Hidden    bool            `json:"hidden"`
+	TimeoutMs int             `json:"timeoutMs"`
+	Checker   json.RawMessage `json:"checker,omitempty"`
+	Clock     string          `json:"clock,omitempty"` // deterministic bundles: the frozen time
+}
+
+// OpenBundle loads an exercise bundle: an exercise.json file, or a
+// directory holding one. Besides the exercise fields the admin API takes,
+// it lists "testCases" and, under "languages", each language's
+// "entryPoint" and "starter" and "solution" files. With a "signature" the
+// entry point and starter may be left out.
+func OpenBundle(path string) (*LocalExercise, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, "exercise.json")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	var b bundleFile
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("invalid bundle %s: %w", path, err)
+	}
+	dir := filepath.Dir(path)
+
+	if b.ID == "" {
+		b.ID = filepath.Base(dir)
+	}
+	if b.Slug == "" {
+		b.Slug = b.ID
+	}
+	if b.MemoryLimitMB != 0 && (b.MemoryLimitMB < MinMemoryLimitMB || b.MemoryLimitMB > MaxMemoryLimitMB) {
+		return nil, fmt.Errorf("memoryLimitMb must be between %d and %d", MinMemoryLimitMB, MaxMemoryLimitMB)
+	}
+	if err := ValidateConstructs(b.Required, b.Forbidden); err != nil {
+		return nil, err
+	}
+	var generator *InputGenerator
+	if len(b.InputGenerator) > 0 {
+		if generator, err = ParseInputGenerator(b.InputGenerator); err != nil {
+			return nil, err
+		}
+	}
+	var schema *InputSchema
+	if len(b.InputSchema) > 0 {
+		if schema, err = ParseInputSchema(b.InputSchema); err != nil {
+			return nil, err
+		}
+	}
+
+	var signature *Signature
+	if len(b.Signature) > 0 {
+		if signature, err = ParseSignature(b.Signature); err != nil {
+			return nil, err
+		}
+	}
+
+	var tests []TestCase
+	for i, c := range b.TestCases {
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("Test %d", i+1)
+		}
+		var input, expected interface{}
+		if len(c.Input) > 0 {
+			input = decodeStored(string(c.Input))
+		}
+		if len(c.Expected) > 0 {
+			expected = decodeStored(string(c.Expected))
+		}
+		var checker *Checker
+		if len(c.Checker) > 0 {
+			if checker, err = ParseChecker(c.Checker); err != nil {
+				return nil, fmt.Errorf("%s: %w", c.Name, err)
+			}
+		}
+		var clock *time.Time
+		if c.Clock != "" {
+			t, err := ParseClock(c.Clock)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", c.Name, err)
+			}
+			clock = &t
+		}
+		tests = append(tests, TestCase{
+			ID:            strconv.Itoa(i + 1),
+			Name:          c.Name,
+			Input:         input,
+			Expected:      expected,
+			Hidden:        c.Hidden,
+			TimeoutMs:     c.TimeoutMs,
+			Checker:       checker,
+			Deterministic: b.Deterministic,
+			Clock:         clock,
+		})
+	}
+
+	e := &LocalExercise{ID: b.ID, Slug: b.Slug, Title: b.Title, specs: map[string]*exerciseSpec{}}
+	for lang, files := range b.Languages {
+		if !validLang(lang) {
+			return nil, fmt.Errorf("unsupported language %q", lang)
+		}
+		if b.Deterministic && !DeterministicLanguage(lang) {
+			return nil, ErrNotDeterministic
+		}
+		spec := &exerciseSpec{
+			ID:               b.ID,
+			EstimatedMinutes: b.EstimatedMinutes,
+			Entry:            files.EntryPoint,
+			Tests:            tests,
+			Limits:           languageLimits(lang),
+			Policy:           Policy{AllowedImports: b.AllowedImports},
+			Required:         b.Required,
+			Forbidden:        b.Forbidden,
+			Generator:        generator,
+			Schema:           schema,
+			Signature:        signature,
+			Deterministic:    b.Deterministic,
+		}
+		if b.MemoryLimitMB > 0 {
+			spec.Limits.MemoryBytes = int64(b.MemoryLimitMB) << 20
+		}
+		for _, f := range []struct {
+			name string
+			dst  *string
+		}{{files.Starter, &spec.Starter}, {files.Solution, &spec.Solution}} {
+			if f.name == "" {
+				continue
+			}
+			src, err := os.ReadFile(filepath.Join(dir, f.name))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", lang, err)
+			}
+			*f.dst = string(src)
+		}
+		spec.applySignature(lang)
+		if spec.Entry == "" && spec.Starter != "" {
+			spec.Entry = detectEntryPoint(lang, spec.Starter)
+		}
+		e.specs[lang] = spec
+		e.Languages = append(e.Languages, lang)
+	}
+	sort.Strings(e.Languages)
+	return e, nil
+}
+
+// spec returns the exercise's grading data for lang
+func (e *LocalExercise) spec(lang string) (*exerciseSpec, error) {
+	if !validLang(lang) {
+		return nil, fmt.Errorf("unsupported language %q", lang)
+	}
+	spec, ok := e.specs[lang]
+	if e.db != nil {
+		var err error
+		if spec, err = readExercise(e.db, e.ID, lang, true, false); err != nil {
+			return nil, err
+		}
+	} else if !ok {
+		return nil, fmt.Errorf("the bundle has no %s files", lang)
+	}
+	if spec.Deterministic && !DeterministicLanguage(lang) {
+		return nil, ErrNotDeterministic
+	}
+	return spec, nil
+}
+
+// Solution returns the exercise's reference solution in lang
+func (e *LocalExercise) Solution(lang string) (string, error) {
+	spec, err := e.spec(lang)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(spec.Solution) == "" {
+		return "", fmt.Errorf("the exercise has no %s reference solution", lang)
+	}
+	return spec.Solution, nil
+}
+
+// Test runs code through the checks the run endpoint applies, against
+// every test case, and returns the response it would give
+func (e *LocalExercise) Test(ctx context.Context, runner Runner, lang, code string) (*TestResponse, error) {
+	spec, err := e.spec(lang)
+	if err != nil {
+		return nil, err
+	}
+	if len(spec.Tests) == 0 {
+		return nil, fmt.Errorf("the exercise has no test cases")
+	}
+	if violations := spec.checkPolicy(lang, code); len(violations) > 0 {
+		return &TestResponse{Success: false, Results: []TestResult{}, ErrorType: ErrorSyntax, Diagnostics: violations}, nil
+	}
+
+	start := time.Now()
+	entry := spec.entryFor(lang, code)
+	results, err := runTests(ctx, runner, lang, code, entry, spec.Signature, spec.Tests, spec.Limits, caseHooks{})
+	if err != nil {
+		return nil, err
+	}
+	results = append(results, spec.checkConstructs(lang, code, entry)...)
+
+	passed, failed, errType := summarize(results)
+	var diags []Diagnostic
+	for _, r := range results {
+		diags = mergeDiagnostics(diags, r.diagnostics...)
+	}
+	return &TestResponse{
+		Success:     failed == 0,
+		Passed:      passed,
+		Failed:      failed,
+		Results:     results,
+		ExecutionMs: time.Since(start).Milliseconds(),
+		ErrorType:   errType,
+		Diagnostics: diags,
+	}, nil
+}
+
+// Trace runs code on one test case's input under trace mode. caseName
+// picks the case by name or ID; when empty, the first case code fails is
+// traced, or the first case when it fails none.
+func (e *LocalExercise) Trace(ctx context.Context, runner Runner, lang, code, caseName string, maxSteps int) (*TestCase, *RunResponse, error) {
+	if !canTrace(lang) {
+		return nil, nil, fmt.Errorf("tracing is only available for Python and JavaScript")
+	}
+	spec, err := e.spec(lang)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(spec.Tests) == 0 {
+		return nil, nil, fmt.Errorf("the exercise has no test cases")
+	}
+	entry := spec.entryFor(lang, code)
+
+	var tc *TestCase
+	for i := range spec.Tests {
+		if caseName != "" && (spec.Tests[i].Name == caseName || spec.Tests[i].ID == caseName) {
+			tc = &spec.Tests[i]
+			break
+		}
+	}
+	switch {
+	case caseName != "" && tc == nil:
+		return nil, nil, fmt.Errorf("no test case named %q", caseName)
+	case tc == nil:
+		tc = &spec.Tests[0]
+		results, err := runTests(ctx, runner, lang, code, entry, spec.Signature, spec.Tests, spec.Limits, caseHooks{})
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, r := range results {
+			if !r.Passed {
+				tc = &spec.Tests[i]
+				break
+			}
+		}
+	}
+
+	prog, err := traceCall(lang, code, entry, testArgs(tc.Input), caseLimits(spec.Limits, *tc))
+	if err != nil {
+		return nil, nil, err
+	}
+	toolchain, _ := lookupToolchain(lang)
+	prog, marker, err := traceProgram(prog, toolchain, maxSteps)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	start := time.Now()
+	res, err := runner.Run(ctx, prog)
+	if err != nil {
+		return nil, nil, err
+	}
+	trace := parseTrace(res, marker, spec.Limits.OutputBytes)
+	result := runResponse(res)
+	result.ExecutionMs = time.Since(start).Milliseconds()
+	result.Trace = trace
+	return tc, &result, nil
+}
@@ -0,0 +1,835 @@
+package sandbox
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Policy says what a program may use beyond the language's baseline.
+// The process sandbox is the real isolation; the policy keeps learners
+// on the exercise's intended toolbox and reports misuse with a location.
+type Policy struct {
+	AllowedImports []string // modules this exercise permits in addition to the defaults
+}
+
+// Policy rules reported in Diagnostic.Rule
+const (
+	RuleImport = "import" // module that is not permitted
+	RuleName   = "name"   // reference to a dangerous builtin or global
+	RuleMember = "member" // access to a restricted attribute or package member
+)
+
+// languagePolicy is the baseline for one language
+type languagePolicy struct {
+	defaults []string            // modules every exercise may use
+	denied   []string            // modules no exercise may use; a trailing "/" denies a whole tree
+	members  map[string][]string // module -> the only members that may be used
+}
+
+var languagePolicies = map[string]languagePolicy{
+	LangGo: {
+		defaults: []string{
+			"bufio", "bytes", "cmp", "container/heap", "container/list", "errors", "fmt",
+			"io", "maps", "math", "math/bits", "math/rand", "os", "regexp", "slices",
+			"sort", "strconv", "strings", "time", "unicode", "unicode/utf8",
+		},
+		denied: []string{
+			"C", "debug/", "internal/", "net", "net/", "os/", "plugin", "runtime/cgo",
+			"runtime/debug", "syscall", "unsafe",
+		},
+		members: map[string][]string{
+			"os": {"Args", "Exit", "Stderr", "Stdin", "Stdout"},
+		},
+	},
+	LangJavaScript: {
+		denied: []string{
+			"child_process", "cluster", "dgram", "dns", "fs", "http", "http2", "https",
+			"inspector", "module", "net", "os", "process", "repl", "tls", "v8", "vm",
+			"worker_threads",
+		},
+	},
+	LangPython: {
+		defaults: []string{
+			"abc", "array", "bisect", "cmath", "collections", "copy", "dataclasses",
+			"datetime", "decimal", "enum", "fractions", "functools", "heapq", "itertools",
+			"json", "math", "operator", "random", "re", "statistics", "string", "sys",
+			"textwrap", "time", "typing", "unicodedata",
+		},
+		denied: []string{
+			"asyncio", "builtins", "code", "codeop", "ctypes", "fcntl", "ftplib", "gc",
+			"glob", "http", "imp", "importlib", "inspect", "marshal", "mmap",
+			"multiprocessing", "os", "pathlib", "pickle", "pkgutil", "posix", "pty",
+			"resource", "runpy", "shelve", "shutil", "signal", "site", "smtplib", "socket",
+			"ssl", "subprocess", "sysconfig", "telnetlib", "tempfile", "tty", "urllib",
+			"zipimport",
+		},
+		members: map[string][]string{
+			"sys": {"argv", "exit", "getrecursionlimit", "maxsize", "setrecursionlimit", "stderr", "stdin", "stdout", "version"},
+		},
+	},
+}
+
+// checkPolicy inspects every file of a program and returns one diagnostic
+// per violation, ordered by position
+func checkPolicy(lang string, files map[string]string, policy Policy) []Diagnostic {
+	lang = dialect(lang)
+	lp := languagePolicies[lang]
+	pc := &policyCheck{lang: lang, lp: lp, policy: policy, files: files}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		pc.file = name
+		switch lang {
+		case LangGo:
+			pc.checkGo(files[name])
+		case LangJavaScript:
+			pc.checkJS(files[name])
+		case LangPython:
+			pc.checkPython(files[name])
+		}
+	}
+	return pc.violations
+}
+
+// policyCheck accumulates violations while walking a program
+type policyCheck struct {
+	lang       string
+	lp         languagePolicy
+	policy     Policy
+	files      map[string]string
+	file       string
+	violations []Diagnostic
+}
+
+func (pc *policyCheck) report(line, col int, rule, msg string) {
+	pc.violations = append(pc.violations, Diagnostic{
+		File:     pc.file,
+		Line:     line,
+		Column:   col,
+		Severity: SeverityError,
+		Message:  msg,
+		Type:     ErrorSyntax,
+		Rule:     rule,
+	})
+}
+
+// importAllowed decides whether module may be imported. Denied modules
+// stay denied even if an exercise lists them.
+func (pc *policyCheck) importAllowed(module string) bool {
+	for _, d := range pc.lp.denied {
+		if module == d || strings.HasSuffix(d, "/") && strings.HasPrefix(module, d) {
+			return false
+		}
+	}
+	for _, list := range [][]string{pc.lp.defaults, pc.policy.AllowedImports} {
+		for _, m := range list {
+			if m == module {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkImport reports module unless it is allowed or one of the
+// program's own files
+func (pc *policyCheck) checkImport(module string, line, col int) {
+	if pc.ownModule(module) || pc.importAllowed(module) {
+		return
+	}
+	pc.report(line, col, RuleImport, fmt.Sprintf("Import of %q is not allowed in this exercise", module))
+}
+
+// ownModule reports whether module refers to the program's own files
+func (pc *policyCheck) ownModule(module string) bool {
+	switch pc.lang {
+	case LangGo:
+		return module == "sandbox" || strings.HasPrefix(module, "sandbox/")
+	case LangJavaScript:
+		return strings.HasPrefix(module, "./") || strings.HasPrefix(module, "../")
+	case LangPython:
+		if strings.HasPrefix(module, ".") {
+			return true
+		}
+		rel := strings.ReplaceAll(module, ".", "/")
+		for name := range pc.files {
+			if name == rel+".py" || strings.HasPrefix(name, rel+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// memberAllowed checks a member of a module with a restricted surface
+func (pc *policyCheck) memberAllowed(module, member string) bool {
+	allowed, restricted := pc.lp.members[module]
+	if !restricted {
+		return true
+	}
+	for _, m := range allowed {
+		if m == member {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGo walks the real import set and selector expressions. Files that
+// do not parse are left to the compiler.
+func (pc *policyCheck) checkGo(code string) {
+	src := goSource(code)
+	offset := strings.Count(src, "\n") - strings.Count(code, "\n")
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, pc.file, src, parser.ParseComments)
+	if err != nil {
+		return
+	}
+	pos := func(p token.Pos) (int, int) {
+		position := fset.Position(p)
+		return position.Line - offset, position.Column
+	}
+
+	// Local names bound to restricted packages, after aliasing
+	restricted := map[string]string{}
+	for _, spec := range file.Imports {
+		module, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		line, col := pos(spec.Path.Pos())
+		pc.checkImport(module, line, col)
+
+		name := path.Base(module)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if _, ok := pc.lp.members[module]; !ok {
+			continue
+		}
+		if name == "." {
+			pc.report(line, col, RuleImport, fmt.Sprintf("Dot import of %q is not allowed", module))
+			continue
+		}
+		restricted[name] = module
+	}
+	if len(restricted) == 0 {
+		return
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		id, ok := sel.X.(*ast.Ident)
+		if !ok || id.Obj != nil {
+			// Obj is set for locals that shadow the package name
+			return true
+		}
+		if module, ok := restricted[id.Name]; ok && !pc.memberAllowed(module, sel.Sel.Name) {
+			line, col := pos(sel.Sel.Pos())
+			pc.report(line, col, RuleMember, fmt.Sprintf("%s.%s is not allowed", module, sel.Sel.Name))
+		}
+		return true
+	})
+}
+
+// JavaScript globals that reach code generation, modules, the process or
+// the network
+var jsDeniedNames = map[string]bool{
+	"Bun": true, "Deno": true, "Function": true, "SharedArrayBuffer": true,
+	"WebAssembly": true, "WebSocket": true, "Worker": true, "XMLHttpRequest": true,
+	"eval": true, "fetch": true, "global": true, "globalThis": true, "import": true,
+	"process": true, "require": true,
+}
+
+// JavaScript members that lead back to constructors or the module loader
+var jsDeniedMembers = map[string]bool{
+	"__defineGetter__": true, "__defineSetter__": true, "__proto__": true,
+	"_load": true, "binding": true, "constructor": true, "mainModule": true,
+	"require": true,
+}
+
+// checkJS applies the JavaScript rules to a lexeme stream
+func (pc *policyCheck) checkJS(code string) {
+	toks := significant(jsTokens(code))
+
+	// Top-level declarations shadow globals for the whole module
+	declared := map[string]bool{}
+	depth := 0
+	for i, t := range toks {
+		if t.kind == tokPunct && t.text == "{" {
+			depth++
+		}
+		if t.kind == tokPunct && t.text == "}" {
+			depth--
+		}
+		if depth == 0 && t.kind == tokIdent && i+1 < len(toks) && toks[i+1].kind == tokIdent {
+			switch t.text {
+			case "let", "const", "var", "function", "class":
+				declared[toks[i+1].text] = true
+			}
+		}
+	}
+
+	// scopes records, per open brace, whether it is a block, a function
+	// body or a method body. Outside every function body, arguments is the
+	// CommonJS wrapper's and arguments[1] is require; outside a method,
+	// this may be the global object.
+	var scopes []jsScope
+	inFunction := func() bool {
+		for _, s := range scopes {
+			if s != jsBlock {
+				return true
+			}
+		}
+		return false
+	}
+	inMethod := func() bool {
+		for j := len(scopes) - 1; j >= 0; j-- {
+			if scopes[j] != jsBlock {
+				return scopes[j] == jsMethod
+			}
+		}
+		return false
+	}
+
+	for i, t := range toks {
+		prev := tokenAt(toks, i-1)
+		member := prev.kind == tokPunct && (prev.text == "." || prev.text == "?.")
+
+		if t.kind == tokPunct && t.text == "{" {
+			scopes = append(scopes, jsBraceScope(toks, i))
+		}
+		if t.kind == tokPunct && t.text == "}" && len(scopes) > 0 {
+			scopes = scopes[:len(scopes)-1]
+		}
+
+		switch {
+		case t.kind == tokIdent && t.text == "arguments" && !member && !declared[t.text] && !inFunction():
+			pc.report(t.line, t.col, RuleName, "arguments is only allowed inside a function")
+		case t.kind == tokIdent && t.text == "this" && !member && !inMethod():
+			pc.report(t.line, t.col, RuleName, "this is only allowed inside a class or object method")
+		case t.kind == tokPunct && t.text == "[" && jsComputedMember(toks, i):
+			pc.checkJSIndex(toks, i)
+		case t.kind == tokIdent && member:
+			if jsDeniedMembers[t.text] {
+				pc.report(t.line, t.col, RuleMember, fmt.Sprintf("Access to .%s is not allowed", t.text))
+			}
+		case t.kind == tokString && prev.kind == tokPunct && prev.text == "[":
+			if jsDeniedMembers[t.text] {
+				pc.report(t.line, t.col, RuleMember, fmt.Sprintf("Access to [%q] is not allowed", t.text))
+			}
+		case t.kind == tokIdent && jsDeniedNames[t.text] && !declared[t.text]:
+			pc.checkJSName(toks, i)
+		}
+	}
+}
+
+// jsControlWords start statements whose parenthesized head is followed by
+// a block that is not a function body
+var jsControlWords = map[string]bool{
+	"if": true, "for": true, "while": true, "switch": true, "catch": true, "with": true,
+}
+
+// jsScope is the kind of block a brace opens
+type jsScope int
+
+const (
+	jsBlock    jsScope = iota // statement block, class or object literal, arrow function body
+	jsFunction                // function declaration or expression, which binds this to its caller
+	jsMethod                  // class or object method, constructor or accessor
+)
+
+// jsBraceScope classifies the brace at toks[i]. Function, method and
+// accessor bodies bind their own arguments; arrow function bodies do not.
+func jsBraceScope(toks []lexeme, i int) jsScope {
+	if tokenAt(toks, i-1).text != ")" {
+		return jsBlock
+	}
+	depth := 0
+	for j := i - 1; j >= 0; j-- {
+		switch toks[j].text {
+		case ")":
+			depth++
+		case "(":
+			depth--
+		}
+		if depth > 0 {
+			continue
+		}
+		before := tokenAt(toks, j-1)
+		switch {
+		case before.text == "function":
+			return jsFunction
+		case before.kind != tokIdent || jsControlWords[before.text]:
+			return jsBlock
+		}
+		// function f() and function* f() name a function; any other
+		// name before a parameter list is a method's
+		if keyword := tokenAt(toks, j-2); keyword.text == "function" ||
+			keyword.text == "*" && tokenAt(toks, j-3).text == "function" {
+			return jsFunction
+		}
+		return jsMethod
+	}
+	return jsBlock
+}
+
+// jsExpressionKeywords holds the keywords after which [ opens an array literal
+// rather than indexing the preceding expression
+var jsExpressionKeywords = map[string]bool{
+	"await": true, "case": true, "const": true, "delete": true, "do": true,
+	"else": true, "in": true, "instanceof": true, "let": true, "new": true,
+	"of": true, "return": true, "throw": true, "typeof": true, "var": true,
+	"void": true, "yield": true,
+}
+
+// jsComputedMember reports whether the bracket at toks[i] indexes the
+// expression before it, as in a[k], f()[k] or a?.[k]
+func jsComputedMember(toks []lexeme, i int) bool {
+	prev := tokenAt(toks, i-1)
+	switch prev.kind {
+	case tokIdent:
+		return !jsExpressionKeywords[prev.text]
+	case tokString, tokNumber:
+		return true
+	case tokPunct:
+		return prev.text == ")" || prev.text == "]" || prev.text == "?."
+	}
+	return false
+}
+
+// jsLocalBase reports whether the indexed expression ending before the
+// bracket at toks[i] starts from a name rather than from a literal or a
+// parenthesized expression such as an immediately invoked function
+func jsLocalBase(toks []lexeme, i int) bool {
+	for j := i - 1; j >= 0; {
+		t := toks[j]
+		switch {
+		case t.kind == tokPunct && (t.text == ")" || t.text == "]"):
+			j = jsOpening(toks, j)
+			// A group that follows nothing it could call or index is the
+			// start of the expression
+			if j < 0 || !jsComputedMember(toks, j) {
+				return false
+			}
+			j--
+		case t.kind == tokIdent:
+			before := tokenAt(toks, j-1)
+			if before.kind == tokPunct && (before.text == "." || before.text == "?.") {
+				j -= 2
+				continue
+			}
+			return true
+		case t.kind == tokPunct && t.text == "?.":
+			j--
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// jsOpening returns the index of the bracket that opens the group closed
+// at toks[j], or -1
+func jsOpening(toks []lexeme, j int) int {
+	closing := toks[j].text
+	open := map[string]string{")": "(", "]": "["}[closing]
+	for depth := 0; j >= 0; j-- {
+		if toks[j].kind != tokPunct {
+			continue
+		}
+		if toks[j].text == closing {
+			depth++
+		}
+		if toks[j].text == open {
+			if depth--; depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// jsIndexPunct holds the operators an index expression may combine names
+// and numbers with
+var jsIndexPunct = map[string]bool{
+	"(": true, ")": true, "[": true, "]": true, ".": true, "?.": true,
+	"-": true, "*": true, "/": true, "%": true, "+": true,
+	"&": true, "|": true, "^": true, "~": true, "<<": true, ">>": true, ">>>": true,
+}
+
+// checkJSIndex handles the computed member access opening at toks[i]. A
+// single string literal names the member and is checked like .name; any
+// other key must be arithmetic on names and numbers, indexing a value
+// reached from a name, so member names cannot be assembled from string
+// pieces.
+func (pc *policyCheck) checkJSIndex(toks []lexeme, i int) {
+	end := i + 1
+	for depth := 1; end < len(toks); end++ {
+		if toks[end].kind != tokPunct {
+			continue
+		}
+		if toks[end].text == "[" {
+			depth++
+		}
+		if toks[end].text == "]" {
+			if depth--; depth == 0 {
+				break
+			}
+		}
+	}
+	key := toks[i+1 : end]
+	if len(key) == 1 && (key[0].kind == tokString || key[0].kind == tokNumber) {
+		return
+	}
+
+	at := toks[i]
+	if !jsLocalBase(toks, i) {
+		pc.report(at.line, at.col, RuleMember, "Only literal keys may index this expression")
+		return
+	}
+	for _, t := range key {
+		ok := false
+		switch t.kind {
+		case tokNumber:
+			ok = true
+		case tokIdent:
+			ok = !jsExpressionKeywords[t.text]
+		case tokPunct:
+			ok = jsIndexPunct[t.text]
+		}
+		if !ok {
+			pc.report(at.line, at.col, RuleMember, "Computed member names must be a string literal or arithmetic on variables and numbers")
+			return
+		}
+	}
+}
+
+// checkJSName handles a reference to a denied global, permitting the
+// narrow forms that programs legitimately need
+func (pc *policyCheck) checkJSName(toks []lexeme, i int) {
+	t := toks[i]
+	next, after := tokenAt(toks, i+1), tokenAt(toks, i+2)
+
+	switch t.text {
+	case "process":
+		// Standard streams for reading input and writing output
+		if next.text == "." && after.kind == tokIdent {
+			switch after.text {
+			case "stdin", "stdout", "stderr":
+				return
+			}
+		}
+	case "require":
+		if next.text == "(" && after.kind == tokString && tokenAt(toks, i+3).text == ")" {
+			pc.checkImport(strings.TrimPrefix(after.text, "node:"), after.line, after.col)
+			return
+		}
+	case "import":
+		if next.text == "(" {
+			// import('m')
+			if after.kind == tokString && tokenAt(toks, i+3).text == ")" {
+				pc.checkImport(strings.TrimPrefix(after.text, "node:"), after.line, after.col)
+				return
+			}
+			break
+		}
+		// import x from 'm' and import 'm'
+		for j := i + 1; j < len(toks) && toks[j].text != ";"; j++ {
+			if toks[j].kind == tokString {
+				pc.checkImport(strings.TrimPrefix(toks[j].text, "node:"), toks[j].line, toks[j].col)
+				return
+			}
+		}
+	}
+	pc.report(t.line, t.col, RuleName, fmt.Sprintf("%s is not allowed", t.text))
+}
+
+// Python builtins that evaluate code, open files or expose interpreter
+// internals
+var pyDeniedNames = map[string]bool{
+	"__builtins__": true, "__import__": true, "__loader__": true, "__spec__": true,
+	"breakpoint": true, "compile": true, "eval": true, "exec": true, "globals": true,
+	"locals": true, "open": true, "vars": true,
+}
+
+// Python attributes used to climb from an object to its interpreter
+var pyDeniedAttrs = map[string]bool{
+	"__base__": true, "__bases__": true, "__builtins__": true, "__class__": true,
+	"__closure__": true, "__code__": true, "__dict__": true, "__func__": true,
+	"__getattribute__": true, "__globals__": true, "__import__": true,
+	"__loader__": true, "__mro__": true, "__self__": true, "__subclasses__": true,
+	"f_back": true, "f_builtins": true, "f_globals": true, "gi_frame": true,
+	"tb_frame": true,
+}
+
+// Python calls that look attributes up by name, and the argument that must
+// be a plain string literal so the name can be checked; -1 means every
+// argument
+var pyNameCalls = map[string]int{
+	"delattr": 1, "getattr": 1, "hasattr": 1, "setattr": 1,
+	"attrgetter": -1, "methodcaller": 0,
+}
+
+// pyIsNameCall reports whether name is one of pyNameCalls
+func pyIsNameCall(name string) bool {
+	_, ok := pyNameCalls[name]
+	return ok
+}
+
+// pyModuleAttrAllowed checks an attribute of an imported module. Modules
+// re-export others under their own names (random._os, typing.sys), which
+// would sidestep the import rules, so private names and names of denied
+// or restricted modules are refused.
+func (pc *policyCheck) pyModuleAttrAllowed(attr string) bool {
+	if strings.HasPrefix(attr, "_") {
+		return false
+	}
+	if _, ok := pc.lp.members[attr]; ok {
+		return false
+	}
+	for _, d := range pc.lp.denied {
+		if attr == strings.TrimSuffix(d, "/") {
+			return false
+		}
+	}
+	return true
+}
+
+// pyLiteralName reports whether the arguments of the call opening at
+// toks[open] that pyNameCalls names are single string literals
+func pyLiteralName(toks []lexeme, open, index int) bool {
+	var args [][]lexeme
+	var arg []lexeme
+	depth := 0
+	for j := open + 1; j < len(toks); j++ {
+		t := toks[j]
+		if t.kind == tokPunct {
+			switch t.text {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				if depth == 0 {
+					args = append(args, arg)
+					goto done
+				}
+				depth--
+			case ",":
+				if depth == 0 {
+					args = append(args, arg)
+					arg = nil
+					continue
+				}
+			}
+		}
+		arg = append(arg, t)
+	}
+done:
+	literal := func(a []lexeme) bool { return len(a) == 1 && a[0].kind == tokString }
+	if index >= 0 {
+		return index < len(args) && literal(args[index])
+	}
+	for _, a := range args {
+		if len(a) > 0 && !literal(a) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPython applies the Python rules to a lexeme stream
+func (pc *policyCheck) checkPython(code string) {
+	toks := significant(pyTokens(code))
+
+	// Local names bound to modules by import statements, and the subset
+	// bound to restricted modules
+	modules := map[string]string{}
+	restricted := map[string]string{}
+
+	// Module-level definitions shadow builtins for the whole file
+	defined := map[string]bool{}
+	for i, t := range toks {
+		if t.kind != tokIdent {
+			continue
+		}
+		if t.text == "def" || t.text == "class" {
+			if name := tokenAt(toks, i+1); name.kind == tokIdent && t.col == 1 {
+				defined[name.text] = true
+			}
+		}
+		if t.col == 1 && tokenAt(toks, i+1).text == "=" && tokenAt(toks, i+2).text != "=" {
+			defined[t.text] = true
+		}
+	}
+
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		prev := tokenAt(toks, i-1)
+		stmtStart := i == 0 || prev.kind == tokNewline || prev.text == ";" || prev.text == ":"
+		member := prev.kind == tokPunct && prev.text == "."
+
+		switch {
+		case t.kind == tokIdent && t.text == "import" && stmtStart:
+			i = pc.pyImport(toks, i+1, modules, restricted)
+		case t.kind == tokIdent && t.text == "from" && stmtStart:
+			i = pc.pyFromImport(toks, i+1)
+		case t.kind == tokIdent && pyIsNameCall(t.text) && !defined[t.text]:
+			if tokenAt(toks, i+1).text != "(" || !pyLiteralName(toks, i+1, pyNameCalls[t.text]) {
+				pc.report(t.line, t.col, RuleName, fmt.Sprintf("%s needs the attribute name as a string literal", t.text))
+			}
+		case t.kind == tokIdent && member:
+			if pyDeniedAttrs[t.text] {
+				pc.report(t.line, t.col, RuleMember, fmt.Sprintf("Access to .%s is not allowed", t.text))
+				continue
+			}
+			// The root of a chain such as typing.sys.modules
+			root := i - 2
+			for tokenAt(toks, root).kind == tokIdent && tokenAt(toks, root-1).text == "." {
+				root -= 2
+			}
+			if module, ok := modules[tokenAt(toks, root).text]; ok && tokenAt(toks, root).kind == tokIdent &&
+				!pc.ownModule(module) && !pc.pyModuleAttrAllowed(t.text) {
+				pc.report(t.line, t.col, RuleMember, fmt.Sprintf("%s.%s is not allowed", module, t.text))
+				continue
+			}
+			owner := tokenAt(toks, i-2)
+			if module, ok := restricted[owner.text]; ok && owner.kind == tokIdent && tokenAt(toks, i-3).text != "." &&
+				!pc.memberAllowed(module, t.text) {
+				pc.report(t.line, t.col, RuleMember, fmt.Sprintf("%s.%s is not allowed", module, t.text))
+			}
+		case t.kind == tokIdent && pyDeniedNames[t.text] && !defined[t.text]:
+			pc.report(t.line, t.col, RuleName, fmt.Sprintf("%s is not allowed", t.text))
+		case t.kind == tokString:
+			// getattr(obj, "__class__") and attrgetter("__class__.__mro__")
+			for _, part := range strings.Split(t.text, ".") {
+				if pyDeniedAttrs[part] {
+					pc.report(t.line, t.col, RuleMember, fmt.Sprintf("Access to %s is not allowed", part))
+					break
+				}
+			}
+		}
+	}
+}
+
+// pyImport checks `import a.b as c, d` starting at toks[i] and returns
+// the index of the statement's last lexeme
+func (pc *policyCheck) pyImport(toks []lexeme, i int, modules, restricted map[string]string) int {
+	for i < len(toks) {
+		module, start, next := pyDottedName(toks, i)
+		if module == "" {
+			return i - 1
+		}
+		pc.checkImport(module, start.line, start.col)
+		local := strings.SplitN(module, ".", 2)[0]
+		if tokenAt(toks, next).text == "as" {
+			local = tokenAt(toks, next+1).text
+			next += 2
+		}
+		modules[local] = module
+		if _, ok := pc.lp.members[module]; ok {
+			restricted[local] = module
+		}
+		if tokenAt(toks, next).text != "," {
+			return next - 1
+		}
+		i = next + 1
+	}
+	return i
+}
+
+// pyFromImport checks `from a.b import c, d` starting at toks[i]
+func (pc *policyCheck) pyFromImport(toks []lexeme, i int) int {
+	// Relative imports name the program's own modules
+	relative := ""
+	for tokenAt(toks, i).text == "." {
+		relative += "."
+		i++
+	}
+	module, start, next := pyDottedName(toks, i)
+	if module == "" && relative == "" {
+		return i - 1
+	}
+	if relative != "" {
+		return next - 1
+	}
+	pc.checkImport(module, start.line, start.col)
+	if tokenAt(toks, next).text != "import" {
+		return next - 1
+	}
+
+	j := next + 1
+	for ; j < len(toks) && toks[j].kind != tokNewline && toks[j].text != ";"; j++ {
+		t := toks[j]
+		if t.kind != tokIdent || t.text == "as" || tokenAt(toks, j-1).text == "as" {
+			continue
+		}
+		if !pc.memberAllowed(module, t.text) || !pc.ownModule(module) && !pc.pyModuleAttrAllowed(t.text) {
+			pc.report(t.line, t.col, RuleMember, fmt.Sprintf("%s.%s is not allowed", module, t.text))
+		}
+	}
+	if _, ok := pc.lp.members[module]; ok && tokenAt(toks, next+1).text == "*" {
+		t := toks[next+1]
+		pc.report(t.line, t.col, RuleImport, fmt.Sprintf("from %s import * is not allowed", module))
+	}
+	return j - 1
+}
+
+// pyDottedName reads a.b.c starting at toks[i]
+func pyDottedName(toks []lexeme, i int) (string, lexeme, int) {
+	start := tokenAt(toks, i)
+	var parts []string
+	for tokenAt(toks, i).kind == tokIdent {
+		parts = append(parts, toks[i].text)
+		if tokenAt(toks, i+1).text != "." {
+			i++
+			break
+		}
+		i += 2
+	}
+	return strings.Join(parts, "."), start, i
+}
+
+// significant drops comments from a lexeme stream
+func significant(toks []lexeme) []lexeme {
+	out := toks[:0:0]
+	for _, t := range toks {
+		if t.kind != tokComment {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// tokenAt returns toks[i], or an empty punctuation lexeme when out of range
+func tokenAt(toks []lexeme, i int) lexeme {
+	if i < 0 || i >= len(toks) {
+		return lexeme{kind: tokPunct}
+	}
+	return toks[i]
+}
+
+// policyError summarizes violations for the response's error message
+func policyError(violations []Diagnostic) string {
+	msg := "Security violation: " + violations[0].Message
+	if violations[0].Line > 0 {
+		msg = fmt.Sprintf("Security violation on line %d: %s", violations[0].Line, violations[0].Message)
+	}
+	if len(violations) > 1 {
+		msg += fmt.Sprintf(" (and %d more)", len(violations)-1)
+	}
+	return msg
+}
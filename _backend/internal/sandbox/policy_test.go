@@ -0,0 +1,66 @@
+package sandbox
+
+import "testing"
+
+var mainFiles = map[string]string{LangGo: "main.go", LangJavaScript: "main.js", LangPython: "main.py"}
+
+func TestCheckPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		lang string
+		code string
+		rule string // expected rule of the first violation, empty when allowed
+	}{
+		{"js require", LangJavaScript, `require("child_process")`, RuleImport},
+		{"js arguments at module scope", LangJavaScript, `arguments[1]('child_process').execSync('id')`, RuleName},
+		{"js arguments in arrow at module scope", LangJavaScript, `const f = () => { return arguments[1] }`, RuleName},
+		{"js arguments in if block", LangJavaScript, `if (true) { arguments[1]('fs') }`, RuleName},
+		{"js arguments in function", LangJavaScript, `function sum() { let s = 0; for (const x of arguments) { s += x } return s }`, ""},
+		{"js arguments in method", LangJavaScript, `class A { sum(a, b) { return arguments.length } }`, ""},
+		{"js arguments in nested arrow", LangJavaScript, `function f() { return () => { return arguments[0] } }`, ""},
+		{"js concatenated members of unbound this", LangJavaScript, `(function(){return this})()["pro"+"cess"]["main"+"Module"]["req"+"uire"]("f"+"s").readFileSync("/etc/passwd")`, RuleName},
+		{"js concatenated member", LangJavaScript, `const xs = []; xs["constr" + "uctor"]`, RuleMember},
+		{"js template member", LangJavaScript, "const xs = []; xs[`constr${'uctor'}`]", RuleMember},
+		{"js index into call result", LangJavaScript, `(() => [])()[k]`, RuleMember},
+		{"js this at module scope", LangJavaScript, `this.x = 1`, RuleName},
+		{"js this in function", LangJavaScript, `function f() { return this }`, RuleName},
+		{"js this in method", LangJavaScript, `class Stack { push(x) { this.items[this.items.length] = x } }`, ""},
+		{"js this in arrow inside method", LangJavaScript, `const o = { get n() { return [1].map(() => this.k) } }`, ""},
+		{"js arithmetic indexes", LangJavaScript, `function f(a, dp, i, j) { return a[i] + a[0] + dp[i - 1][j + 1] + a[a.length - 1] + a[Math.floor((i + j) / 2)] + a?.[i] }`, ""},
+		{"js literal key", LangJavaScript, `const o = {}; o["name"] = "x"; const [a, b] = [1, 2]`, ""},
+		{"js plain code", LangJavaScript, `const xs = [3, 1, 2].sort((a, b) => a - b); console.log(xs)`, ""},
+
+		{"py os import", LangPython, "import os\n", RuleImport},
+		{"py private module attribute", LangPython, "import random\nrandom._os.system('id')\n", RuleMember},
+		{"py re-exported module", LangPython, "import typing\ntyping.sys.modules['os']\n", RuleMember},
+		{"py aliased re-export", LangPython, "import random as r\nr._inst\n", RuleMember},
+		{"py from-import private", LangPython, "from random import _os\n", RuleMember},
+		{"py from-import module", LangPython, "from typing import sys\n", RuleMember},
+		{"py getattr concatenated name", LangPython, "getattr((), '__cl' + '__ass__')\n", RuleName},
+		{"py getattr variable name", LangPython, "name = 'x'\ngetattr(object, name)\n", RuleName},
+		{"py getattr alias", LangPython, "g = getattr\n", RuleName},
+		{"py getattr dunder literal", LangPython, "getattr((), '__class__')\n", RuleMember},
+		{"py attrgetter dotted dunder", LangPython, "import operator\noperator.attrgetter('x.__class__')\n", RuleMember},
+		{"py setattr computed", LangPython, "setattr(o, 'a' + 'b', 1)\n", RuleName},
+		{"py __import__", LangPython, "__import__('os')\n", RuleName},
+		{"py getattr literal", LangPython, "getattr(point, 'x', 0)\n", ""},
+		{"py module members", LangPython, "import collections\nimport sys\nc = collections.Counter('abc')\nsys.stdout.write('x')\n", ""},
+		{"py shadowed getattr", LangPython, "def getattr(o, n):\n    return n\ngetattr(1, 'a' + 'b')\n", ""},
+
+		{"go os member", LangGo, "package main\n\nimport \"os\"\n\nfunc main() { os.Remove(\"x\") }\n", RuleMember},
+		{"go allowed", LangGo, "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(1) }\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diags := checkPolicy(tt.lang, map[string]string{mainFiles[tt.lang]: tt.code}, Policy{})
+			switch {
+			case tt.rule == "" && len(diags) > 0:
+				t.Errorf("unexpected violation: %+v", diags[0])
+			case tt.rule != "" && len(diags) == 0:
+				t.Errorf("no violation, want rule %q", tt.rule)
+			case tt.rule != "" && diags[0].Rule != tt.rule:
+				t.Errorf("first violation %+v, want rule %q", diags[0], tt.rule)
+			}
+		})
+	}
+}
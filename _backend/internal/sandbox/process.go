@@ -0,0 +1,435 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProcessConfig configures the subprocess runner
+type ProcessConfig struct {
+	WorkDir       string // parent directory for per-run scratch directories
+	CacheDir      string // toolchain caches (GOCACHE), shared between runs
+	UID           int    // dedicated unprivileged account programs and compilers run as
+	GID           int
+	CompileLimits Limits
+	BuildCacheMax int64 // bytes of compiled programs kept in CacheDir; 0 disables the build cache
+
+	// Isolated commands run in an empty root holding only ReadPaths,
+	// read-only, and the runtime their command belongs to. Hide covers
+	// directories even when a read path holds them, such as the database's.
+	ReadPaths []string
+	Hide      []string
+
+	// Unisolated runs programs as the server's own user with resource
+	// limits only. It is meant for development machines; without it the
+	// runner refuses to start unless it can isolate programs.
+	Unisolated bool
+}
+
+// DefaultProcessConfig returns a config rooted in the system temp directory
+func DefaultProcessConfig() ProcessConfig {
+	base := filepath.Join(os.TempDir(), "pp-sandbox")
+	return ProcessConfig{
+		WorkDir:       filepath.Join(base, "work"),
+		CacheDir:      filepath.Join(base, "cache"),
+		UID:           -1,
+		GID:           -1,
+		CompileLimits: DefaultCompileLimits(),
+		BuildCacheMax: 256 << 20,
+		ReadPaths:     systemReadPaths,
+	}
+}
+
+// systemReadPaths hold the shared libraries and system files runtimes
+// load. Missing ones are skipped.
+var systemReadPaths = []string{
+	"/bin", "/sbin", "/lib", "/lib32", "/lib64", "/usr",
+	"/etc/alternatives", "/etc/ld.so.cache", "/etc/ld.so.conf", "/etc/ld.so.conf.d", "/etc/localtime",
+}
+
+// ProcessRunner executes programs as local subprocesses, one throwaway
+// work directory per run
+type ProcessRunner struct {
+	cfg    ProcessConfig
+	builds *buildCache // nil when disabled
+}
+
+// NewProcessRunner creates a subprocess runner and its working
+// directories. It fails unless programs can run as cfg.UID in their own
+// namespaces, or cfg.Unisolated allows running them without.
+func NewProcessRunner(cfg ProcessConfig) (*ProcessRunner, error) {
+	cfg.CompileLimits = cfg.CompileLimits.orDefaults(DefaultCompileLimits())
+	var err error
+	if cfg.WorkDir, err = filepath.Abs(cfg.WorkDir); err != nil {
+		return nil, err
+	}
+	if cfg.CacheDir, err = filepath.Abs(cfg.CacheDir); err != nil {
+		return nil, err
+	}
+
+	// Run directories are not listable, so runs cannot find each other
+	for dir, mode := range map[string]os.FileMode{cfg.WorkDir: 0711, cfg.CacheDir: 0755} {
+		if err := os.MkdirAll(dir, mode); err != nil {
+			return nil, fmt.Errorf("failed to create sandbox directory: %w", err)
+		}
+		if err := os.Chmod(dir, mode); err != nil {
+			return nil, fmt.Errorf("failed to prepare sandbox directory: %w", err)
+		}
+	}
+	if !cfg.Unisolated {
+		if err := checkIsolation(cfg); err != nil {
+			return nil, fmt.Errorf("cannot isolate programs: %w", err)
+		}
+		// Compilers run as the sandbox account and keep their caches here
+		for _, dir := range toolchainCaches(cfg) {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, fmt.Errorf("failed to create sandbox directory: %w", err)
+			}
+			if err := os.Chown(dir, cfg.UID, cfg.GID); err != nil {
+				return nil, fmt.Errorf("failed to prepare sandbox directory: %w", err)
+			}
+		}
+	}
+	p := &ProcessRunner{cfg: cfg}
+	if cfg.BuildCacheMax > 0 {
+		builds, err := newBuildCache(filepath.Join(cfg.CacheDir, "builds"), cfg.BuildCacheMax)
+		if err != nil {
+			return nil, err
+		}
+		p.builds = builds
+	}
+	return p, nil
+}
+
+// BuildCacheStats reports the build cache's counters
+func (p *ProcessRunner) BuildCacheStats() (BuildCacheStats, bool) {
+	if p.builds == nil {
+		return BuildCacheStats{}, false
+	}
+	return p.builds.Stats(), true
+}
+
+// Run writes prog to a fresh directory, compiles it if the language needs
+// it, and executes it under prog.Limits
+func (p *ProcessRunner) Run(ctx context.Context, prog Program) (*Result, error) {
+	tc, ok := lookupToolchain(prog.Language)
+	if !ok {
+		return nil, fmt.Errorf("unsupported language: %s", prog.Language)
+	}
+
+	dir, err := os.MkdirTemp(p.cfg.WorkDir, "run-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create work directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Only the sandbox account may enter the run's directory. The sources
+	// stay owned by the server, so programs cannot change them in place.
+	if !p.cfg.Unisolated {
+		if err := os.Chown(dir, p.cfg.UID, p.cfg.GID); err != nil {
+			return nil, fmt.Errorf("failed to prepare work directory: %w", err)
+		}
+	}
+	if err := writeFiles(dir, tc.Support); err != nil {
+		return nil, err
+	}
+	if err := writeFiles(dir, prog.Files); err != nil {
+		return nil, err
+	}
+
+	// Limits the program leaves unset come from its language
+	limits := prog.Limits.orDefaults(tc.limits())
+	entry := prog.Entry
+	if entry == "" {
+		entry = tc.MainFile
+	}
+
+	start := time.Now()
+	env := append(p.baseEnv(dir), tc.Env...)
+
+	if len(tc.Compile) > 0 {
+		res, err := p.compile(ctx, dir, tc, prog.Files, env)
+		if err != nil {
+			return nil, err
+		}
+		if res != nil {
+			res.Stage = StageCompile
+			res.Duration = time.Since(start)
+			return res, nil
+		}
+	}
+
+	res, err := p.exec(ctx, dir, step{
+		argv:      tc.runCommand(entry),
+		env:       append(env, prog.Env...),
+		limits:    limits,
+		sandboxed: true,
+		stdin:     prog.Stdin,
+		onOutput:  prog.OnOutput,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res.Stage = StageRun
+	res.Duration = time.Since(start)
+	return res, nil
+}
+
+// toolchainCaches are the directories in CacheDir that compilers write
+func toolchainCaches(cfg ProcessConfig) []string {
+	return []string{filepath.Join(cfg.CacheDir, "go-build"), filepath.Join(cfg.CacheDir, "gopath")}
+}
+
+// compile builds the program in dir, or restores an identical earlier
+// build. It returns the compiler's result only when the build failed.
+func (p *ProcessRunner) compile(ctx context.Context, dir string, tc Toolchain, files map[string]string, env []string) (*Result, error) {
+	caches := toolchainCaches(p.cfg)
+	env = append(env, "GOCACHE="+caches[0], "GOPATH="+caches[1])
+
+	key := ""
+	if p.builds != nil && len(tc.Artifacts) > 0 {
+		if version, err := p.builds.version(ctx, p, dir, tc, env); err != nil {
+			log.Printf("Not caching %s builds: %v", tc.Language, err)
+		} else {
+			key = p.builds.key(tc, version, files)
+		}
+	}
+	if key != "" && p.builds.restore(key, dir, tc.Artifacts) {
+		return nil, nil
+	}
+
+	// The compiler works on learner code, so it is isolated like the
+	// program, with its caches in view
+	res, err := p.exec(ctx, dir, step{argv: tc.Compile, env: env, limits: p.cfg.CompileLimits, sandboxed: true, keep: caches})
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 || res.TimedOut || res.Truncated {
+		return res, nil
+	}
+	if key != "" {
+		if err := p.builds.store(key, dir, tc.Artifacts); err != nil {
+			log.Printf("Failed to cache %s build: %v", tc.Language, err)
+		}
+	}
+	return nil, nil
+}
+
+// baseEnv is the minimal environment every sandboxed command receives
+func (p *ProcessRunner) baseEnv(dir string) []string {
+	return []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + dir,
+		"LANG=C.UTF-8",
+	}
+}
+
+// step is one command run by the process runner. sandboxed commands drop
+// privileges and are isolated; toolchain steps only get resource limits.
+type step struct {
+	argv      []string
+	env       []string
+	limits    Limits
+	sandboxed bool
+	keep      []string // directories a sandboxed command sees besides its own
+	stdin     string
+	onOutput  func(stream string, data []byte) // sees output as it arrives, up to the output limit
+}
+
+// exec runs one step to completion
+func (p *ProcessRunner) exec(parent context.Context, dir string, s step) (*Result, error) {
+	argv, limits := s.argv, s.limits
+	path, err := resolveCommand(dir, argv[0])
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(parent, limits.WallTime)
+	defer cancel()
+
+	iso := p.isolation(dir, path, s)
+	cmd := newCommand(ctx, limits, iso, path, argv[1:])
+	cmd.Dir = dir
+	cmd.Env = s.env
+	cmd.WaitDelay = time.Second
+	isolate(cmd, iso)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	if s.stdin != "" {
+		cmd.Stdin = strings.NewReader(s.stdin)
+	}
+
+	stdout := &cappedBuffer{limit: limits.OutputBytes, onOverflow: cancel}
+	stderr := &cappedBuffer{limit: limits.OutputBytes, onOverflow: cancel}
+	if s.onOutput != nil {
+		stdout.onWrite = func(b []byte) { s.onOutput(StreamStdout, b) }
+		stderr.onWrite = func(b []byte) { s.onOutput(StreamStderr, b) }
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	start := time.Now()
+	runErr := cmd.Run()
+
+	if parent.Err() != nil {
+		return nil, parent.Err()
+	}
+
+	res := &Result{
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.Overflowed() || stderr.Overflowed(),
+		Duration:  time.Since(start),
+	}
+
+	if cmd.ProcessState == nil {
+		return nil, fmt.Errorf("failed to start %s: %w", argv[0], runErr)
+	}
+
+	res.ExitCode = cmd.ProcessState.ExitCode()
+	sig, cpuLimit := exitSignal(cmd.ProcessState)
+	res.Signal = sig
+	if cpuLimit || (errors.Is(ctx.Err(), context.DeadlineExceeded) && !res.Truncated) {
+		res.TimedOut = true
+	}
+	return res, nil
+}
+
+// isolation describes the private view of the system an isolated command
+// gets: an empty root with the read directories mounted read-only, the
+// hide directories covered by empty ones and the keep directories, its
+// own among them, writable. /tmp and /proc are private.
+type isolation struct {
+	uid, gid int
+	read     []string
+	hide     []string
+	keep     []string
+}
+
+// isolation returns how to isolate a step that runs the command at path
+// in dir, nil when it runs unisolated. Other runs, the server's caches and
+// its data are out of sight.
+func (p *ProcessRunner) isolation(dir, path string, s step) *isolation {
+	if !s.sandboxed || p.cfg.Unisolated {
+		return nil
+	}
+	read := append([]string{}, p.cfg.ReadPaths...)
+	if root := runtimeRoot(path); root != "" && !withinDir(root, p.cfg.WorkDir) {
+		read = append(read, root)
+	}
+	return &isolation{
+		uid:  p.cfg.UID,
+		gid:  p.cfg.GID,
+		read: read,
+		hide: append([]string{p.cfg.WorkDir, p.cfg.CacheDir}, p.cfg.Hide...),
+		keep: append([]string{dir}, s.keep...),
+	}
+}
+
+// runtimeRoot is the installation a command belongs to: the directory
+// above bin for /usr/local/go/bin/go, or the command's own directory
+func runtimeRoot(path string) string {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return ""
+	}
+	dir := filepath.Dir(real)
+	if filepath.Base(dir) == "bin" {
+		dir = filepath.Dir(dir)
+	}
+	if dir == "/" {
+		return ""
+	}
+	return dir
+}
+
+// withinDir reports whether path is dir or inside it
+func withinDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// resolveCommand finds the executable for a toolchain command
+func resolveCommand(dir, name string) (string, error) {
+	if strings.HasPrefix(name, "./") {
+		return filepath.Join(dir, name), nil
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("runtime %q is not installed: %w", name, err)
+	}
+	return path, nil
+}
+
+// writeFiles materializes a file map inside dir, rejecting paths that
+// would escape it
+func writeFiles(dir string, files map[string]string) error {
+	for name, content := range files {
+		clean := filepath.Clean(filepath.FromSlash(name))
+		if clean == "." || filepath.IsAbs(clean) || strings.HasPrefix(clean, "..") {
+			return fmt.Errorf("invalid file name: %s", name)
+		}
+		path := filepath.Join(dir, clean)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// cappedBuffer collects output up to a limit and reports the first overflow
+type cappedBuffer struct {
+	mu         sync.Mutex
+	buf        bytes.Buffer
+	limit      int
+	overflowed bool
+	onOverflow func()
+	onWrite    func([]byte) // sees every accepted chunk
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.overflowed {
+		return len(p), nil
+	}
+	n := len(p)
+	if b.limit > 0 && b.buf.Len()+len(p) > b.limit {
+		p = p[:b.limit-b.buf.Len()]
+		b.overflowed = true
+	}
+	b.buf.Write(p)
+	if b.onWrite != nil && len(p) > 0 {
+		b.onWrite(p)
+	}
+	if b.overflowed && b.onOverflow != nil {
+		b.onOverflow()
+	}
+	return n, nil
+}
+
+func (b *cappedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// Overflowed reports whether output was cut off
+func (b *cappedBuffer) Overflowed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.overflowed
+}
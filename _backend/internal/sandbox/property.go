@@ -0,0 +1,555 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Property test bounds
+const (
+	defaultPropertyCases = 50
+	maxPropertyCases     = 200
+	maxSchemaLength      = 1000 // longest array or string a schema may ask for
+	maxSchemaDepth       = 4
+	maxShrinkRounds      = 40
+	maxShrinkCandidates  = 40
+	propertyTimeout      = 10 * time.Second // one process running a whole batch
+	propertyOutputBytes  = 512 << 10        // envelopes for a whole batch
+	propertyBudget       = 30 * time.Second // generation plus shrinking
+)
+
+// Value types an input schema can describe
+const (
+	SchemaInt    = "int"
+	SchemaFloat  = "float"
+	SchemaBool   = "bool"
+	SchemaString = "string"
+	SchemaArray  = "array"
+)
+
+// InputSchema describes the arguments of an exercise's entry point so the
+// grader can generate random cases and compare the learner's results with
+// the reference solution's. A zero Seed draws a new one on every run. A
+// nil Checker reuses the exercise's test case checker.
+type InputSchema struct {
+	Args    []ValueSchema `json:"args"`
+	Cases   int           `json:"cases,omitempty"`
+	Seed    int64         `json:"seed,omitempty"`
+	Checker *Checker      `json:"-"`
+}
+
+// ValueSchema describes one random value. Min and Max bound an int or
+// float's value, and an array or string's length.
+type ValueSchema struct {
+	Type     string       `json:"type"`
+	Min      *float64     `json:"min,omitempty"`
+	Max      *float64     `json:"max,omitempty"`
+	Items    *ValueSchema `json:"items,omitempty"`    // array elements
+	Alphabet string       `json:"alphabet,omitempty"` // string characters
+}
+
+// ParseInputSchema decodes and validates an input schema
+func ParseInputSchema(raw []byte) (*InputSchema, error) {
+	var decoded struct {
+		InputSchema
+		Checker json.RawMessage `json:"checker"`
+	}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, fmt.Errorf("invalid input schema: %w", err)
+	}
+	s := decoded.InputSchema
+	if len(decoded.Checker) > 0 && string(decoded.Checker) != "null" {
+		checker, err := ParseChecker(decoded.Checker)
+		if err != nil {
+			return nil, err
+		}
+		if !checker.comparesValues() {
+			return nil, errors.New("input schema checker must compare returned values")
+		}
+		s.Checker = checker
+	}
+	if len(s.Args) == 0 {
+		return nil, errors.New("input schema has no arguments")
+	}
+	if s.Cases < 0 || s.Cases > maxPropertyCases {
+		return nil, fmt.Errorf("input schema cases must be between 1 and %d", maxPropertyCases)
+	}
+	for i := range s.Args {
+		if err := s.Args[i].validate(0); err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+	}
+	return &s, nil
+}
+
+func (v *ValueSchema) validate(depth int) error {
+	if depth > maxSchemaDepth {
+		return errors.New("schema is nested too deeply")
+	}
+	if v.Min != nil && v.Max != nil && *v.Max < *v.Min {
+		return fmt.Errorf("%s max is below min", v.Type)
+	}
+	switch v.Type {
+	case SchemaInt:
+		if lo, hi := v.intBounds(); hi < lo {
+			return errors.New("int range holds no integers")
+		}
+		return nil
+	case SchemaFloat, SchemaBool:
+		return nil
+	case SchemaString, SchemaArray:
+		if lo, hi := v.lengthBounds(); lo < 0 || hi > maxSchemaLength {
+			return fmt.Errorf("%s length must be between 0 and %d", v.Type, maxSchemaLength)
+		}
+		if v.Type == SchemaString {
+			return nil
+		}
+		if v.Items == nil {
+			return errors.New("array has no items schema")
+		}
+		return v.Items.validate(depth + 1)
+	}
+	return fmt.Errorf("unknown type %q", v.Type)
+}
+
+// bounds returns Min and Max. A missing bound defaults to the given one,
+// or to the other bound shifted by the default range's width when that
+// would be out of order.
+func (v *ValueSchema) bounds(lo, hi float64) (float64, float64) {
+	width := hi - lo
+	if v.Min != nil {
+		lo = *v.Min
+		if v.Max == nil && hi < lo {
+			hi = lo + width
+		}
+	}
+	if v.Max != nil {
+		hi = *v.Max
+		if v.Min == nil && lo > hi {
+			lo = hi - width
+		}
+	}
+	return lo, hi
+}
+
+// intBounds are an int schema's bounds, defaulting to a small range
+// around zero
+func (v *ValueSchema) intBounds() (int, int) {
+	lo, hi := v.bounds(-1000, 1000)
+	return int(math.Ceil(lo)), int(math.Floor(hi))
+}
+
+// lengthBounds are an array or string schema's length bounds
+func (v *ValueSchema) lengthBounds() (int, int) {
+	lo, hi := v.bounds(0, 20)
+	return int(lo), int(hi)
+}
+
+func (v *ValueSchema) generate(rng *rand.Rand) interface{} {
+	// One value in four is picked from the edges of its range, where
+	// hand-written cases are usually missing
+	edge := rng.Intn(4) == 0
+	switch v.Type {
+	case SchemaInt:
+		lo, hi := v.intBounds()
+		if edge {
+			return pick(rng, lo, hi, clamp(0, lo, hi), clamp(-1, lo, hi), clamp(1, lo, hi))
+		}
+		return lo + rng.Intn(hi-lo+1)
+	case SchemaFloat:
+		lo, hi := v.bounds(-1000, 1000)
+		if edge {
+			return pick(rng, lo, hi, math.Max(lo, math.Min(0, hi)))
+		}
+		return lo + rng.Float64()*(hi-lo)
+	case SchemaBool:
+		return rng.Intn(2) == 0
+	case SchemaString:
+		n := v.randomLength(rng, edge)
+		alphabet := []rune(v.alphabet())
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			b.WriteRune(alphabet[rng.Intn(len(alphabet))])
+		}
+		return b.String()
+	case SchemaArray:
+		out := make([]interface{}, v.randomLength(rng, edge))
+		for i := range out {
+			out[i] = v.Items.generate(rng)
+		}
+		return out
+	}
+	return nil
+}
+
+func (v *ValueSchema) randomLength(rng *rand.Rand, edge bool) int {
+	lo, hi := v.lengthBounds()
+	if edge {
+		return pick(rng, lo, hi)
+	}
+	return lo + rng.Intn(hi-lo+1)
+}
+
+func (v *ValueSchema) alphabet() string {
+	if v.Alphabet == "" {
+		return "abcdefghijklmnopqrstuvwxyz"
+	}
+	return v.Alphabet
+}
+
+// shrink proposes simpler values than x that still fit the schema, most
+// aggressive first
+func (v *ValueSchema) shrink(x interface{}) []interface{} {
+	var out []interface{}
+	switch v.Type {
+	case SchemaInt:
+		n, _ := x.(int)
+		lo, hi := v.intBounds()
+		target := clamp(0, lo, hi)
+		for _, c := range []int{target, target + (n-target)/2, n - sign(n-target)} {
+			if c != n {
+				out = append(out, c)
+			}
+		}
+	case SchemaFloat:
+		f, _ := x.(float64)
+		lo, hi := v.bounds(-1000, 1000)
+		target := math.Max(lo, math.Min(0, hi))
+		for _, c := range []float64{target, math.Trunc(f), target + (f-target)/2} {
+			if c != f && c >= lo && c <= hi {
+				out = append(out, c)
+			}
+		}
+	case SchemaBool:
+		if b, _ := x.(bool); b {
+			out = append(out, false)
+		}
+	case SchemaString:
+		runes := []rune(fmt.Sprint(x))
+		lo, _ := v.lengthBounds()
+		for _, c := range shrinkLength(len(runes), lo) {
+			out = append(out, string(runes[c.from:c.to]))
+		}
+		for _, c := range dropOne(len(runes), lo) {
+			out = append(out, string(runes[:c])+string(runes[c+1:]))
+		}
+		simplest := []rune(v.alphabet())[0]
+		for i, r := range runes {
+			if r != simplest {
+				simpler := append([]rune{}, runes...)
+				simpler[i] = simplest
+				out = append(out, string(simpler))
+			}
+		}
+	case SchemaArray:
+		items, _ := x.([]interface{})
+		lo, _ := v.lengthBounds()
+		for _, c := range shrinkLength(len(items), lo) {
+			out = append(out, append([]interface{}{}, items[c.from:c.to]...))
+		}
+		for _, c := range dropOne(len(items), lo) {
+			out = append(out, append(append([]interface{}{}, items[:c]...), items[c+1:]...))
+		}
+		for i, item := range items {
+			for _, simpler := range v.Items.shrink(item) {
+				next := append([]interface{}{}, items...)
+				next[i] = simpler
+				out = append(out, next)
+			}
+		}
+	}
+	return out
+}
+
+type span struct{ from, to int }
+
+// shrinkLength proposes shorter prefixes and halves of a sequence of
+// length n, keeping least elements or more
+func shrinkLength(n, least int) []span {
+	var out []span
+	if n <= least {
+		return out
+	}
+	out = append(out, span{0, least})
+	if half := n / 2; half > least {
+		out = append(out, span{0, half}, span{n - half, n})
+	}
+	return out
+}
+
+// dropOne proposes removing each element of a short sequence
+func dropOne(n, least int) []int {
+	var out []int
+	if n <= least || n > 10 {
+		return out
+	}
+	for i := 0; i < n; i++ {
+		out = append(out, i)
+	}
+	return out
+}
+
+// propertyCase is a generated argument list with both programs' results
+type propertyCase struct {
+	args     []interface{}
+	expected json.RawMessage
+	actual   json.RawMessage
+	problem  string // why the learner's code produced no value
+	errType  string
+}
+
+// batchRun is one process calling an entry point on a batch of argument
+// lists. outcomes[i] is nil when the program stopped before list i, for
+// the reason in failure.
+type batchRun struct {
+	outcomes []*harnessOutcome
+	failure  string
+	errType  string
+}
+
+// checkProperties runs the learner's code and the reference solution on
+// random inputs from the exercise's schema. A disagreement is shrunk to a
+// minimal counterexample and reported as a failed edge case. It returns
+// nil unless the exercise hasProperties.
+func checkProperties(ctx context.Context, runner Runner, lang, code, entry string, spec *exerciseSpec) (*TestResult, error) {
+	if !spec.hasProperties() {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, propertyBudget)
+	defer cancel()
+
+	seed := spec.Schema.Seed
+	if seed == 0 {
+		seed = rand.Int63()
+	}
+	rng := rand.New(rand.NewSource(seed))
+	cases := spec.Schema.Cases
+	if cases == 0 {
+		cases = defaultPropertyCases
+	}
+	batch := make([][]interface{}, cases)
+	for i := range batch {
+		batch[i] = make([]interface{}, len(spec.Schema.Args))
+		for j := range spec.Schema.Args {
+			batch[i][j] = spec.Schema.Args[j].generate(rng)
+		}
+	}
+
+	refEntry := spec.entryFor(lang, spec.Solution)
+	checker := spec.propertyChecker()
+	compare := func(batch [][]interface{}) (*propertyCase, int, error) {
+		reference, err := runBatch(ctx, runner, lang, spec.Solution, refEntry, spec.Signature, batch, spec.Limits)
+		if err != nil {
+			return nil, 0, err
+		}
+		learner, err := runBatch(ctx, runner, lang, code, entry, spec.Signature, batch, spec.Limits)
+		if err != nil {
+			return nil, 0, err
+		}
+		checked := 0
+		for i, args := range batch {
+			// Inputs the reference solution rejects are outside the exercise
+			ref := reference.outcomes[i]
+			if ref == nil || !ref.OK {
+				continue
+			}
+			checked++
+			c := &propertyCase{args: args, expected: ref.Value}
+			got := learner.outcomes[i]
+			switch {
+			case got == nil:
+				c.problem, c.errType = learner.failure, learner.errType
+				return c, checked, nil
+			case !got.OK:
+				c.problem, c.errType = "Runtime error: "+got.Error, ErrorRuntime
+				return c, checked, nil
+			}
+			tc := TestCase{Input: args, Expected: decodeStored(string(ref.Value)), Checker: checker}
+			verdict, err := checker.check(ctx, runner, tc, got.Value, "")
+			if err != nil {
+				return nil, 0, err
+			}
+			if verdict.passed {
+				continue
+			}
+			c.actual = got.Value
+			if verdict.errorType != "" {
+				c.problem, c.errType = verdict.message, verdict.errorType
+			}
+			return c, checked, nil
+		}
+		return nil, checked, nil
+	}
+
+	result := &TestResult{ID: fmt.Sprintf("random:%d", seed), Name: "Random inputs"}
+	failing, checked, err := compare(batch)
+	if err != nil {
+		return nil, err
+	}
+	if failing == nil {
+		result.Passed = true
+		result.Message = fmt.Sprintf("Matched the reference solution on %d random inputs (seed %d)", checked, seed)
+		return result, nil
+	}
+	if failing.errType == ErrorSyntax {
+		// Nothing ran; the regular test cases report why
+		result.Message = failing.problem
+		result.ErrorType = ErrorSyntax
+		return result, nil
+	}
+
+	// Timeouts are too slow to shrink; anything else is shrunk one
+	// simplification at a time until none still fails
+	for round := 0; round < maxShrinkRounds && failing.errType != ErrorTimeout && ctx.Err() == nil; round++ {
+		candidates := shrinkArgs(spec.Schema.Args, failing.args)
+		if len(candidates) == 0 {
+			break
+		}
+		smaller, _, err := compare(candidates)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return nil, err
+		}
+		if smaller == nil {
+			break
+		}
+		failing = smaller
+	}
+
+	input := toJSON(failing.args)
+	if len(failing.args) == 1 {
+		input = toJSON(failing.args[0])
+	}
+	result.ErrorType = ErrorEdgeCase
+	result.Expected = compactJSON(failing.expected)
+	if failing.problem != "" {
+		result.Message = fmt.Sprintf("Fails on input %s: %s (seed %d)", input, failing.problem, seed)
+		return result, nil
+	}
+	result.Actual = compactJSON(failing.actual)
+	result.Message = fmt.Sprintf("Fails on input %s: expected %s but got %s (seed %d)", input, result.Expected, result.Actual, seed)
+	return result, nil
+}
+
+// hasProperties reports whether submissions are checked on random inputs,
+// which needs a function to call
+func (spec *exerciseSpec) hasProperties() bool {
+	return spec.Schema != nil && strings.TrimSpace(spec.Solution) != "" && (spec.Entry != "" || !printsOnly(spec.Tests))
+}
+
+// propertyChecker is how random cases are judged: the schema's checker,
+// or else the one the exercise's test cases use when it compares returned
+// values. Nil compares exactly.
+func (spec *exerciseSpec) propertyChecker() *Checker {
+	if spec.Schema.Checker != nil {
+		return spec.Schema.Checker
+	}
+	for _, tc := range spec.Tests {
+		if tc.Checker != nil && tc.Checker.comparesValues() {
+			return tc.Checker
+		}
+	}
+	return nil
+}
+
+// shrinkArgs proposes argument lists that simplify one argument each
+func shrinkArgs(schema []ValueSchema, args []interface{}) [][]interface{} {
+	var out [][]interface{}
+	for i := range args {
+		for _, simpler := range schema[i].shrink(args[i]) {
+			next := append([]interface{}{}, args...)
+			next[i] = simpler
+			out = append(out, next)
+			if len(out) == maxShrinkCandidates {
+				return out
+			}
+		}
+	}
+	return out
+}
+
+// runBatch calls code's entry point once per argument list, all in one
+// process
+func runBatch(ctx context.Context, runner Runner, lang, code, entry string, sig *Signature, batch [][]interface{}, limits Limits) (*batchRun, error) {
+	run := &batchRun{outcomes: make([]*harnessOutcome, len(batch))}
+	files, problem := harnessFiles(lang, code, entry, sig)
+	if problem != "" {
+		run.failure, run.errType = problem, ErrorSyntax
+		return run, nil
+	}
+	marker, err := newMarker()
+	if err != nil {
+		return nil, err
+	}
+	input, err := json.Marshal(harnessInput{Marker: marker, Args: []interface{}{}, Batch: batch})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode batch: %w", err)
+	}
+	files[harnessInputFile] = string(input)
+
+	limits.WallTime = propertyTimeout
+	limits.CPUTime = propertyTimeout
+	limits.OutputBytes = propertyOutputBytes
+	res, err := runner.Run(ctx, Program{Language: lang, Files: files, Limits: limits})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(res.Stdout, "\n") {
+		idx := strings.Index(line, marker)
+		if idx < 0 {
+			continue
+		}
+		var outcome harnessOutcome
+		if json.Unmarshal([]byte(line[idx+len(marker):]), &outcome) != nil {
+			continue
+		}
+		if outcome.Kind != "batch" && outcome.Kind != "exception" {
+			// The entry point could not be called at all
+			run.failure, run.errType = outcome.Error, ErrorSyntax
+			return run, nil
+		}
+		if outcome.Size >= 0 && outcome.Size < len(batch) {
+			run.outcomes[outcome.Size] = &outcome
+		}
+	}
+
+	switch {
+	case res.TimedOut:
+		run.failure, run.errType = fmt.Sprintf("Time limit exceeded (%d ms)", propertyTimeout.Milliseconds()), ErrorTimeout
+	case res.Stage == StageCompile:
+		run.failure, run.errType = "Compilation failed: "+errorSummary(res.Stderr), ErrorSyntax
+	default:
+		run.failure, run.errType = runResponse(res).Error, classifyError(res)
+		if run.failure == "" {
+			run.failure = "Program exited before the function returned"
+		}
+	}
+	return run, nil
+}
+
+func pick[T any](rng *rand.Rand, options ...T) T {
+	return options[rng.Intn(len(options))]
+}
+
+func clamp(n, lo, hi int) int {
+	return min(max(n, lo), hi)
+}
+
+func sign(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
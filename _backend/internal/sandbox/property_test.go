@@ -0,0 +1,167 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func parseValueSchema(t *testing.T, raw string) *ValueSchema {
+	t.Helper()
+	var v ValueSchema
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		t.Fatalf("bad schema %s: %v", raw, err)
+	}
+	return &v
+}
+
+func TestValueSchemaShrink(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		value  interface{}
+		want   []interface{}
+	}{
+		{"int toward zero", `{"type":"int"}`, 10, []interface{}{0, 5, 9}},
+		{"negative int", `{"type":"int"}`, -7, []interface{}{0, -3, -6}},
+		{"int toward min", `{"type":"int","min":5}`, 8, []interface{}{5, 6, 7}},
+		{"int at target", `{"type":"int"}`, 0, nil},
+		{"float", `{"type":"float"}`, 2.5, []interface{}{0.0, 2.0, 1.25}},
+		{"bool true", `{"type":"bool"}`, true, []interface{}{false}},
+		{"bool false", `{"type":"bool"}`, false, nil},
+		{"string", `{"type":"string"}`, "bca", []interface{}{"", "b", "a", "ca", "ba", "bc", "aca", "baa"}},
+		{"string at min length", `{"type":"string","min":1,"alphabet":"xy"}`, "x", nil},
+		{"array", `{"type":"array","items":{"type":"int"}}`, []interface{}{3, 0}, []interface{}{
+			[]interface{}{}, []interface{}{3}, []interface{}{0},
+			[]interface{}{0}, []interface{}{3},
+			[]interface{}{0, 0}, []interface{}{1, 0}, []interface{}{2, 0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseValueSchema(t, tt.schema).shrink(tt.value)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("shrink(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestShrinkArgsFindsMinimalCase shrinks the way checkProperties does,
+// with a predicate standing in for the learner's code disagreeing with
+// the reference solution
+func TestShrinkArgsFindsMinimalCase(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		args   []interface{}
+		fails  func(args []interface{}) bool
+		want   []interface{}
+	}{
+		{
+			"int above threshold",
+			`{"args":[{"type":"int","min":0,"max":1000}]}`,
+			[]interface{}{873},
+			func(args []interface{}) bool { return args[0].(int) >= 17 },
+			[]interface{}{17},
+		},
+		{
+			"array holding a negative",
+			`{"args":[{"type":"array","items":{"type":"int"}}]}`,
+			[]interface{}{[]interface{}{4, 9, -12, 7, 0}},
+			func(args []interface{}) bool {
+				for _, x := range args[0].([]interface{}) {
+					if x.(int) < 0 {
+						return true
+					}
+				}
+				return false
+			},
+			[]interface{}{[]interface{}{-1}},
+		},
+		{
+			"string with a z",
+			`{"args":[{"type":"string","min":1,"max":10}]}`,
+			[]interface{}{"qqzxy"},
+			func(args []interface{}) bool {
+				for _, r := range args[0].(string) {
+					if r == 'z' {
+						return true
+					}
+				}
+				return false
+			},
+			[]interface{}{"z"},
+		},
+		{
+			"second argument only",
+			`{"args":[{"type":"int"},{"type":"bool"}]}`,
+			[]interface{}{42, true},
+			func(args []interface{}) bool { return args[1].(bool) },
+			[]interface{}{0, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := ParseInputSchema([]byte(tt.schema))
+			if err != nil {
+				t.Fatalf("ParseInputSchema: %v", err)
+			}
+			failing := tt.args
+			for round := 0; round < 1000; round++ {
+				var smaller []interface{}
+				for _, c := range shrinkArgs(schema.Args, failing) {
+					if tt.fails(c) {
+						smaller = c
+						break
+					}
+				}
+				if smaller == nil {
+					break
+				}
+				failing = smaller
+			}
+			if !reflect.DeepEqual(failing, tt.want) {
+				t.Errorf("shrunk to %v, want %v", failing, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInputSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		valid   bool
+		checker string // type of the declared checker
+	}{
+		{"ints", `{"args":[{"type":"int","min":-5,"max":5}]}`, true, ""},
+		{"no args", `{"args":[]}`, false, ""},
+		{"empty int range", `{"args":[{"type":"int","min":0.2,"max":0.8}]}`, false, ""},
+		{"array without items", `{"args":[{"type":"array"}]}`, false, ""},
+		{"too long", `{"args":[{"type":"string","max":5000}]}`, false, ""},
+		{"too many cases", `{"args":[{"type":"bool"}],"cases":1000}`, false, ""},
+		{"tolerance checker", `{"args":[{"type":"float"}],"checker":{"type":"tolerance","abs":0.01}}`, true, CheckTolerance},
+		{"null checker", `{"args":[{"type":"float"}],"checker":null}`, true, ""},
+		{"stdout checker", `{"args":[{"type":"int"}],"checker":{"type":"stdout"}}`, false, ""},
+		{"invalid checker", `{"args":[{"type":"int"}],"checker":{"type":"fuzzy"}}`, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseInputSchema([]byte(tt.raw))
+			if (err == nil) != tt.valid {
+				t.Fatalf("ParseInputSchema error = %v, want valid %v", err, tt.valid)
+			}
+			if err != nil {
+				return
+			}
+			got := ""
+			if s.Checker != nil {
+				got = s.Checker.Type
+			}
+			if got != tt.checker {
+				t.Errorf("checker = %q, want %q", got, tt.checker)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package sandbox
+
+import (
+	"context"
+	"time"
+)
+
+// Runner executes a learner program in isolation
+type Runner interface {
+	// Run builds (if needed) and executes prog. The returned error is reserved
+	// for infrastructure failures; problems with the learner's code are
+	// reported through the Result.
+	Run(ctx context.Context, prog Program) (*Result, error)
+}
+
+// Program is a single execution request for a Runner
+type Program struct {
+	Language string
+	Files    map[string]string // relative path -> source
+	Entry    string            // file to start; defaults to the toolchain's MainFile
+	Stdin    string
+	Env      []string // extra environment for the program, added after the toolchain's
+	Limits   Limits
+
+	// OnOutput, when set, receives the run stage's output as it is
+	// produced. It may be called from several goroutines at once.
+	OnOutput func(stream string, data []byte)
+}
+
+// Output streams passed to Program.OnOutput
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// Execution stages reported in Result.Stage
+const (
+	StageCompile = "compile"
+	StageRun     = "run"
+)
+
+// Result describes how a program finished
+type Result struct {
+	Stage     string // stage the program stopped in
+	Stdout    string
+	Stderr    string
+	ExitCode  int
+	Signal    string // set when the process was killed by a signal
+	TimedOut  bool   // wall-clock or CPU limit exceeded
+	Truncated bool   // output limit exceeded, process was stopped
+	Duration  time.Duration
+}
+
+// Failed reports whether the program did not finish cleanly
+func (r *Result) Failed() bool {
+	return r.Stage == StageCompile || r.ExitCode != 0 || r.TimedOut || r.Truncated
+}
+
+// Limits bounds the resources a single execution may use
+type Limits struct {
+	WallTime    time.Duration // real time before the process group is killed
+	CPUTime     time.Duration // RLIMIT_CPU
+	MemoryBytes int64         // RLIMIT_DATA
+	OutputBytes int           // per stream; exceeding it stops the process
+	FileBytes   int64         // RLIMIT_FSIZE
+	MaxProcs    int           // RLIMIT_NPROC, only applied with a dedicated UID
+	MaxFiles    int           // RLIMIT_NOFILE
+}
+
+// orDefaults fills the zero fields of l from defaults
+func (l Limits) orDefaults(defaults Limits) Limits {
+	if l.WallTime <= 0 {
+		l.WallTime = defaults.WallTime
+	}
+	if l.CPUTime <= 0 {
+		l.CPUTime = defaults.CPUTime
+	}
+	if l.MemoryBytes <= 0 {
+		l.MemoryBytes = defaults.MemoryBytes
+	}
+	if l.OutputBytes <= 0 {
+		l.OutputBytes = defaults.OutputBytes
+	}
+	if l.FileBytes <= 0 {
+		l.FileBytes = defaults.FileBytes
+	}
+	if l.MaxProcs <= 0 {
+		l.MaxProcs = defaults.MaxProcs
+	}
+	if l.MaxFiles <= 0 {
+		l.MaxFiles = defaults.MaxFiles
+	}
+	return l
+}
+
+// Bounds for per-test-case time limits set by exercise authors
+const (
+	MinTestTimeout = 100 * time.Millisecond
+	MaxTestTimeout = 30 * time.Second
+)
+
+// Bounds for per-exercise memory ceilings, in megabytes
+const (
+	MinMemoryLimitMB = 64
+	MaxMemoryLimitMB = 2048
+)
+
+// DefaultLimits matches the execution constraints in the sandbox braid
+func DefaultLimits() Limits {
+	return Limits{
+		WallTime:    5 * time.Second,
+		CPUTime:     5 * time.Second,
+		MemoryBytes: 128 << 20,
+		OutputBytes: 10 << 10,
+		FileBytes:   1 << 20,
+		MaxProcs:    64,
+		MaxFiles:    64,
+	}
+}
+
+// DefaultCompileLimits bounds trusted toolchain steps such as `go build`
+func DefaultCompileLimits() Limits {
+	return Limits{
+		WallTime:    30 * time.Second,
+		CPUTime:     60 * time.Second,
+		MemoryBytes: 1 << 30,
+		OutputBytes: 64 << 10,
+		FileBytes:   256 << 20,
+		MaxFiles:    1024,
+	}
+}
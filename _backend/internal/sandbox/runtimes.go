@@ -0,0 +1,208 @@
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runtime is what the inventory found out about one language's runtime
+type Runtime struct {
+	Language  string    `json:"language"`
+	Backend   string    `json:"backend"`
+	Available bool      `json:"available"`
+	Version   string    `json:"version,omitempty"` // dotted version number, such as 3.12.1
+	Detail    string    `json:"detail,omitempty"`  // the runtime's own name and version
+	Error     string    `json:"error,omitempty"`   // why the runtime is unavailable
+	SmokeMs   int64     `json:"smokeMs"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// smokeMarker starts the line a smoke program prints, followed by 42 and
+// the runtime's name and version
+const smokeMarker = "pp-smoke"
+
+// smokePrograms check that each driver's runtime starts, computes and
+// prints, and report its version from the inside, which works the same on
+// every backend
+var smokePrograms = map[string]string{
+	LangPython: `import sys
+print("pp-smoke", 6 * 7, sys.implementation.name, "%d.%d.%d" % sys.version_info[:3])
+`,
+	LangJavaScript: `const node = typeof process !== "undefined" && process.versions && process.versions.node;
+console.log("pp-smoke", 6 * 7, node ? "node " + node : "quickjs");
+`,
+	LangGo: `package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func main() {
+	fmt.Println("pp-smoke", 6*7, runtime.Version())
+}
+`,
+}
+
+var (
+	versionPattern = regexp.MustCompile(`\d+(\.\d+)+`)
+	pinPattern     = regexp.MustCompile(`^\d+(\.\d+)*$`)
+)
+
+// CheckRuntimes runs a smoke program in every registered language and
+// records the results. Languages whose runtime fails are hidden from
+// Languages and rejected by the handlers until the next check.
+func CheckRuntimes(ctx context.Context, runner Runner) []Runtime {
+	langs := allLanguages()
+	runtimes := make([]Runtime, len(langs))
+	var wg sync.WaitGroup
+	for i, lang := range langs {
+		wg.Add(1)
+		go func(i int, lang Language) {
+			defer wg.Done()
+			runtimes[i] = checkRuntime(ctx, runner, lang.ID)
+		}(i, lang)
+	}
+	wg.Wait()
+
+	registry.Lock()
+	registry.runtimes = map[string]Runtime{}
+	for _, rt := range runtimes {
+		registry.runtimes[rt.Language] = rt
+	}
+	registry.Unlock()
+	return runtimes
+}
+
+// checkRuntime runs the smoke program for one language
+func checkRuntime(ctx context.Context, runner Runner, lang string) Runtime {
+	tc, _ := lookupToolchain(lang)
+	rt := Runtime{Language: lang, Backend: tc.Backend, CheckedAt: time.Now().UTC()}
+	source, ok := smokePrograms[tc.Driver]
+	if !ok {
+		rt.Error = "no smoke program for " + tc.Driver
+		return rt
+	}
+
+	start := time.Now()
+	res, err := runner.Run(ctx, Program{
+		Language: lang,
+		Files:    map[string]string{tc.MainFile: source},
+		Limits:   tc.limits(),
+	})
+	rt.SmokeMs = time.Since(start).Milliseconds()
+	if err != nil {
+		rt.Error = err.Error()
+		return rt
+	}
+	if res.Failed() {
+		rt.Error = runResponse(res).Error
+		if stderr := strings.TrimSpace(res.Stderr); stderr != "" {
+			rt.Error += ": " + errorSummary(stderr)
+		}
+		return rt
+	}
+
+	for _, line := range strings.Split(res.Stdout, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[0] == smokeMarker && fields[1] == "42" {
+			rt.Detail = strings.Join(fields[2:], " ")
+			rt.Version = versionPattern.FindString(rt.Detail)
+			if tc.MinVersion != "" && versionBefore(rt.Version, tc.MinVersion) {
+				rt.Error = fmt.Sprintf("needs version %s or later, found %s", tc.MinVersion, rt.Detail)
+				return rt
+			}
+			rt.Available = true
+			return rt
+		}
+	}
+	rt.Error = fmt.Sprintf("unexpected smoke program output %q", strings.TrimSpace(res.Stdout))
+	return rt
+}
+
+// Runtimes returns the last inventory in display order, empty when
+// CheckRuntimes has not run
+func Runtimes() []Runtime {
+	registry.RLock()
+	defer registry.RUnlock()
+	var runtimes []Runtime
+	for _, l := range registry.langs {
+		if rt, ok := registry.runtimes[l.ID]; ok {
+			runtimes = append(runtimes, rt)
+		}
+	}
+	return runtimes
+}
+
+// runtimeFor returns the inventory entry for lang, if it was checked
+func runtimeFor(lang string) (Runtime, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	rt, ok := registry.runtimes[lang]
+	return rt, ok
+}
+
+// versionMatches reports whether version is pin or a release of it:
+// "3.12" matches 3.12.1 but not 3.1 or 3.120
+func versionMatches(pin, version string) bool {
+	return version == pin || strings.HasPrefix(version, pin+".")
+}
+
+// versionBefore reports whether dotted version a is older than b, reading
+// missing parts as zero: 22.5.1 is before 22.6, and 22.6 is not
+func versionBefore(a, b string) bool {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			return x < y
+		}
+	}
+	return false
+}
+
+// pinnedLanguage picks the language that runs lang's programs on a
+// runtime matching pin: lang itself, or another language sharing its
+// driver, such as a second Python installed under its own ID
+func pinnedLanguage(lang, pin string) (string, string) {
+	pin = strings.TrimPrefix(strings.TrimSpace(pin), "v")
+	if pin == "" {
+		return lang, ""
+	}
+	if !pinPattern.MatchString(pin) {
+		return "", "Invalid version: " + pin
+	}
+	if rt, ok := runtimeFor(lang); ok && rt.Available && versionMatches(pin, rt.Version) {
+		return lang, ""
+	}
+
+	var installed []string
+	for _, l := range Languages() {
+		if dialect(l.ID) != dialect(lang) {
+			continue
+		}
+		rt, ok := runtimeFor(l.ID)
+		if !ok || !rt.Available || rt.Version == "" {
+			continue
+		}
+		if versionMatches(pin, rt.Version) {
+			return l.ID, ""
+		}
+		installed = append(installed, rt.Version)
+	}
+	if len(installed) == 0 {
+		return "", fmt.Sprintf("Version %s is not available", pin)
+	}
+	return "", fmt.Sprintf("Version %s is not available; installed: %s", pin, strings.Join(installed, ", "))
+}
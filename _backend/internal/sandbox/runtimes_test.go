@@ -0,0 +1,123 @@
+package sandbox
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPinnedLanguage(t *testing.T) {
+	registry.Lock()
+	saved := registry.langs
+	savedRuntimes := registry.runtimes
+	py := builtinToolchains[LangPython]
+	py311 := py
+	py311.Language, py311.Driver = "python311", LangPython
+	py310 := py
+	py310.Language, py310.Driver = "python310", LangPython
+	registry.langs = append(builtinLanguages(),
+		Language{ID: "python311", toolchain: py311},
+		Language{ID: "python310", toolchain: py310})
+	registry.runtimes = map[string]Runtime{
+		LangPython:     {Language: LangPython, Available: true, Version: "3.12.1"},
+		"python311":    {Language: "python311", Available: true, Version: "3.11.9"},
+		"python310":    {Language: "python310", Available: false, Version: "3.10.4", Error: "smoke test failed"},
+		LangJavaScript: {Language: LangJavaScript, Available: true, Version: "20.11.0"},
+	}
+	registry.Unlock()
+	t.Cleanup(func() {
+		registry.Lock()
+		registry.langs, registry.runtimes = saved, savedRuntimes
+		registry.Unlock()
+	})
+
+	tests := []struct {
+		name    string
+		lang    string
+		pin     string
+		want    string
+		problem string
+	}{
+		{"no pin", LangPython, "", LangPython, ""},
+		{"blank pin", LangPython, "  ", LangPython, ""},
+		{"own runtime", LangPython, "3.12", LangPython, ""},
+		{"exact version", LangPython, "3.12.1", LangPython, ""},
+		{"v prefix", LangJavaScript, "v20", LangJavaScript, ""},
+		{"sibling runtime", LangPython, "3.11", "python311", ""},
+		{"from sibling back", "python311", "3.12", LangPython, ""},
+		{"prefix is not a release", LangPython, "3.1", "", "Version 3.1 is not available; installed: 3.12.1, 3.11.9"},
+		{"unavailable runtime", LangPython, "3.10", "", "Version 3.10 is not available; installed: 3.12.1, 3.11.9"},
+		{"unchecked runtime", LangGo, "1.22", "", "Version 1.22 is not available"},
+		{"invalid", LangPython, "latest", "", "Invalid version: latest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, problem := pinnedLanguage(tt.lang, tt.pin)
+			if got != tt.want || problem != tt.problem {
+				t.Errorf("pinnedLanguage(%q, %q) = %q, %q; want %q, %q", tt.lang, tt.pin, got, problem, tt.want, tt.problem)
+			}
+		})
+	}
+}
+
+func TestVersionBefore(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"20.11.0", "22.6", true},
+		{"22.5.1", "22.6", true},
+		{"22.6", "22.6", false},
+		{"22.6.0", "22.6", false},
+		{"22.10.0", "22.6", false},
+		{"3.9", "3.10", true},
+		{"23", "22.6", false},
+		{"", "1", true},
+	}
+	for _, tt := range tests {
+		if got := versionBefore(tt.a, tt.b); got != tt.want {
+			t.Errorf("versionBefore(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// smokeRunner answers every program with the output of a smoke program
+type smokeRunner string
+
+func (s smokeRunner) Run(ctx context.Context, prog Program) (*Result, error) {
+	return &Result{Stdout: string(s)}, nil
+}
+
+func TestCheckRuntimeMinVersion(t *testing.T) {
+	tc, err := languageToolchain("typescript", ".ts", `{"mainFile": "main.ts", "run": ["node", "{entry}"], "minVersion": "22.6", "driver": "javascript"}`)
+	if err != nil {
+		t.Fatalf("languageToolchain: %v", err)
+	}
+	registry.Lock()
+	saved := registry.langs
+	registry.langs = append(builtinLanguages(), Language{ID: "typescript", toolchain: tc})
+	registry.Unlock()
+	t.Cleanup(func() {
+		registry.Lock()
+		registry.langs = saved
+		registry.Unlock()
+	})
+
+	tests := []struct {
+		node      string
+		available bool
+	}{
+		{"20.11.1", false},
+		{"22.5.1", false},
+		{"22.6.0", true},
+		{"23.1.0", true},
+	}
+	for _, tt := range tests {
+		rt := checkRuntime(context.Background(), smokeRunner("pp-smoke 42 node "+tt.node+"\n"), "typescript")
+		if rt.Available != tt.available || rt.Version != tt.node {
+			t.Errorf("node %s: available = %v, version %q (%s); want %v", tt.node, rt.Available, rt.Version, rt.Error, tt.available)
+		}
+	}
+	if _, err := languageToolchain("typescript", ".ts", `{"mainFile": "main.ts", "run": ["node"], "minVersion": "v22", "driver": "javascript"}`); err == nil {
+		t.Error("languageToolchain accepted minVersion v22")
+	}
+}
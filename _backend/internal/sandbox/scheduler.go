@@ -0,0 +1,336 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scheduler errors. Both mean the caller should retry later.
+var (
+	ErrSandboxBusy     = errors.New("sandbox is at capacity")
+	ErrTooManyInFlight = errors.New("too many concurrent executions")
+)
+
+// SchedulerConfig sizes the sandbox worker pool
+type SchedulerConfig struct {
+	Workers    int           // executions allowed to run at once
+	QueueSize  int           // executions allowed to wait for a worker
+	MaxWait    time.Duration // longest a queued execution waits before being rejected
+	MaxPerUser int           // in-flight (queued or running) executions per signed-in user
+	MaxPerIP   int           // in-flight executions per client IP
+
+	// TrustedProxies are the peers whose Fly-Client-IP header names the
+	// client. Anyone else could set it to dodge MaxPerIP.
+	TrustedProxies []*net.IPNet
+}
+
+// DefaultSchedulerConfig sizes the pool from the number of CPUs
+func DefaultSchedulerConfig() SchedulerConfig {
+	workers := runtime.NumCPU()
+	return SchedulerConfig{
+		Workers:    workers,
+		QueueSize:  workers * 8,
+		MaxWait:    30 * time.Second,
+		MaxPerUser: 2,
+		MaxPerIP:   4,
+	}
+}
+
+// Ticket identifies who an execution is for
+type Ticket struct {
+	UserID string // empty for anonymous requests
+	IP     string
+}
+
+// SchedulerStats is a snapshot of the pool for capacity planning
+type SchedulerStats struct {
+	Workers       int     `json:"workers"`
+	Running       int     `json:"running"`
+	QueueDepth    int     `json:"queueDepth"`
+	QueueCapacity int     `json:"queueCapacity"`
+	MaxQueueDepth int     `json:"maxQueueDepth"`
+	Completed     int64   `json:"completed"`
+	Rejected      int64   `json:"rejected"`
+	Cancelled     int64   `json:"cancelled"`
+	AvgWaitMs     float64 `json:"avgWaitMs"`
+	MaxWaitMs     int64   `json:"maxWaitMs"`
+	AvgRunMs      float64 `json:"avgRunMs"`
+}
+
+// Scheduler bounds how many sandbox executions run and wait at once.
+// Waiters get freed workers in arrival order.
+type Scheduler struct {
+	cfg SchedulerConfig
+
+	mu       sync.Mutex
+	running  int
+	waiters  []*waiter
+	inFlight map[string]int
+	stats    SchedulerStats
+	waitSum  time.Duration
+	runSum   time.Duration
+	acquired int64
+}
+
+// NewScheduler creates a scheduler; non-positive sizes fall back to defaults
+func NewScheduler(cfg SchedulerConfig) *Scheduler {
+	def := DefaultSchedulerConfig()
+	if cfg.Workers <= 0 {
+		cfg.Workers = def.Workers
+	}
+	if cfg.QueueSize < 0 {
+		cfg.QueueSize = def.QueueSize
+	}
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = def.MaxWait
+	}
+	return &Scheduler{
+		cfg:      cfg,
+		inFlight: make(map[string]int),
+	}
+}
+
+// waiter is a queued execution. ready is closed once a finishing
+// execution hands it its worker.
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// Acquire waits for a free worker. The returned release func must be
+// called once the execution finishes. It fails fast with ErrSandboxBusy or
+// ErrTooManyInFlight when the pool is saturated, and returns ctx.Err() if
+// the caller goes away while queued.
+func (s *Scheduler) Acquire(ctx context.Context, t Ticket) (func(), error) {
+	keys := s.keys(t)
+
+	s.mu.Lock()
+	for _, k := range keys {
+		if s.inFlight[k.name] >= k.limit {
+			s.stats.Rejected++
+			s.mu.Unlock()
+			return nil, ErrTooManyInFlight
+		}
+	}
+
+	// Skip the queue when a worker is idle and nobody is ahead
+	if s.running < s.cfg.Workers && len(s.waiters) == 0 {
+		s.running++
+		s.track(keys, 1)
+		s.mu.Unlock()
+		return s.started(keys, 0), nil
+	}
+
+	if len(s.waiters) >= s.cfg.QueueSize {
+		s.stats.Rejected++
+		s.mu.Unlock()
+		return nil, ErrSandboxBusy
+	}
+	w := &waiter{ready: make(chan struct{})}
+	s.waiters = append(s.waiters, w)
+	if len(s.waiters) > s.stats.MaxQueueDepth {
+		s.stats.MaxQueueDepth = len(s.waiters)
+	}
+	s.track(keys, 1)
+	s.mu.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(s.cfg.MaxWait)
+	defer timer.Stop()
+
+	select {
+	case <-w.ready:
+		return s.started(keys, time.Since(start)), nil
+	case <-ctx.Done():
+		s.abandon(w, keys, &s.stats.Cancelled)
+		return nil, ctx.Err()
+	case <-timer.C:
+		s.abandon(w, keys, &s.stats.Rejected)
+		return nil, ErrSandboxBusy
+	}
+}
+
+// Stats returns a snapshot of the pool
+func (s *Scheduler) Stats() SchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.stats
+	st.Workers = s.cfg.Workers
+	st.Running = s.running
+	st.QueueDepth = len(s.waiters)
+	st.QueueCapacity = s.cfg.QueueSize
+	if s.acquired > 0 {
+		st.AvgWaitMs = float64(s.waitSum.Milliseconds()) / float64(s.acquired)
+	}
+	if st.Completed > 0 {
+		st.AvgRunMs = float64(s.runSum.Milliseconds()) / float64(st.Completed)
+	}
+	return st
+}
+
+// RetryAfter estimates how long a rejected caller should wait, based on
+// how long executions take and how many are ahead of it
+func (s *Scheduler) RetryAfter() time.Duration {
+	st := s.Stats()
+	avg := time.Duration(st.AvgRunMs) * time.Millisecond
+	if avg <= 0 {
+		avg = time.Second
+	}
+	wait := time.Duration(float64(avg) * float64(st.QueueDepth+1) / float64(st.Workers))
+	switch {
+	case wait < time.Second:
+		return time.Second
+	case wait > time.Minute:
+		return time.Minute
+	}
+	return wait
+}
+
+type schedulerKey struct {
+	name  string
+	limit int
+}
+
+func (s *Scheduler) keys(t Ticket) []schedulerKey {
+	var keys []schedulerKey
+	if t.UserID != "" && s.cfg.MaxPerUser > 0 {
+		keys = append(keys, schedulerKey{"user:" + t.UserID, s.cfg.MaxPerUser})
+	}
+	if t.IP != "" && s.cfg.MaxPerIP > 0 {
+		keys = append(keys, schedulerKey{"ip:" + t.IP, s.cfg.MaxPerIP})
+	}
+	return keys
+}
+
+// track adjusts in-flight counts; callers hold s.mu
+func (s *Scheduler) track(keys []schedulerKey, delta int) {
+	for _, k := range keys {
+		s.inFlight[k.name] += delta
+		if s.inFlight[k.name] <= 0 {
+			delete(s.inFlight, k.name)
+		}
+	}
+}
+
+// started records a granted slot and returns its release func
+func (s *Scheduler) started(keys []schedulerKey, waited time.Duration) func() {
+	s.mu.Lock()
+	s.acquired++
+	s.waitSum += waited
+	if ms := waited.Milliseconds(); ms > s.stats.MaxWaitMs {
+		s.stats.MaxWaitMs = ms
+	}
+	s.mu.Unlock()
+
+	start := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			s.track(keys, -1)
+			s.stats.Completed++
+			s.runSum += time.Since(start)
+			s.handOff()
+			s.mu.Unlock()
+		})
+	}
+}
+
+// handOff gives a finished execution's worker to the longest waiting
+// execution, or frees it; callers hold s.mu
+func (s *Scheduler) handOff() {
+	if len(s.waiters) == 0 {
+		s.running--
+		return
+	}
+	w := s.waiters[0]
+	s.waiters = s.waiters[1:]
+	w.granted = true
+	close(w.ready)
+}
+
+// abandon removes a queued execution whose caller gave up. A worker
+// handed to it in the meantime goes to the next in line.
+func (s *Scheduler) abandon(w *waiter, keys []schedulerKey, counter *int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.track(keys, -1)
+	*counter++
+	if w.granted {
+		s.handOff()
+		return
+	}
+	for i, q := range s.waiters {
+		if q == w {
+			s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+			break
+		}
+	}
+}
+
+// clientIP returns the address the request came from. Fly's proxy sets
+// Fly-Client-IP and overwrites any value the client sent, so the header
+// is believed only from a trusted proxy.
+func (s *Scheduler) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := r.Header.Get("Fly-Client-IP"); ip != "" && s.trustedProxy(host) {
+		return ip
+	}
+	return host
+}
+
+// trustedProxy reports whether host is one of cfg.TrustedProxies
+func (s *Scheduler) trustedProxy(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range s.cfg.TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies parses a comma-separated list of addresses and CIDR
+// ranges for SchedulerConfig.TrustedProxies
+func ParseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", item)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// retryAfterSeconds formats a Retry-After delay in whole seconds
+func retryAfterSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
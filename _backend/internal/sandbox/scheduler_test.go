@@ -0,0 +1,69 @@
+package sandbox
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSchedulerHandsFreedWorkersToWaiters(t *testing.T) {
+	s := NewScheduler(SchedulerConfig{Workers: 1, QueueSize: 4, MaxWait: time.Second})
+	release, err := s.Acquire(context.Background(), Ticket{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(chan func(), 1)
+	go func() {
+		r, err := s.Acquire(context.Background(), Ticket{})
+		if err != nil {
+			t.Error(err)
+		}
+		got <- r
+	}()
+	for s.Stats().QueueDepth == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The freed worker belongs to the waiter, not to a new arrival
+	release()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.Acquire(ctx, Ticket{}); err == nil {
+		t.Fatal("new arrival took the worker ahead of the queue")
+	}
+	(<-got)()
+
+	if st := s.Stats(); st.Running != 0 || st.QueueDepth != 0 {
+		t.Errorf("running %d, queued %d after all releases", st.Running, st.QueueDepth)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, fdaa::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewScheduler(SchedulerConfig{TrustedProxies: proxies})
+
+	tests := []struct {
+		remote, header, want string
+	}{
+		{"203.0.113.7:5000", "", "203.0.113.7"},
+		{"203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"10.1.2.3:5000", "198.51.100.1", "198.51.100.1"},
+		{"[fdaa::1]:5000", "198.51.100.1", "198.51.100.1"},
+		{"[fdaa::2]:5000", "198.51.100.1", "fdaa::2"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.header != "" {
+			r.Header.Set("Fly-Client-IP", tt.header)
+		}
+		if got := s.clientIP(r); got != tt.want {
+			t.Errorf("clientIP(%s, %q) = %s, want %s", tt.remote, tt.header, got, tt.want)
+		}
+	}
+}
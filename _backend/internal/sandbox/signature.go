@@ -0,0 +1,242 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/token"
+	"strings"
+	"unicode"
+)
+
+// Signature describes an exercise's entry point once for every language.
+// Names are given as words in any style ("sum to n", "sumToN" or
+// "sum_to_n") and each language gets its idiomatic spelling. Types are
+// int, float, bool, string, or any of them followed by [] for an array.
+type Signature struct {
+	Name    string  `json:"name"`
+	Params  []Param `json:"params"`
+	Returns string  `json:"returns,omitempty"` // empty when nothing is returned
+}
+
+// Param is one argument of a Signature
+type Param struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// maxSignatureParams bounds the arguments a signature may declare
+const maxSignatureParams = 8
+
+// ParseSignature decodes and validates an entry point signature
+func ParseSignature(raw []byte) (*Signature, error) {
+	var s Signature
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	if !validName(s.Name) {
+		return nil, errors.New("signature needs a function name starting with a letter")
+	}
+	if len(s.Params) > maxSignatureParams {
+		return nil, fmt.Errorf("signature may have at most %d parameters", maxSignatureParams)
+	}
+	seen := map[string]bool{}
+	for i, p := range s.Params {
+		if !validName(p.Name) {
+			return nil, fmt.Errorf("parameter %d needs a name starting with a letter", i)
+		}
+		key := strings.Join(nameWords(p.Name), " ")
+		if seen[key] {
+			return nil, fmt.Errorf("parameter %q is declared twice", p.Name)
+		}
+		seen[key] = true
+		if !validValueType(p.Type) {
+			return nil, fmt.Errorf("parameter %q has unknown type %q", p.Name, p.Type)
+		}
+	}
+	if s.Returns != "" && !validValueType(s.Returns) {
+		return nil, fmt.Errorf("unknown return type %q", s.Returns)
+	}
+	return &s, nil
+}
+
+// validValueType accepts a scalar type name followed by any number of []
+func validValueType(t string) bool {
+	for {
+		elem, ok := strings.CutSuffix(t, "[]")
+		if !ok {
+			break
+		}
+		t = elem
+	}
+	switch t {
+	case SchemaInt, SchemaFloat, SchemaBool, SchemaString:
+		return true
+	}
+	return false
+}
+
+// validName accepts names whose first word starts with a letter
+func validName(name string) bool {
+	words := nameWords(name)
+	return len(words) > 0 && unicode.IsLetter([]rune(words[0])[0])
+}
+
+// nameWords splits a name into lower-case words at spaces, underscores,
+// hyphens and case changes. Digits stay with the word before them.
+func nameWords(name string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+			continue
+		case unicode.IsUpper(r) && len(word) > 0:
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			// "sumToN" breaks before T and N; "parseHTTPBody" before H and B
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || nextLower {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+	return words
+}
+
+// identifier spells a name the way lang names functions and variables
+func identifier(lang, name string) string {
+	words := nameWords(name)
+	var id string
+	switch dialect(lang) {
+	case LangPython:
+		id = strings.Join(words, "_")
+	default:
+		var b strings.Builder
+		for i, w := range words {
+			if i > 0 {
+				w = strings.ToUpper(w[:1]) + w[1:]
+			}
+			b.WriteString(w)
+		}
+		id = b.String()
+	}
+	if reservedWord(lang, id) {
+		id += "_"
+	}
+	return id
+}
+
+func reservedWord(lang, id string) bool {
+	switch dialect(lang) {
+	case LangPython:
+		return pyReserved[id]
+	case LangGo:
+		return token.Lookup(id).IsKeyword()
+	default:
+		return jsReserved[id]
+	}
+}
+
+// EntryName is the entry point's name in lang
+func (s *Signature) EntryName(lang string) string {
+	return identifier(lang, s.Name)
+}
+
+// typeName spells a signature type in lang: a Go type, a Python
+// annotation or a JSDoc type
+func typeName(lang, t string) string {
+	if elem, ok := strings.CutSuffix(t, "[]"); ok {
+		switch dialect(lang) {
+		case LangGo:
+			return "[]" + typeName(lang, elem)
+		case LangPython:
+			return "list[" + typeName(lang, elem) + "]"
+		default:
+			return typeName(lang, elem) + "[]"
+		}
+	}
+	names := map[string]map[string]string{
+		LangGo:         {SchemaInt: "int", SchemaFloat: "float64", SchemaBool: "bool", SchemaString: "string"},
+		LangPython:     {SchemaInt: "int", SchemaFloat: "float", SchemaBool: "bool", SchemaString: "str"},
+		LangJavaScript: {SchemaInt: "number", SchemaFloat: "number", SchemaBool: "boolean", SchemaString: "string"},
+	}
+	return names[dialect(lang)][t]
+}
+
+// goZero is the zero value a Go stub returns for a signature type
+func goZero(t string) string {
+	switch t {
+	case SchemaInt, SchemaFloat:
+		return "0"
+	case SchemaBool:
+		return "false"
+	case SchemaString:
+		return `""`
+	}
+	return "nil"
+}
+
+// Starter generates starter code in lang: the entry point with typed
+// parameters and an empty body
+func (s *Signature) Starter(lang string) string {
+	var params []string
+	for _, p := range s.Params {
+		params = append(params, identifier(lang, p.Name))
+	}
+	name := s.EntryName(lang)
+
+	var b strings.Builder
+	switch dialect(lang) {
+	case LangPython:
+		typed := make([]string, len(params))
+		for i, p := range s.Params {
+			typed[i] = params[i] + ": " + typeName(lang, p.Type)
+		}
+		returns := "None"
+		if s.Returns != "" {
+			returns = typeName(lang, s.Returns)
+		}
+		fmt.Fprintf(&b, "def %s(%s) -> %s:\n    # Your code here\n    pass\n", name, strings.Join(typed, ", "), returns)
+	case LangGo:
+		typed := make([]string, len(params))
+		for i, p := range s.Params {
+			typed[i] = params[i] + " " + typeName(lang, p.Type)
+		}
+		fmt.Fprintf(&b, "func %s(%s)", name, strings.Join(typed, ", "))
+		if s.Returns != "" {
+			fmt.Fprintf(&b, " %s {\n\t// Your code here\n\treturn %s\n}\n", typeName(lang, s.Returns), goZero(s.Returns))
+		} else {
+			b.WriteString(" {\n\t// Your code here\n}\n")
+		}
+	default:
+		b.WriteString("/**\n")
+		for i, p := range s.Params {
+			fmt.Fprintf(&b, " * @param {%s} %s\n", typeName(lang, p.Type), params[i])
+		}
+		if s.Returns != "" {
+			fmt.Fprintf(&b, " * @returns {%s}\n", typeName(lang, s.Returns))
+		}
+		fmt.Fprintf(&b, " */\nfunction %s(%s) {\n  // Your code here\n}\n", name, strings.Join(params, ", "))
+	}
+	return b.String()
+}
+
+// adapterTypes lists the parameter types and the return type for a
+// driver's adapters, as JSON
+func (s *Signature) adapterTypes() (string, string) {
+	params := make([]string, len(s.Params))
+	for i, p := range s.Params {
+		params[i] = p.Type
+	}
+	return toJSON(params), toJSON(s.Returns)
+}
@@ -0,0 +1,495 @@
+package sandbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"hash/fnv"
+	"log"
+	"sort"
+	"time"
+)
+
+// Winnowing parameters. Fingerprints are hashes of similarityK consecutive
+// normalized tokens, and the smallest of every similarityW consecutive
+// hashes is kept, so any shared run of at least K+W-1 tokens is caught.
+const (
+	similarityK = 5
+	similarityW = 4
+)
+
+// Similarity thresholds
+const (
+	// DefaultSimilarityThreshold is the score from which two submissions
+	// are reported as likely copies
+	DefaultSimilarityThreshold = 0.8
+
+	// MinSimilarityThreshold is the lowest score kept, so reports can use
+	// a lower threshold than the default
+	MinSimilarityThreshold = 0.5
+
+	// minOwnFingerprints is how many fingerprints a submission must have
+	// beyond the starter code and reference solution to be compared at all.
+	// Fewer means it is essentially the starter or the reference.
+	minOwnFingerprints = 4
+)
+
+// JavaScript reserved words, kept when identifiers are stripped
+var jsReserved = map[string]bool{
+	"async": true, "await": true, "break": true, "case": true, "catch": true, "class": true,
+	"const": true, "continue": true, "debugger": true, "default": true, "delete": true, "do": true,
+	"else": true, "export": true, "extends": true, "false": true, "finally": true, "for": true,
+	"function": true, "if": true, "import": true, "in": true, "instanceof": true, "let": true,
+	"new": true, "null": true, "of": true, "return": true, "static": true, "super": true,
+	"switch": true, "this": true, "throw": true, "true": true, "try": true, "typeof": true,
+	"undefined": true, "var": true, "void": true, "while": true, "with": true, "yield": true,
+}
+
+// Python keywords, kept when identifiers are stripped
+var pyReserved = map[string]bool{
+	"False": true, "None": true, "True": true, "and": true, "as": true, "assert": true,
+	"async": true, "await": true, "break": true, "class": true, "continue": true, "def": true,
+	"del": true, "elif": true, "else": true, "except": true, "finally": true, "for": true,
+	"from": true, "global": true, "if": true, "import": true, "in": true, "is": true,
+	"lambda": true, "nonlocal": true, "not": true, "or": true, "pass": true, "raise": true,
+	"return": true, "try": true, "while": true, "with": true, "yield": true,
+}
+
+// normalizeCode reduces a program to the tokens that survive renaming and
+// reformatting: comments, whitespace and semicolons are dropped, every
+// identifier becomes "v" and every literal its kind. Keywords and
+// operators stay.
+func normalizeCode(lang, code string) []string {
+	var out []string
+	if dialect(lang) == LangGo {
+		var s scanner.Scanner
+		fset := token.NewFileSet()
+		s.Init(fset.AddFile("main.go", -1, len(code)), []byte(code), nil, 0)
+		for {
+			_, tok, _ := s.Scan()
+			switch {
+			case tok == token.EOF:
+				return out
+			case tok == token.SEMICOLON:
+				// Optional wherever a line break would do
+			case tok == token.IDENT:
+				out = append(out, "v")
+			case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+				out = append(out, "n")
+			case tok == token.CHAR || tok == token.STRING:
+				out = append(out, "s")
+			default:
+				out = append(out, tok.String())
+			}
+		}
+	}
+
+	toks, reserved := jsTokens(code), jsReserved
+	if dialect(lang) == LangPython {
+		toks, reserved = pyTokens(code), pyReserved
+	}
+	for _, t := range toks {
+		switch t.kind {
+		case tokIdent:
+			if reserved[t.text] {
+				out = append(out, t.text)
+			} else {
+				out = append(out, "v")
+			}
+		case tokString:
+			out = append(out, "s")
+		case tokNumber:
+			out = append(out, "n")
+		case tokRegexp:
+			out = append(out, "r")
+		case tokPunct:
+			if t.text != ";" {
+				out = append(out, t.text)
+			}
+		}
+	}
+	return out
+}
+
+// fingerprint winnows the hashes of a program's token k-grams
+func fingerprint(lang, code string) map[uint64]bool {
+	toks := normalizeCode(lang, code)
+	if len(toks) == 0 {
+		return map[uint64]bool{}
+	}
+
+	k := similarityK
+	if len(toks) < k {
+		k = len(toks)
+	}
+	hashes := make([]uint64, 0, len(toks)-k+1)
+	for i := 0; i+k <= len(toks); i++ {
+		h := fnv.New64a()
+		for _, t := range toks[i : i+k] {
+			h.Write([]byte(t))
+			h.Write([]byte{0})
+		}
+		hashes = append(hashes, h.Sum64())
+	}
+
+	w := similarityW
+	if len(hashes) < w {
+		w = len(hashes)
+	}
+	prints := map[uint64]bool{}
+	for i := 0; i+w <= len(hashes); i++ {
+		min := i
+		for j := i + 1; j < i+w; j++ {
+			// The rightmost minimum, as in the winnowing paper
+			if hashes[j] <= hashes[min] {
+				min = j
+			}
+		}
+		prints[hashes[min]] = true
+	}
+	return prints
+}
+
+// SimilarityAnalyzer compares learners' passing submissions in the
+// background, storing pairs that look copied in submission_similarity
+type SimilarityAnalyzer struct {
+	db       *sql.DB
+	interval time.Duration
+}
+
+// NewSimilarityAnalyzer creates an analyzer that looks for new submissions
+// every interval
+func NewSimilarityAnalyzer(db *sql.DB, interval time.Duration) *SimilarityAnalyzer {
+	return &SimilarityAnalyzer{db: db, interval: interval}
+}
+
+// Run analyzes stale exercises now and then every interval until ctx is
+// done
+func (a *SimilarityAnalyzer) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		if err := a.AnalyzeStale(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Similarity analysis failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// similarityGroup is the passing submissions to one exercise in one
+// language
+type similarityGroup struct {
+	exerciseID  string
+	language    string
+	submissions int
+	latest      string
+}
+
+// AnalyzeStale analyzes every exercise and language whose passing
+// submissions changed since it was last analyzed
+func (a *SimilarityAnalyzer) AnalyzeStale(ctx context.Context) error {
+	rows, err := a.db.QueryContext(ctx, `
+		SELECT a.exercise_id, a.language, COUNT(*), MAX(a.created_at)
+		FROM exercise_attempts a
+		LEFT JOIN similarity_analyses s ON s.exercise_id = a.exercise_id AND s.language = a.language
+		WHERE a.kind = ? AND a.passed = 1
+		GROUP BY a.exercise_id, a.language
+		HAVING MAX(s.submissions) IS NULL OR MAX(s.submissions) != COUNT(*) OR MAX(s.latest_attempt_at) != MAX(a.created_at)
+	`, AttemptSubmit)
+	if err != nil {
+		return fmt.Errorf("failed to list submissions: %w", err)
+	}
+	var stale []similarityGroup
+	for rows.Next() {
+		var g similarityGroup
+		if err := rows.Scan(&g.exerciseID, &g.language, &g.submissions, &g.latest); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to list submissions: %w", err)
+		}
+		stale = append(stale, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list submissions: %w", err)
+	}
+
+	for _, g := range stale {
+		if err := a.analyze(ctx, g); err != nil {
+			return fmt.Errorf("%s [%s]: %w", g.exerciseID, g.language, err)
+		}
+	}
+	return nil
+}
+
+// submissionPrints is a learner's latest passing submission, fingerprinted
+type submissionPrints struct {
+	attemptID string
+	userID    string
+	prints    map[uint64]bool
+}
+
+// analyze compares each learner's latest passing submission with every
+// other learner's and replaces the group's stored pairs
+func (a *SimilarityAnalyzer) analyze(ctx context.Context, g similarityGroup) error {
+	// Fingerprints of the starter code and reference solution are common to
+	// honest solutions, so they never count as shared
+	base := map[uint64]bool{}
+	var starter, solution sql.NullString
+	err := a.db.QueryRowContext(ctx, `
+		SELECT starter_code, solution_code FROM exercise_starter_code
+		WHERE exercise_id = ? AND language = ?
+	`, g.exerciseID, g.language).Scan(&starter, &solution)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to load starter code: %w", err)
+	}
+	for _, code := range []string{starter.String, solution.String} {
+		for h := range fingerprint(g.language, code) {
+			base[h] = true
+		}
+	}
+
+	rows, err := a.db.QueryContext(ctx, `
+		SELECT id, user_id, code FROM exercise_attempts
+		WHERE exercise_id = ? AND language = ? AND kind = ? AND passed = 1
+		ORDER BY user_id, created_at DESC, id DESC
+	`, g.exerciseID, g.language, AttemptSubmit)
+	if err != nil {
+		return fmt.Errorf("failed to load submissions: %w", err)
+	}
+	var subs []submissionPrints
+	for rows.Next() {
+		var s submissionPrints
+		var code string
+		if err := rows.Scan(&s.attemptID, &s.userID, &code); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to load submissions: %w", err)
+		}
+		if len(subs) > 0 && subs[len(subs)-1].userID == s.userID {
+			continue // an older submission by the same learner
+		}
+		s.prints = fingerprint(g.language, code)
+		for h := range base {
+			delete(s.prints, h)
+		}
+		subs = append(subs, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load submissions: %w", err)
+	}
+
+	pairs := similarPairs(subs)
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := tx.Exec("DELETE FROM submission_similarity WHERE exercise_id = ? AND language = ?", g.exerciseID, g.language); err != nil {
+		return fmt.Errorf("failed to clear similarity: %w", err)
+	}
+	for _, p := range pairs {
+		_, err := tx.Exec(`
+			INSERT INTO submission_similarity (exercise_id, language, attempt_a, attempt_b, user_a, user_b, score, shared, computed_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, g.exerciseID, g.language, subs[p.a].attemptID, subs[p.b].attemptID, subs[p.a].userID, subs[p.b].userID, p.score, p.shared, now)
+		if err != nil {
+			return fmt.Errorf("failed to store similarity: %w", err)
+		}
+	}
+	_, err = tx.Exec(`
+		INSERT INTO similarity_analyses (exercise_id, language, submissions, latest_attempt_at, analyzed_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(exercise_id, language) DO UPDATE SET
+			submissions = excluded.submissions, latest_attempt_at = excluded.latest_attempt_at, analyzed_at = excluded.analyzed_at
+	`, g.exerciseID, g.language, g.submissions, g.latest, now)
+	if err != nil {
+		return fmt.Errorf("failed to record analysis: %w", err)
+	}
+	return tx.Commit()
+}
+
+// similarPair is two submissions, by index, and how alike they are
+type similarPair struct {
+	a, b   int
+	shared int
+	score  float64
+}
+
+// similarPairs scores every pair of submissions that share fingerprints
+// by the Jaccard index of their fingerprint sets, keeping those scoring at
+// least MinSimilarityThreshold. An inverted index means submissions with
+// nothing in common are never compared.
+func similarPairs(subs []submissionPrints) []similarPair {
+	index := map[uint64][]int{}
+	for i, s := range subs {
+		if len(s.prints) < minOwnFingerprints {
+			continue
+		}
+		for h := range s.prints {
+			index[h] = append(index[h], i)
+		}
+	}
+
+	var pairs []similarPair
+	for i, s := range subs {
+		if len(s.prints) < minOwnFingerprints {
+			continue
+		}
+		shared := map[int]int{}
+		for h := range s.prints {
+			for _, j := range index[h] {
+				if j > i {
+					shared[j]++
+				}
+			}
+		}
+		for j, n := range shared {
+			score := float64(n) / float64(len(s.prints)+len(subs[j].prints)-n)
+			if score >= MinSimilarityThreshold {
+				pairs = append(pairs, similarPair{a: i, b: j, shared: n, score: score})
+			}
+		}
+	}
+	return pairs
+}
+
+// SimilarSubmission is one member of a SimilarityCluster
+type SimilarSubmission struct {
+	AttemptID   string `json:"attemptId"`
+	UserID      string `json:"userId"`
+	DisplayName string `json:"displayName"`
+	Email       string `json:"email"`
+	SubmittedAt string `json:"submittedAt"`
+}
+
+// SimilarPair is two submissions in a cluster and their similarity, the
+// share of their fingerprints they have in common
+type SimilarPair struct {
+	AttemptA string  `json:"attemptA"`
+	AttemptB string  `json:"attemptB"`
+	Score    float64 `json:"score"`
+	Shared   int     `json:"shared"`
+}
+
+// SimilarityCluster is a group of submissions to one exercise linked by
+// pairs scoring at least the requested threshold
+type SimilarityCluster struct {
+	ExerciseID    string              `json:"exerciseId"`
+	ExerciseTitle string              `json:"exerciseTitle"`
+	Language      string              `json:"language"`
+	MaxScore      float64             `json:"maxScore"`
+	Members       []SimilarSubmission `json:"members"`
+	Pairs         []SimilarPair       `json:"pairs"`
+	AnalyzedAt    string              `json:"analyzedAt"`
+}
+
+// SimilarityClusters groups the stored pairs scoring at least threshold
+// into clusters, most similar first. exerciseID and lang narrow the report
+// when set.
+func SimilarityClusters(db *sql.DB, exerciseID, lang string, threshold float64) ([]SimilarityCluster, error) {
+	rows, err := db.Query(`
+		SELECT s.exercise_id, e.title, s.language, s.attempt_a, s.attempt_b, s.score, s.shared, s.computed_at
+		FROM submission_similarity s
+		JOIN exercises e ON e.id = s.exercise_id
+		WHERE s.score >= ? AND (? = '' OR s.exercise_id = ?) AND (? = '' OR s.language = ?)
+		ORDER BY s.exercise_id, s.language, s.score DESC
+	`, threshold, exerciseID, exerciseID, lang, lang)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load similarity: %w", err)
+	}
+	defer rows.Close()
+
+	// Union-find over attempts; pairs never cross exercises or languages
+	parent := map[string]string{}
+	var find func(string) string
+	find = func(id string) string {
+		if parent[id] == "" || parent[id] == id {
+			parent[id] = id
+			return id
+		}
+		root := find(parent[id])
+		parent[id] = root
+		return root
+	}
+
+	type linked struct {
+		cluster SimilarityCluster
+		pair    SimilarPair
+	}
+	var all []linked
+	for rows.Next() {
+		var l linked
+		c, p := &l.cluster, &l.pair
+		if err := rows.Scan(&c.ExerciseID, &c.ExerciseTitle, &c.Language, &p.AttemptA, &p.AttemptB, &p.Score, &p.Shared, &c.AnalyzedAt); err != nil {
+			return nil, fmt.Errorf("failed to load similarity: %w", err)
+		}
+		parent[find(p.AttemptA)] = find(p.AttemptB)
+		all = append(all, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load similarity: %w", err)
+	}
+
+	byRoot := map[string]*SimilarityCluster{}
+	var roots []string
+	for _, l := range all {
+		root := find(l.pair.AttemptA)
+		c, ok := byRoot[root]
+		if !ok {
+			c = &SimilarityCluster{
+				ExerciseID:    l.cluster.ExerciseID,
+				ExerciseTitle: l.cluster.ExerciseTitle,
+				Language:      l.cluster.Language,
+				AnalyzedAt:    l.cluster.AnalyzedAt,
+			}
+			byRoot[root] = c
+			roots = append(roots, root)
+		}
+		c.Pairs = append(c.Pairs, l.pair)
+		if l.pair.Score > c.MaxScore {
+			c.MaxScore = l.pair.Score
+		}
+	}
+
+	clusters := make([]SimilarityCluster, 0, len(roots))
+	for _, root := range roots {
+		c := byRoot[root]
+		seen := map[string]bool{}
+		for _, p := range c.Pairs {
+			for _, id := range []string{p.AttemptA, p.AttemptB} {
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+				m := SimilarSubmission{AttemptID: id}
+				err := db.QueryRow(`
+					SELECT a.user_id, u.display_name, u.email, a.created_at
+					FROM exercise_attempts a JOIN users u ON u.id = a.user_id
+					WHERE a.id = ?
+				`, id).Scan(&m.UserID, &m.DisplayName, &m.Email, &m.SubmittedAt)
+				if err != nil {
+					return nil, fmt.Errorf("failed to load submission %s: %w", id, err)
+				}
+				c.Members = append(c.Members, m)
+			}
+		}
+		sort.Slice(c.Members, func(i, j int) bool { return c.Members[i].SubmittedAt < c.Members[j].SubmittedAt })
+		clusters = append(clusters, *c)
+	}
+	sort.SliceStable(clusters, func(i, j int) bool {
+		if clusters[i].MaxScore != clusters[j].MaxScore {
+			return clusters[i].MaxScore > clusters[j].MaxScore
+		}
+		return len(clusters[i].Members) > len(clusters[j].Members)
+	})
+	return clusters, nil
+}
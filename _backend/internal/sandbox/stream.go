@@ -0,0 +1,109 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Server-Sent Events emitted by the streaming endpoints
+const (
+	EventStdout   = "stdout"   // {"data": "..."} chunk of program output
+	EventStderr   = "stderr"   // {"data": "..."} chunk of program errors
+	EventProgress = "progress" // {"index", "total", "id", "name"} before a test case runs
+	EventTest     = "test"     // TestResult after a test case finishes
+	EventDone     = "done"     // the endpoint's usual JSON response
+	EventError    = "error"    // the endpoint's error response when the run could not complete
+)
+
+// wantsStream reports whether the client opted into Server-Sent Events
+func wantsStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// eventStream writes Server-Sent Events. send is safe to call from
+// several goroutines, since stdout and stderr arrive concurrently.
+type eventStream struct {
+	mu sync.Mutex
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// newEventStream sends the SSE headers and returns a stream to write to
+func newEventStream(w http.ResponseWriter) *eventStream {
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	s := &eventStream{w: w, rc: http.NewResponseController(w)}
+	s.rc.Flush()
+	return s
+}
+
+// send writes one event with a JSON payload and flushes it
+func (s *eventStream) send(event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// output forwards program output as stdout/stderr events
+func (s *eventStream) output(stream string, data []byte) {
+	event := EventStdout
+	if stream == StreamStderr {
+		event = EventStderr
+	}
+	s.send(event, map[string]string{"data": string(data)})
+}
+
+// progress announces a test case before it runs
+func (s *eventStream) progress(index, total int, tc TestCase) {
+	s.send(EventProgress, map[string]interface{}{
+		"index": index,
+		"total": total,
+		"id":    tc.ID,
+		"name":  tc.Name,
+	})
+}
+
+// reply writes an endpoint's final response: as JSON, or as a done/error
+// event once streaming has started
+func reply(w http.ResponseWriter, stream *eventStream, status int, v interface{}) {
+	if stream == nil {
+		writeJSON(w, status, v)
+		return
+	}
+	event := EventDone
+	if status != http.StatusOK {
+		event = EventError
+	}
+	stream.send(event, v)
+}
+
+// hooks returns the test case hooks that report progress on the stream.
+// Hidden cases are redacted before they are sent.
+func (s *eventStream) hooks(total int) caseHooks {
+	if s == nil {
+		return caseHooks{}
+	}
+	return caseHooks{
+		before: func(index int, tc TestCase) { s.progress(index, total, tc) },
+		after: func(index int, result TestResult) {
+			redactResult(&result)
+			s.send(EventTest, result)
+		},
+	}
+}
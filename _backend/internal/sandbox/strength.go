@@ -0,0 +1,1025 @@
+package sandbox
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Strength metrics reported in StrengthMetric.Name
+const (
+	MetricNaming         = "naming"
+	MetricNesting        = "nesting"
+	MetricFunctionLength = "functionLength"
+	MetricMagicNumbers   = "magicNumbers"
+	MetricDeadCode       = "deadCode"
+	MetricComments       = "comments"
+)
+
+// Strength thresholds
+const (
+	maxNestingDepth    = 3  // control blocks inside one another before it hurts
+	maxFunctionLines   = 30 // code lines in a function body
+	minCommentedLines  = 10 // programs shorter than this need no comments
+	maxStrengthFinding = 5  // findings listed per metric; all of them count
+)
+
+// StrengthReport scores how a submission is written, independent of
+// whether it passes. Score is the mean of the metric scores.
+type StrengthReport struct {
+	Score   int              `json:"score"`
+	Metrics []StrengthMetric `json:"metrics"`
+}
+
+// StrengthMetric is one 0-100 sub-score with what to change
+type StrengthMetric struct {
+	Name         string            `json:"name"`
+	Score        int               `json:"score"`
+	Findings     []StrengthFinding `json:"findings,omitempty"`
+	BestPractice string            `json:"bestPractice,omitempty"` // from the exercise's primitive
+}
+
+// StrengthFinding is an actionable note about one place in the code
+type StrengthFinding struct {
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// Keywords relating a metric to a primitive's best practices
+var metricPractices = map[string][]string{
+	MetricNaming:         {"name", "naming"},
+	MetricNesting:        {"nest", "early return"},
+	MetricFunctionLength: {"short", "focused", "single responsibility", "one job"},
+	MetricMagicNumbers:   {"magic", "constant", "const"},
+	MetricDeadCode:       {"unreachable", "unused", "dead code"},
+	MetricComments:       {"comment", "document"},
+}
+
+// analyzeStrength statically scores code. It returns nil when the code
+// cannot be analyzed, such as Go that does not parse.
+func analyzeStrength(lang, code, starter, entry string, bestPractices []string) *StrengthReport {
+	var facts *codeFacts
+	switch dialect(lang) {
+	case LangGo:
+		facts = goFacts(code)
+	case LangJavaScript:
+		facts = jsFacts(code)
+	case LangPython:
+		facts = pyFacts(code)
+	}
+	if facts == nil {
+		return nil
+	}
+	facts.findUnused(entry)
+
+	// Names the starter code chose are not the learner's to answer for
+	exempt := map[string]bool{}
+	for _, name := range wordPattern.FindAllString(starter, -1) {
+		exempt[name] = true
+	}
+
+	metrics := []StrengthMetric{
+		facts.naming(lang, exempt),
+		facts.nesting(),
+		facts.functionLength(),
+		facts.magicNumbers(),
+		facts.deadCode(),
+		facts.comments(),
+	}
+
+	report := &StrengthReport{Metrics: metrics}
+	total := 0
+	for i := range report.Metrics {
+		m := &report.Metrics[i]
+		total += m.Score
+		if m.Score < 100 {
+			m.BestPractice = linkPractice(m.Name, bestPractices)
+		}
+		if len(m.Findings) > maxStrengthFinding {
+			m.Findings = m.Findings[:maxStrengthFinding]
+		}
+	}
+	report.Score = int(math.Round(float64(total) / float64(len(metrics))))
+	return report
+}
+
+var wordPattern = regexp.MustCompile(`[A-Za-z_]\w*`)
+
+// linkPractice picks the first best practice that speaks to a metric
+func linkPractice(metric string, practices []string) string {
+	for _, p := range practices {
+		lower := strings.ToLower(p)
+		for _, kw := range metricPractices[metric] {
+			if strings.Contains(lower, kw) {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// codeFacts is what the language front ends extract for scoring
+type codeFacts struct {
+	names        []declaredName
+	nestDepth    int // deepest control block nesting
+	nestLine     int
+	funcs        []funcSpan
+	numbers      []numberLit
+	dead         []StrengthFinding
+	calls        map[string]int // identifier occurrences, declarations included
+	codeLines    map[int]bool
+	commentLines map[int]bool
+}
+
+func newCodeFacts() *codeFacts {
+	return &codeFacts{calls: map[string]int{}, codeLines: map[int]bool{}, commentLines: map[int]bool{}}
+}
+
+// Kinds of declared names
+const (
+	nameVar = iota
+	nameConst
+	nameParam
+	nameLoop // loop counters and lambda parameters, where short is fine
+	nameFunc
+	nameType
+)
+
+type declaredName struct {
+	name string
+	kind int
+	line int
+}
+
+type funcSpan struct {
+	name     string
+	line     int
+	first    int // first and last line of the body
+	last     int
+	topLevel bool
+}
+
+type numberLit struct {
+	text string
+	line int
+}
+
+func (f *codeFacts) declare(name string, kind, line int) {
+	if name != "" && name != "_" {
+		f.names = append(f.names, declaredName{name, kind, line})
+	}
+}
+
+func (f *codeFacts) nested(depth, line int) {
+	if depth > f.nestDepth {
+		f.nestDepth, f.nestLine = depth, line
+	}
+}
+
+func (f *codeFacts) unreachable(line int, after string) {
+	f.dead = append(f.dead, StrengthFinding{Line: line, Message: fmt.Sprintf("This code never runs because it follows %s; remove it", after)})
+}
+
+func (f *codeFacts) neverTrue(line int, cond string) {
+	f.dead = append(f.dead, StrengthFinding{Line: line, Message: fmt.Sprintf("The condition is always %s, so this block never runs", cond)})
+}
+
+func (f *codeFacts) markLines(lines map[int]bool, first, last int) {
+	for l := first; l <= last; l++ {
+		lines[l] = true
+	}
+}
+
+// findUnused reports top-level functions nothing refers to. The entry
+// point is called by the grader.
+func (f *codeFacts) findUnused(entry string) {
+	for _, fn := range f.funcs {
+		if !fn.topLevel || fn.name == entry || fn.name == "main" || fn.name == "init" || strings.HasPrefix(fn.name, "__") {
+			continue
+		}
+		if f.calls[fn.name] <= 1 {
+			f.dead = append(f.dead, StrengthFinding{Line: fn.line, Message: fmt.Sprintf("%s is never called; remove it or use it", fn.name)})
+		}
+	}
+}
+
+// Names that say nothing about what they hold
+var vagueNames = map[string]bool{
+	"asdf": true, "bar": true, "baz": true, "blah": true, "foo": true, "qux": true,
+	"stuff": true, "temp": true, "thing": true, "things": true, "tmp": true, "xyz": true,
+}
+
+func (f *codeFacts) naming(lang string, exempt map[string]bool) StrengthMetric {
+	m := StrengthMetric{Name: MetricNaming}
+	seen := map[string]bool{}
+	for _, d := range f.names {
+		if seen[d.name] || exempt[d.name] {
+			continue
+		}
+		seen[d.name] = true
+
+		switch {
+		case utf8.RuneCountInString(d.name) == 1 && d.kind != nameLoop:
+			what := "holds"
+			if d.kind == nameFunc {
+				what = "does"
+			}
+			m.Findings = append(m.Findings, StrengthFinding{Line: d.line, Message: fmt.Sprintf("Rename %s to say what it %s; single letters suit loop counters only", d.name, what)})
+		case vagueNames[strings.ToLower(d.name)]:
+			m.Findings = append(m.Findings, StrengthFinding{Line: d.line, Message: fmt.Sprintf("%s doesn't say what it holds; pick a name from the problem", d.name)})
+		default:
+			if want := conventionalName(dialect(lang), d); want != "" && want != d.name {
+				m.Findings = append(m.Findings, StrengthFinding{Line: d.line, Message: fmt.Sprintf("Rename %s to %s to follow %s naming conventions", d.name, want, languageName(lang))})
+			}
+		}
+	}
+	m.Score = clampScore(100 - 15*len(m.Findings))
+	return m
+}
+
+// conventionalName returns the idiomatic spelling of a name, or "" when
+// the name is already fine
+func conventionalName(lang string, d declaredName) string {
+	upper := strings.ToUpper(d.name) == d.name
+	switch lang {
+	case LangGo:
+		if strings.Contains(strings.Trim(d.name, "_"), "_") {
+			return camelCase(d.name)
+		}
+	case LangJavaScript:
+		if strings.Contains(strings.Trim(d.name, "_"), "_") && !(upper && d.kind == nameConst) {
+			return camelCase(d.name)
+		}
+	case LangPython:
+		if d.kind == nameType {
+			if r, _ := utf8.DecodeRuneInString(d.name); unicode.IsLower(r) {
+				return strings.ToUpper(d.name[:1]) + d.name[1:]
+			}
+			return ""
+		}
+		if !upper && strings.ToLower(d.name) != d.name {
+			return snakeCase(d.name)
+		}
+	}
+	return ""
+}
+
+func languageName(lang string) string {
+	for _, l := range Languages() {
+		if l.ID == lang {
+			return l.Name
+		}
+	}
+	return lang
+}
+
+// camelCase joins snake_case words; MAX_SIZE becomes MaxSize
+func camelCase(name string) string {
+	var b strings.Builder
+	for i, word := range strings.Split(strings.Trim(name, "_"), "_") {
+		if word == "" {
+			continue
+		}
+		word = strings.ToLower(word)
+		if i > 0 || unicode.IsUpper(rune(strings.TrimLeft(name, "_")[0])) {
+			word = strings.ToUpper(word[:1]) + word[1:]
+		}
+		b.WriteString(word)
+	}
+	return b.String()
+}
+
+// snakeCase splits camelCase words; maxSize becomes max_size
+func snakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && runes[i-1] != '_' && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (f *codeFacts) nesting() StrengthMetric {
+	m := StrengthMetric{Name: MetricNesting, Score: 100}
+	if f.nestDepth > maxNestingDepth {
+		m.Score = clampScore(100 - 25*(f.nestDepth-maxNestingDepth))
+		m.Findings = []StrengthFinding{{
+			Line:    f.nestLine,
+			Message: fmt.Sprintf("Blocks are nested %d deep here; return early or move the inner loop into a helper function", f.nestDepth),
+		}}
+	}
+	return m
+}
+
+func (f *codeFacts) functionLength() StrengthMetric {
+	m := StrengthMetric{Name: MetricFunctionLength}
+	for _, fn := range f.funcs {
+		n := 0
+		for l := fn.first; l <= fn.last; l++ {
+			if f.codeLines[l] {
+				n++
+			}
+		}
+		if n > maxFunctionLines {
+			m.Findings = append(m.Findings, StrengthFinding{
+				Line:    fn.line,
+				Message: fmt.Sprintf("%s is %d lines long; split it into smaller functions that each do one job", fn.name, n),
+			})
+		}
+	}
+	m.Score = clampScore(100 - 25*len(m.Findings))
+	return m
+}
+
+// Numbers that explain themselves
+var plainNumbers = map[string]bool{
+	"0": true, "1": true, "2": true, "10": true, "0.0": true, "1.0": true, "0.5": true,
+}
+
+func (f *codeFacts) magicNumbers() StrengthMetric {
+	m := StrengthMetric{Name: MetricMagicNumbers}
+	seen := map[string]bool{}
+	for _, n := range f.numbers {
+		text := strings.ToLower(strings.ReplaceAll(n.text, "_", ""))
+		if plainNumbers[text] || seen[text] {
+			continue
+		}
+		seen[text] = true
+		m.Findings = append(m.Findings, StrengthFinding{
+			Line:    n.line,
+			Message: fmt.Sprintf("Give %s a named constant that says what it means", n.text),
+		})
+	}
+	m.Score = clampScore(100 - 10*len(m.Findings))
+	return m
+}
+
+func (f *codeFacts) deadCode() StrengthMetric {
+	return StrengthMetric{Name: MetricDeadCode, Score: clampScore(100 - 25*len(f.dead)), Findings: f.dead}
+}
+
+func (f *codeFacts) comments() StrengthMetric {
+	m := StrengthMetric{Name: MetricComments, Score: 100}
+	code := 0
+	for l := range f.codeLines {
+		if !f.commentLines[l] {
+			code++
+		}
+	}
+	comments := len(f.commentLines)
+	switch {
+	case code < minCommentedLines:
+	case comments == 0:
+		m.Score = 70
+		m.Findings = []StrengthFinding{{Message: "Add a short comment explaining your approach or the trickiest step"}}
+	case comments > code:
+		m.Score = 80
+		m.Findings = []StrengthFinding{{Message: "Comments outnumber code; let clear names carry the meaning and keep comments for the why"}}
+	}
+	return m
+}
+
+func clampScore(score int) int {
+	if score < 0 {
+		return 0
+	}
+	return score
+}
+
+// goFacts walks the AST of a Go program
+func goFacts(code string) *codeFacts {
+	src := goSource(code)
+	offset := strings.Count(src, "\n") - strings.Count(code, "\n")
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+	line := func(p token.Pos) int { return fset.Position(p).Line - offset }
+
+	f := newCodeFacts()
+
+	// Lines of code and comment, from the raw token stream
+	var s scanner.Scanner
+	tf := token.NewFileSet().AddFile("main.go", -1, len(src))
+	s.Init(tf, []byte(src), nil, scanner.ScanComments)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue
+		}
+		l := tf.Line(pos) - offset
+		if l < 1 {
+			continue
+		}
+		if tok == token.COMMENT {
+			f.markLines(f.commentLines, l, l+strings.Count(lit, "\n"))
+		} else {
+			f.codeLines[l] = true
+		}
+	}
+
+	loopVars := map[*ast.Ident]bool{}
+	type frame struct {
+		node  ast.Node
+		depth int
+	}
+	var stack []frame
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		depth := 0
+		var parent ast.Node
+		if len(stack) > 0 {
+			depth, parent = stack[len(stack)-1].depth, stack[len(stack)-1].node
+		}
+
+		switch n := n.(type) {
+		case *ast.Ident:
+			f.calls[n.Name]++
+		case *ast.FuncDecl:
+			f.declare(n.Name.Name, nameFunc, line(n.Name.Pos()))
+			if n.Body != nil {
+				f.funcs = append(f.funcs, funcSpan{
+					name: n.Name.Name, line: line(n.Pos()),
+					first: line(n.Body.Lbrace) + 1, last: line(n.Body.Rbrace) - 1,
+					topLevel: n.Recv == nil,
+				})
+			}
+			goParams(f, n.Type, line)
+		case *ast.FuncLit:
+			goParams(f, n.Type, line)
+		case *ast.GenDecl:
+			for _, spec := range n.Specs {
+				switch spec := spec.(type) {
+				case *ast.ValueSpec:
+					kind := nameVar
+					if n.Tok == token.CONST {
+						kind = nameConst
+					}
+					for _, id := range spec.Names {
+						f.declare(id.Name, kind, line(id.Pos()))
+					}
+				case *ast.TypeSpec:
+					f.declare(spec.Name.Name, nameType, line(spec.Name.Pos()))
+				}
+			}
+			if n.Tok == token.CONST {
+				// Named constants are where numbers belong
+				for _, spec := range n.Specs {
+					for _, id := range spec.(*ast.ValueSpec).Names {
+						f.calls[id.Name]++
+					}
+				}
+				return false
+			}
+		case *ast.AssignStmt:
+			if n.Tok == token.DEFINE {
+				for _, lhs := range n.Lhs {
+					if id, ok := lhs.(*ast.Ident); ok {
+						kind := nameVar
+						if loopVars[id] {
+							kind = nameLoop
+						}
+						f.declare(id.Name, kind, line(id.Pos()))
+					}
+				}
+			}
+		case *ast.ForStmt:
+			if init, ok := n.Init.(*ast.AssignStmt); ok {
+				for _, lhs := range init.Lhs {
+					if id, ok := lhs.(*ast.Ident); ok {
+						loopVars[id] = true
+					}
+				}
+			}
+			if id, ok := n.Cond.(*ast.Ident); ok && id.Name == "false" {
+				f.neverTrue(line(n.Pos()), "false")
+			}
+		case *ast.RangeStmt:
+			if n.Tok == token.DEFINE {
+				for _, e := range []ast.Expr{n.Key, n.Value} {
+					if id, ok := e.(*ast.Ident); ok {
+						f.declare(id.Name, nameLoop, line(id.Pos()))
+					}
+				}
+			}
+		case *ast.IfStmt:
+			if id, ok := n.Cond.(*ast.Ident); ok && id.Name == "false" {
+				f.neverTrue(line(n.Pos()), "false")
+			}
+		case *ast.BasicLit:
+			if n.Kind == token.INT || n.Kind == token.FLOAT || n.Kind == token.IMAG {
+				f.numbers = append(f.numbers, numberLit{n.Value, line(n.Pos())})
+			}
+		case *ast.BlockStmt:
+			goUnreachable(f, n.List, line)
+		case *ast.CaseClause:
+			goUnreachable(f, n.Body, line)
+		case *ast.CommClause:
+			goUnreachable(f, n.Body, line)
+		}
+
+		switch n.(type) {
+		case *ast.IfStmt:
+			// else if continues a chain rather than nesting
+			if p, ok := parent.(*ast.IfStmt); !ok || p.Else != n {
+				depth++
+			}
+		case *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			depth++
+		}
+		f.nested(depth, line(n.Pos()))
+		stack = append(stack, frame{n, depth})
+		return true
+	})
+	return f
+}
+
+func goParams(f *codeFacts, ft *ast.FuncType, line func(token.Pos) int) {
+	for _, list := range []*ast.FieldList{ft.Params, ft.Results} {
+		if list == nil {
+			continue
+		}
+		for _, field := range list.List {
+			for _, id := range field.Names {
+				f.declare(id.Name, nameParam, line(id.Pos()))
+			}
+		}
+	}
+}
+
+// goUnreachable reports the statement after one that never falls through
+func goUnreachable(f *codeFacts, list []ast.Stmt, line func(token.Pos) int) {
+	for i, stmt := range list[:max(len(list)-1, 0)] {
+		after := ""
+		switch s := stmt.(type) {
+		case *ast.ReturnStmt:
+			after = "return"
+		case *ast.BranchStmt:
+			if s.Tok != token.FALLTHROUGH {
+				after = s.Tok.String()
+			}
+		case *ast.ExprStmt:
+			if call, ok := s.X.(*ast.CallExpr); ok {
+				if id, ok := call.Fun.(*ast.Ident); ok && id.Name == "panic" {
+					after = "panic"
+				}
+			}
+		}
+		if _, labeled := list[i+1].(*ast.LabeledStmt); after != "" && !labeled {
+			f.unreachable(line(list[i+1].Pos()), after)
+			return
+		}
+	}
+}
+
+// JavaScript keywords that open a control block with a parenthesized head
+var jsControlHeads = map[string]bool{"if": true, "for": true, "while": true, "switch": true, "catch": true, "with": true}
+
+// JavaScript keywords that cannot name a function or method
+var jsKeywords = map[string]bool{
+	"if": true, "for": true, "while": true, "switch": true, "catch": true, "with": true,
+	"function": true, "return": true, "typeof": true, "new": true, "await": true,
+	"else": true, "do": true, "try": true, "finally": true,
+}
+
+// jsFacts scans JavaScript tokens
+func jsFacts(code string) *codeFacts {
+	f := newCodeFacts()
+	all := jsTokens(code)
+	for _, t := range all {
+		if t.kind == tokComment {
+			f.markLines(f.commentLines, t.line, t.line+strings.Count(t.text, "\n"))
+		} else {
+			f.codeLines[t.line] = true
+		}
+	}
+	toks := significant(all)
+	match := matchBrackets(toks)
+	at := func(i int) lexeme { return tokenAt(toks, i) }
+	isArrow := func(i int) bool {
+		// '=' '>' written together
+		return at(i).text == "=" && at(i+1).text == ">" && at(i+1).line == at(i).line && at(i+1).col == at(i).col+1
+	}
+
+	var blocks []bool // open braces; true for control blocks
+	depth := 0
+	for i, t := range toks {
+		prev := at(i - 1)
+
+		switch t.kind {
+		case tokIdent:
+			f.calls[t.text]++
+			next := at(i + 1)
+			switch {
+			case (t.text == "let" || t.text == "const" || t.text == "var") && next.kind == tokIdent:
+				kind := nameVar
+				if at(i-1).text == "(" && at(i-2).text == "for" {
+					kind = nameLoop
+				} else if t.text == "const" {
+					kind = nameConst
+				}
+				f.declare(next.text, kind, next.line)
+			case t.text == "function":
+				open := i + 1
+				if at(open).text == "*" {
+					open++
+				}
+				if at(open).kind == tokIdent {
+					f.declare(at(open).text, nameFunc, at(open).line)
+					open++
+				}
+				if at(open).text == "(" {
+					jsParams(f, toks, open, match[open], nameParam)
+				}
+			case t.text == "class" && next.kind == tokIdent:
+				f.declare(next.text, nameType, next.line)
+			case (t.text == "if" || t.text == "while") && next.text == "(" && at(i+2).text == "false" && at(i+3).text == ")":
+				f.neverTrue(t.line, "false")
+			case (t.text == "return" || t.text == "throw" || t.text == "break" || t.text == "continue") && jsStatementStart(prev):
+				end := jsStatementEnd(toks, match, i)
+				if next := at(end + 1); end+1 < len(toks) && next.text != "}" && next.text != "case" && next.text != "default" {
+					f.unreachable(next.line, t.text)
+				}
+			}
+		case tokNumber:
+			if !(at(i-1).text == "=" && at(i-3).text == "const" && strings.ToUpper(at(i-2).text) == at(i-2).text) {
+				f.numbers = append(f.numbers, numberLit{t.text, t.line})
+			}
+		case tokPunct:
+			switch t.text {
+			case "=":
+				if isArrow(i) {
+					if p := at(i - 1); p.text == ")" && match[i-1] >= 0 {
+						jsParams(f, toks, match[i-1], i-1, nameLoop)
+					} else if p.kind == tokIdent {
+						f.declare(p.text, nameLoop, p.line)
+					}
+				}
+			case "{":
+				control := false
+				switch {
+				case prev.text == ")" && match[i-1] >= 0:
+					head := at(match[i-1] - 1)
+					control = head.kind == tokIdent && jsControlHeads[head.text]
+				case prev.kind == tokIdent:
+					control = prev.text == "else" || prev.text == "do" || prev.text == "try" || prev.text == "finally"
+				}
+				if name, ok := jsFunctionName(toks, match, i, isArrow); ok && match[i] >= 0 {
+					f.funcs = append(f.funcs, funcSpan{
+						name: name, line: t.line, first: t.line + 1, last: at(match[i]).line - 1,
+						topLevel: depth == 0 && name != "",
+					})
+				}
+				blocks = append(blocks, control)
+				if control {
+					n := 0
+					for _, c := range blocks {
+						if c {
+							n++
+						}
+					}
+					f.nested(n, t.line)
+				}
+				depth++
+			case "}":
+				if len(blocks) > 0 {
+					blocks = blocks[:len(blocks)-1]
+				}
+				depth--
+			}
+		}
+	}
+
+	// Arrow functions and methods are not subject to the unused check
+	for i := range f.funcs {
+		if f.funcs[i].name == "" {
+			f.funcs[i].name = "This function"
+		}
+	}
+	return f
+}
+
+// jsParams declares the parameters between brackets open and close
+func jsParams(f *codeFacts, toks []lexeme, open, close int, kind int) {
+	depth := 0
+	for j := open + 1; j < close && j < len(toks); j++ {
+		t := toks[j]
+		switch t.text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		}
+		if t.kind == tokIdent && depth == 0 {
+			// a, b and ...rest
+			if p := toks[j-1].text; p == "(" || p == "," || p == "." && j >= 3 && toks[j-2].text == "." && toks[j-3].text == "." {
+				f.declare(t.text, kind, t.line)
+			}
+		}
+	}
+}
+
+// jsFunctionName recognizes a brace opening a function body and names the
+// function. Anonymous functions have an empty name.
+func jsFunctionName(toks []lexeme, match []int, brace int, isArrow func(int) bool) (string, bool) {
+	at := func(i int) lexeme { return tokenAt(toks, i) }
+	if brace >= 2 && at(brace-1).text == ">" && isArrow(brace-2) {
+		// const name = (...) => {
+		start := brace - 3
+		if at(start).text == ")" && match[start] >= 0 {
+			start = match[start]
+		}
+		if at(start-1).text == "async" {
+			start--
+		}
+		if at(start-1).text == "=" && at(start-2).kind == tokIdent {
+			return at(start - 2).text, true
+		}
+		return "", true
+	}
+	if at(brace-1).text != ")" || match[brace-1] < 0 {
+		return "", false
+	}
+	open := match[brace-1]
+	before := at(open - 1)
+	switch {
+	case before.text == "function":
+		return "", true
+	case before.kind == tokIdent && at(open-2).text == "function":
+		return before.text, true
+	case before.kind == tokIdent && !jsKeywords[before.text]:
+		// Method shorthand: name(...) {
+		if p := at(open - 2).text; p == "{" || p == "}" || p == ";" || p == "," || p == "static" || p == "async" || p == "get" || p == "set" {
+			return "", true
+		}
+	}
+	return "", false
+}
+
+// jsStatementStart reports whether a keyword after prev begins a statement
+// inside a block, as opposed to the body of a braceless if or else
+func jsStatementStart(prev lexeme) bool {
+	return prev.kind == tokPunct && (prev.text == "" || prev.text == "{" || prev.text == "}" || prev.text == ";" || prev.text == ":")
+}
+
+// jsStatementEnd finds the last lexeme of the statement starting at i,
+// applying automatic semicolon insertion at line breaks
+func jsStatementEnd(toks []lexeme, match []int, i int) int {
+	if i+1 >= len(toks) || toks[i+1].line > toks[i].line {
+		// return, break and continue end at a line break
+		return i
+	}
+	for j := i + 1; j < len(toks); j++ {
+		t := toks[j]
+		switch t.text {
+		case ";":
+			return j
+		case "}", ")", "]":
+			return j - 1
+		case "(", "[", "{":
+			if match[j] < 0 {
+				return len(toks) - 1
+			}
+			j = match[j]
+			continue
+		}
+		if next := tokenAt(toks, j+1); next.line > t.line && jsEndsExpr(t) && !jsContinuesExpr(next) {
+			return j
+		}
+	}
+	return len(toks) - 1
+}
+
+func jsEndsExpr(t lexeme) bool {
+	switch t.kind {
+	case tokIdent, tokNumber, tokString, tokRegexp:
+		return true
+	}
+	return t.text == ")" || t.text == "]" || t.text == "}"
+}
+
+func jsContinuesExpr(t lexeme) bool {
+	return t.kind == tokPunct && strings.Contains(".?:+-*/%=<>&|^,()[]", t.text)
+}
+
+// matchBrackets pairs opening and closing brackets, with -1 for brackets
+// that do not pair up
+func matchBrackets(toks []lexeme) []int {
+	match := make([]int, len(toks))
+	var open []int
+	for i, t := range toks {
+		match[i] = -1
+		if t.kind != tokPunct {
+			continue
+		}
+		switch t.text {
+		case "(", "[", "{":
+			open = append(open, i)
+		case ")", "]", "}":
+			if len(open) > 0 {
+				j := open[len(open)-1]
+				open = open[:len(open)-1]
+				match[i], match[j] = j, i
+			}
+		}
+	}
+	return match
+}
+
+// Python keywords that open control blocks
+var pyControl = map[string]bool{
+	"if": true, "elif": true, "else": true, "for": true, "while": true, "with": true,
+	"try": true, "except": true, "finally": true, "match": true,
+}
+
+// pyFacts scans Python tokens, reading blocks from indentation
+func pyFacts(code string) *codeFacts {
+	f := newCodeFacts()
+	all := pyTokens(code)
+
+	// Split into logical lines
+	var stmts [][]lexeme
+	var cur []lexeme
+	for _, t := range all {
+		switch t.kind {
+		case tokComment:
+			f.markLines(f.commentLines, t.line, t.line)
+			continue
+		case tokNewline:
+			if len(cur) > 0 {
+				stmts = append(stmts, cur)
+			}
+			cur = nil
+			continue
+		case tokIdent:
+			f.calls[t.text]++
+		}
+		f.codeLines[t.line] = true
+		cur = append(cur, t)
+	}
+	if len(cur) > 0 {
+		stmts = append(stmts, cur)
+	}
+
+	type block struct {
+		col     int
+		control bool
+		fn      int // index into f.funcs for def blocks, else -1
+	}
+	var blocks []block
+
+	for si, stmt := range stmts {
+		first := stmt[0]
+		last := stmt[len(stmt)-1]
+		at := func(i int) lexeme { return tokenAt(stmt, i) }
+
+		// Dedent closes blocks and the functions they belong to
+		for len(blocks) > 0 && blocks[len(blocks)-1].col >= first.col {
+			blocks = blocks[:len(blocks)-1]
+		}
+		for _, b := range blocks {
+			if b.fn >= 0 {
+				f.funcs[b.fn].last = last.line
+			}
+		}
+
+		// A docstring is documentation, not code
+		if len(stmt) == 1 && first.kind == tokString && strings.Contains(first.text, "\n") {
+			f.markLines(f.commentLines, first.line, first.line+strings.Count(first.text, "\n"))
+		}
+
+		if pyOpensBlock(stmt) {
+			control := first.kind == tokIdent && pyControl[first.text]
+			fn := -1
+			if first.text == "def" && at(1).kind == tokIdent {
+				fn = len(f.funcs)
+			}
+			blocks = append(blocks, block{first.col, control, fn})
+			if control {
+				n := 0
+				for _, b := range blocks {
+					if b.control {
+						n++
+					}
+				}
+				f.nested(n, first.line)
+			}
+		}
+
+		switch first.text {
+		case "def":
+			if name := at(1); name.kind == tokIdent {
+				f.declare(name.text, nameFunc, name.line)
+				f.funcs = append(f.funcs, funcSpan{name: name.text, line: first.line, first: first.line + 1, last: first.line, topLevel: first.col == 1})
+				if at(2).text == "(" {
+					pyParams(f, stmt, 2)
+				}
+			}
+		case "class":
+			if name := at(1); name.kind == tokIdent {
+				f.declare(name.text, nameType, name.line)
+			}
+		case "if", "while":
+			if at(1).text == "False" && at(2).text == ":" {
+				f.neverTrue(first.line, "False")
+			}
+		case "return", "raise", "break", "continue":
+			if si+1 < len(stmts) && stmts[si+1][0].col == first.col {
+				f.unreachable(stmts[si+1][0].line, first.text)
+			}
+		}
+
+		// Assignment targets at the start of the statement
+		if first.kind == tokIdent && !pyControl[first.text] {
+			j := 0
+			for j < len(stmt) && stmt[j].kind == tokIdent && (at(j+1).text == "," || at(j+1).text == "=" && at(j+2).text != "=") {
+				kind := nameVar
+				if strings.ToUpper(stmt[j].text) == stmt[j].text {
+					kind = nameConst
+				}
+				f.declare(stmt[j].text, kind, stmt[j].line)
+				if at(j+1).text == "=" {
+					break
+				}
+				j += 2
+			}
+		}
+
+		for i, t := range stmt {
+			switch {
+			case t.kind == tokNumber:
+				// NAME = 42 names its number
+				if !(i == 2 && at(1).text == "=" && strings.ToUpper(first.text) == first.text && first.kind == tokIdent) {
+					f.numbers = append(f.numbers, numberLit{t.text, t.line})
+				}
+			case t.kind == tokIdent && t.text == "for":
+				for j := i + 1; j < len(stmt) && stmt[j].text != "in"; j++ {
+					if stmt[j].kind == tokIdent {
+						f.declare(stmt[j].text, nameLoop, stmt[j].line)
+					}
+				}
+			case t.kind == tokIdent && t.text == "lambda":
+				for j := i + 1; j < len(stmt) && stmt[j].text != ":"; j++ {
+					if stmt[j].kind == tokIdent {
+						f.declare(stmt[j].text, nameLoop, stmt[j].line)
+					}
+				}
+			case t.kind == tokIdent && t.text == "as" && at(i+1).kind == tokIdent:
+				f.declare(at(i+1).text, nameVar, at(i+1).line)
+			}
+		}
+	}
+	return f
+}
+
+// pyOpensBlock reports whether a logical line ends in a block header's
+// colon, so the lines indented under it belong to it
+func pyOpensBlock(stmt []lexeme) bool {
+	return stmt[len(stmt)-1].text == ":"
+}
+
+// pyParams declares a def's parameters from the bracket at stmt[open]
+func pyParams(f *codeFacts, stmt []lexeme, open int) {
+	depth := 0
+	for j := open; j < len(stmt); j++ {
+		t := stmt[j]
+		switch t.text {
+		case "(", "[", "{":
+			depth++
+			continue
+		case ")", "]", "}":
+			depth--
+			if depth == 0 {
+				return
+			}
+			continue
+		}
+		if t.kind != tokIdent || depth != 1 || t.text == "self" || t.text == "cls" {
+			continue
+		}
+		if p := stmt[j-1].text; p == "(" || p == "," || p == "*" {
+			f.declare(t.text, nameParam, t.line)
+		}
+	}
+}
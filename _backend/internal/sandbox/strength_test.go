@@ -0,0 +1,99 @@
+package sandbox
+
+import (
+	"strings"
+	"testing"
+)
+
+// longBody repeats a statement enough times to exceed maxFunctionLines
+func longBody(indent, stmt string) string {
+	return strings.Repeat(indent+stmt+"\n", maxFunctionLines+1)
+}
+
+func TestAnalyzeStrength(t *testing.T) {
+	tests := []struct {
+		name    string
+		lang    string
+		code    string
+		starter string
+		metric  string
+		score   int
+		line    int // line of the first finding, 0 when there is none
+	}{
+		{"go shallow nesting", LangGo, "func solve(xs []int) int {\n\tfor _, x := range xs {\n\t\tif x > 0 {\n\t\t\treturn x\n\t\t}\n\t}\n\treturn 0\n}\n", "", MetricNesting, 100, 0},
+		{"go deep nesting", LangGo, "func solve(grid [][]int) int {\n\tfor _, row := range grid {\n\t\tfor _, cell := range row {\n\t\t\tif cell > 0 {\n\t\t\t\tif cell%2 == 0 {\n\t\t\t\t\treturn cell\n\t\t\t\t}\n\t\t\t}\n\t\t}\n\t}\n\treturn 0\n}\n", "", MetricNesting, 75, 5},
+		{"go long function", LangGo, "func solve() int {\n\tcount := 0\n" + longBody("\t", "count++") + "\treturn count\n}\n", "", MetricFunctionLength, 75, 1},
+		{"go magic number", LangGo, "func solve(days int) int {\n\treturn days * 86400\n}\n", "", MetricMagicNumbers, 90, 2},
+		{"go named constant", LangGo, "const secondsPerDay = 86400\n\nfunc solve(days int) int {\n\treturn days * secondsPerDay\n}\n", "", MetricMagicNumbers, 100, 0},
+		{"go code after return", LangGo, "func solve() int {\n\treturn 1\n\tprintln(\"done\")\n}\n", "", MetricDeadCode, 75, 3},
+		{"go if false", LangGo, "func solve() int {\n\tif false {\n\t\treturn 2\n\t}\n\treturn 1\n}\n", "", MetricDeadCode, 75, 2},
+		{"go single letter", LangGo, "func solve(xs []int) int {\n\tt := len(xs)\n\treturn t\n}\n", "", MetricNaming, 85, 2},
+		{"go snake case", LangGo, "func solve(xs []int) int {\n\titem_count := len(xs)\n\treturn item_count\n}\n", "", MetricNaming, 85, 2},
+		{"go names from the starter", LangGo, "func solve(xs []int) int {\n\tt := len(xs)\n\treturn t\n}\n", "func solve(xs []int) int {\n\tt := 0\n\treturn t\n}\n", MetricNaming, 100, 0},
+
+		{"js deep nesting", LangJavaScript, "function solve(grid) {\n  for (const row of grid) {\n    for (const cell of row) {\n      if (cell > 0) {\n        if (cell % 2 === 0) {\n          return cell\n        }\n      }\n    }\n  }\n  return 0\n}\n", "", MetricNesting, 75, 5},
+		{"js long function", LangJavaScript, "function solve() {\n  let count = 0\n" + longBody("  ", "count++") + "  return count\n}\n", "", MetricFunctionLength, 75, 1},
+		{"js magic number", LangJavaScript, "function solve(days) {\n  return days * 86400\n}\n", "", MetricMagicNumbers, 90, 2},
+		{"js upper-case constant", LangJavaScript, "const SECONDS_PER_DAY = 86400\nfunction solve(days) {\n  return days * SECONDS_PER_DAY\n}\n", "", MetricMagicNumbers, 100, 0},
+		{"js code after return", LangJavaScript, "function solve() {\n  return 1\n  console.log('done')\n}\n", "", MetricDeadCode, 75, 3},
+		{"js return before a case", LangJavaScript, "function solve(n) {\n  switch (n) {\n    case 1:\n      return 'one'\n    default:\n      return 'many'\n  }\n}\n", "", MetricDeadCode, 100, 0},
+		{"js vague name", LangJavaScript, "function solve(xs) {\n  const temp = xs.length\n  return temp\n}\n", "", MetricNaming, 85, 2},
+		{"js snake case", LangJavaScript, "function solve(xs) {\n  const item_count = xs.length\n  return item_count\n}\n", "", MetricNaming, 85, 2},
+		{"js names from the starter", LangJavaScript, "function solve(xs) {\n  const temp = xs.length\n  return temp\n}\n", "function solve(xs) {\n  const temp = 0\n}\n", MetricNaming, 100, 0},
+
+		{"py deep nesting", LangPython, "def solve(grid):\n    for row in grid:\n        for cell in row:\n            if cell > 0:\n                if cell % 2 == 0:\n                    return cell\n    return 0\n", "", MetricNesting, 75, 5},
+		{"py long function", LangPython, "def solve():\n    count = 0\n" + longBody("    ", "count += 1") + "    return count\n", "", MetricFunctionLength, 75, 1},
+		{"py magic number", LangPython, "def solve(days):\n    return days * 86400\n", "", MetricMagicNumbers, 90, 2},
+		{"py upper-case constant", LangPython, "SECONDS_PER_DAY = 86400\n\ndef solve(days):\n    return days * SECONDS_PER_DAY\n", "", MetricMagicNumbers, 100, 0},
+		{"py code after return", LangPython, "def solve():\n    return 1\n    print('done')\n", "", MetricDeadCode, 75, 3},
+		{"py while False", LangPython, "def solve():\n    while False:\n        pass\n    return 1\n", "", MetricDeadCode, 75, 2},
+		{"py unused helper", LangPython, "def helper():\n    return 1\n\ndef solve():\n    return 2\n", "", MetricDeadCode, 75, 1},
+		{"py camel case", LangPython, "def solve(xs):\n    itemCount = len(xs)\n    return itemCount\n", "", MetricNaming, 85, 2},
+		{"py loop counter", LangPython, "def solve(xs):\n    total = 0\n    for i in range(len(xs)):\n        total += xs[i]\n    return total\n", "", MetricNaming, 100, 0},
+		{"py names from the starter", LangPython, "def solve(xs):\n    itemCount = len(xs)\n    return itemCount\n", "def solve(xs):\n    itemCount = 0\n", MetricNaming, 100, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := analyzeStrength(tt.lang, tt.code, tt.starter, "solve", nil)
+			if report == nil {
+				t.Fatal("no report")
+			}
+			var m *StrengthMetric
+			for i := range report.Metrics {
+				if report.Metrics[i].Name == tt.metric {
+					m = &report.Metrics[i]
+				}
+			}
+			if m == nil {
+				t.Fatalf("no %s metric in %+v", tt.metric, report.Metrics)
+			}
+			line := 0
+			if len(m.Findings) > 0 {
+				line = m.Findings[0].Line
+			}
+			if m.Score != tt.score || line != tt.line {
+				t.Errorf("%s scored %d with first finding on line %d, want %d on line %d: %+v", tt.metric, m.Score, line, tt.score, tt.line, m.Findings)
+			}
+		})
+	}
+}
+
+func TestAnalyzeStrengthUnparsableGo(t *testing.T) {
+	if report := analyzeStrength(LangGo, "func solve() int {\n\treturn\n", "", "solve", nil); report != nil {
+		t.Errorf("unparsable Go gave %+v, want nil", report)
+	}
+}
+
+func TestAnalyzeStrengthBestPractice(t *testing.T) {
+	practices := []string{"Prefer descriptive names", "Replace magic numbers with named constants"}
+	report := analyzeStrength(LangPython, "def solve(days):\n    return days * 86400\n", "", "solve", practices)
+	for _, m := range report.Metrics {
+		want := ""
+		if m.Name == MetricMagicNumbers {
+			want = practices[1]
+		}
+		if m.BestPractice != want {
+			t.Errorf("%s linked %q, want %q", m.Name, m.BestPractice, want)
+		}
+	}
+}
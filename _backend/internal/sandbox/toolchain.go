@@ -0,0 +1,367 @@
+package sandbox
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"sync"
+	"time"
+)
+
+// Toolchain describes how the runners build and start programs for one
+// language. Process commands run inside the program's work directory.
+type Toolchain struct {
+	Language   string
+	MainFile   string            // default entry file for the learner's code
+	Extension  string            // extension every source file must have
+	Support    map[string]string // extra files every program needs
+	Compile    []string          // optional build step, runs as the server user
+	Artifacts  []string          // files Compile produces that Run needs; cached between runs
+	Run        []string          // starts the program, runs sandboxed; see entryArg
+	Env        []string          // extra environment for both steps
+	Version    []string          // prints the runtime's version
+	MinVersion string            // oldest runtime version Run works with; CheckRuntimes enforces it
+	Driver     string            // built-in language whose test driver and analyzers apply
+	Limits     Limits            // non-zero fields override DefaultLimits
+	Backend    string            // runner that executes the language; BackendProcess when empty
+	Wasm       *WasmToolchain    // how the WebAssembly runner starts programs, if it can
+}
+
+// Runner backends a language can be assigned to
+const (
+	BackendProcess = "process" // local subprocesses of installed runtimes
+	BackendWasm    = "wasm"    // a WebAssembly build of the runtime, see WasmRunner
+)
+
+// WasmToolchain describes how the WebAssembly runner starts programs for
+// one language. Paths are relative to WasmConfig.ModuleDir.
+type WasmToolchain struct {
+	Module string            `json:"module"` // the runtime's wasm binary
+	Args   []string          `json:"args"`   // argv, starting with the program name; see entryArg
+	Mounts map[string]string `json:"mounts"` // guest path -> read-only host directory, such as a standard library
+	Env    []string          `json:"env"`
+	// Support files are added to every program, after Toolchain.Support
+	Support map[string]string `json:"support"`
+}
+
+// entryArg in a Run command is replaced by the program's entry file
+const entryArg = "{entry}"
+
+// builtinToolchains holds the runner definitions the drivers were written
+// for. The languages table may override them or add languages that reuse
+// their drivers.
+var builtinToolchains = map[string]Toolchain{
+	LangJavaScript: {
+		Language:  LangJavaScript,
+		MainFile:  "main.js",
+		Extension: ".js",
+		Run:       []string{"node", "--disallow-code-generation-from-strings", entryArg},
+		Version:   []string{"node", "--version"},
+		Wasm: &WasmToolchain{
+			Module:  "qjs.wasm",
+			Args:    []string{"qjs", "--std", "--include", qjsNodeShim, entryArg},
+			Support: map[string]string{qjsNodeShim: qjsNodeShimSource},
+		},
+	},
+	LangPython: {
+		Language:  LangPython,
+		MainFile:  "main.py",
+		Extension: ".py",
+		// Not -I: it would drop the script's directory from sys.path and
+		// break imports between the program's own files
+		Run:     []string{"python3", "-s", "-B", entryArg},
+		Env:     []string{"PYTHONIOENCODING=utf-8"},
+		Version: []string{"python3", "--version"},
+		Wasm: &WasmToolchain{
+			Module: "python.wasm",
+			Args:   []string{"python", "-s", "-B", entryArg},
+			Mounts: map[string]string{"/usr/local/lib": "python-lib"},
+			Env:    []string{"PYTHONIOENCODING=utf-8"},
+		},
+	},
+	LangGo: {
+		Language:  LangGo,
+		MainFile:  "main.go",
+		Extension: ".go",
+		Support:   map[string]string{"go.mod": "module sandbox\n\ngo 1.21\n"},
+		Compile:   []string{"go", "build", "-o", "prog", "."},
+		Artifacts: []string{"prog"},
+		Run:       []string{"./prog"},
+		Env:       []string{"CGO_ENABLED=0", "GOTOOLCHAIN=local", "GOPROXY=off", "GOFLAGS=-mod=mod"},
+		Version:   []string{"go", "version"},
+	},
+}
+
+// Language is a runnable language as listed to clients
+type Language struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	Icon            string `json:"icon,omitempty"`
+	Extension       string `json:"extension"`
+	SyntaxHighlight string `json:"syntaxHighlight"`
+	Primary         bool   `json:"primary"`
+	Version         string `json:"version,omitempty"` // the runtime's version, once CheckRuntimes has run
+
+	toolchain Toolchain
+}
+
+// registry holds the runnable languages, in display order. It starts with
+// the built-in toolchains and is replaced by LoadLanguages. backends holds
+// the overrides set by SetBackend and runtimes the last CheckRuntimes.
+var registry = struct {
+	sync.RWMutex
+	langs    []Language
+	backends map[string]string
+	runtimes map[string]Runtime
+}{langs: builtinLanguages(), backends: map[string]string{}, runtimes: map[string]Runtime{}}
+
+func builtinLanguages() []Language {
+	names := map[string]string{LangJavaScript: "JavaScript", LangPython: "Python", LangGo: "Go"}
+	var langs []Language
+	for _, id := range []string{LangJavaScript, LangPython, LangGo} {
+		tc := builtinToolchains[id]
+		langs = append(langs, Language{ID: id, Name: names[id], Extension: tc.Extension, SyntaxHighlight: id, Primary: id != LangGo, toolchain: tc})
+	}
+	return langs
+}
+
+// runnerConfig is the JSON runner definition in languages.runner. For a
+// built-in language, fields left out keep the built-in values.
+type runnerConfig struct {
+	MainFile   string            `json:"mainFile"`
+	Support    map[string]string `json:"support"`
+	Compile    []string          `json:"compile"`
+	Artifacts  []string          `json:"artifacts"`
+	Run        []string          `json:"run"`
+	Env        []string          `json:"env"`
+	Version    []string          `json:"version"`
+	MinVersion string            `json:"minVersion"` // such as 22.6
+	Driver     string            `json:"driver"`     // javascript, python or go
+	Backend    string            `json:"backend"`    // process or wasm
+	Wasm       *WasmToolchain    `json:"wasm"`
+	Limits     struct {
+		WallTimeMs int `json:"wallTimeMs"`
+		CPUTimeMs  int `json:"cpuTimeMs"`
+		MemoryMB   int `json:"memoryMb"`
+	} `json:"limits"`
+}
+
+// LoadLanguages replaces the registry with the active, sandbox-supported
+// rows of the languages table. Rows without a usable runner definition
+// are skipped and logged. On error the registry is left unchanged.
+func LoadLanguages(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT id, name, COALESCE(icon, ''), COALESCE(file_extension, ''), COALESCE(syntax_highlight, ''),
+		       is_primary, runner
+		FROM languages WHERE is_active = 1 AND sandbox_supported = 1
+		ORDER BY display_order, id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to load languages: %w", err)
+	}
+	defer rows.Close()
+
+	var langs []Language
+	for rows.Next() {
+		var lang Language
+		var runner sql.NullString
+		if err := rows.Scan(&lang.ID, &lang.Name, &lang.Icon, &lang.Extension, &lang.SyntaxHighlight, &lang.Primary, &runner); err != nil {
+			return fmt.Errorf("failed to read language: %w", err)
+		}
+		tc, err := languageToolchain(lang.ID, lang.Extension, runner.String)
+		if err != nil {
+			log.Printf("Language %s is not runnable: %v", lang.ID, err)
+			continue
+		}
+		lang.Extension = tc.Extension
+		lang.toolchain = tc
+		langs = append(langs, lang)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read languages: %w", err)
+	}
+
+	registry.Lock()
+	registry.langs = langs
+	registry.Unlock()
+	return nil
+}
+
+// languageToolchain builds a toolchain from a built-in definition and a
+// runner config, either of which may be missing
+func languageToolchain(id, extension, config string) (Toolchain, error) {
+	tc, builtin := builtinToolchains[id]
+	if !builtin && config == "" {
+		return tc, fmt.Errorf("no runner definition")
+	}
+	tc.Language = id
+	if extension != "" {
+		tc.Extension = extension
+	}
+
+	if config != "" {
+		var rc runnerConfig
+		if err := json.Unmarshal([]byte(config), &rc); err != nil {
+			return tc, fmt.Errorf("invalid runner definition: %w", err)
+		}
+		if rc.MainFile != "" {
+			tc.MainFile = rc.MainFile
+		}
+		if rc.Support != nil {
+			tc.Support = rc.Support
+		}
+		if rc.Compile != nil {
+			tc.Compile = rc.Compile
+			tc.Artifacts = rc.Artifacts
+		}
+		if rc.Run != nil {
+			tc.Run = rc.Run
+		}
+		if rc.Env != nil {
+			tc.Env = rc.Env
+		}
+		if rc.Version != nil {
+			tc.Version = rc.Version
+		}
+		if rc.MinVersion != "" {
+			if !pinPattern.MatchString(rc.MinVersion) {
+				return tc, fmt.Errorf("invalid minVersion %q", rc.MinVersion)
+			}
+			tc.MinVersion = rc.MinVersion
+		}
+		tc.Driver = rc.Driver
+		if rc.Backend != "" {
+			tc.Backend = rc.Backend
+		}
+		if rc.Wasm != nil {
+			tc.Wasm = rc.Wasm
+		}
+		tc.Limits = Limits{
+			WallTime:    time.Duration(rc.Limits.WallTimeMs) * time.Millisecond,
+			CPUTime:     time.Duration(rc.Limits.CPUTimeMs) * time.Millisecond,
+			MemoryBytes: int64(rc.Limits.MemoryMB) << 20,
+		}
+	}
+
+	if tc.Driver == "" {
+		tc.Driver = id
+	}
+	if _, ok := builtinToolchains[tc.Driver]; !ok {
+		return tc, fmt.Errorf("no test driver for %q", tc.Driver)
+	}
+	switch tc.Backend {
+	case "", BackendProcess:
+		if len(tc.Run) == 0 {
+			return tc, fmt.Errorf("no run command")
+		}
+	case BackendWasm:
+		if tc.Wasm == nil || tc.Wasm.Module == "" || len(tc.Wasm.Args) == 0 {
+			return tc, fmt.Errorf("no wasm module")
+		}
+	default:
+		return tc, fmt.Errorf("unknown backend %q", tc.Backend)
+	}
+	if tc.Extension == "" || path.Ext(tc.MainFile) != tc.Extension {
+		return tc, fmt.Errorf("main file %q does not have extension %q", tc.MainFile, tc.Extension)
+	}
+	return tc, nil
+}
+
+// Languages lists the runnable languages in display order, leaving out
+// those whose runtime failed its check
+func Languages() []Language {
+	registry.RLock()
+	defer registry.RUnlock()
+	var langs []Language
+	for _, l := range registry.langs {
+		rt, checked := registry.runtimes[l.ID]
+		if checked && !rt.Available {
+			continue
+		}
+		l.Version = rt.Version
+		langs = append(langs, l)
+	}
+	return langs
+}
+
+// allLanguages lists every registered language, runnable or not
+func allLanguages() []Language {
+	registry.RLock()
+	defer registry.RUnlock()
+	return append([]Language(nil), registry.langs...)
+}
+
+// runCommand returns the Run command for a program starting at entry
+func (tc Toolchain) runCommand(entry string) []string {
+	argv := make([]string, len(tc.Run))
+	for i, arg := range tc.Run {
+		if arg == entryArg {
+			arg = entry
+		}
+		argv[i] = arg
+	}
+	return argv
+}
+
+// limits applies the toolchain's overrides to DefaultLimits
+func (tc Toolchain) limits() Limits {
+	return tc.Limits.orDefaults(DefaultLimits())
+}
+
+// SetBackend assigns lang to a runner backend, overriding the languages
+// table. An empty backend removes the override.
+func SetBackend(lang, backend string) error {
+	switch backend {
+	case "", BackendProcess:
+	case BackendWasm:
+		if tc, ok := lookupToolchain(lang); ok && tc.Wasm == nil {
+			return fmt.Errorf("%s has no wasm runtime", lang)
+		}
+	default:
+		return fmt.Errorf("unknown backend %q", backend)
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if backend == "" {
+		delete(registry.backends, lang)
+	} else {
+		registry.backends[lang] = backend
+	}
+	return nil
+}
+
+// lookupToolchain returns the runner definition for lang
+func lookupToolchain(lang string) (Toolchain, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	for _, l := range registry.langs {
+		if l.ID == lang {
+			tc := l.toolchain
+			if backend, ok := registry.backends[lang]; ok {
+				tc.Backend = backend
+			}
+			if tc.Backend == "" {
+				tc.Backend = BackendProcess
+			}
+			return tc, true
+		}
+	}
+	return Toolchain{}, false
+}
+
+// dialect returns the built-in language whose driver, policy, diagnostics
+// and analyzers apply to lang
+func dialect(lang string) string {
+	if tc, ok := lookupToolchain(lang); ok && tc.Driver != "" {
+		return tc.Driver
+	}
+	return lang
+}
+
+// languageLimits returns the default limits for programs in lang
+func languageLimits(lang string) Limits {
+	tc, _ := lookupToolchain(lang)
+	return tc.limits()
+}
@@ -0,0 +1,497 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Trace mode runs a program under a per-language trace driver that prints
+// one marker line per executed step, interleaved with the program's own
+// output. The driver reads its settings from harnessInputFile like the test
+// drivers do.
+
+// traceDriver is the base name of the trace driver file
+const traceDriver = "__pp_trace"
+
+// Trace caps: steps a request may ask for, and bytes of step records kept
+const (
+	defaultTraceSteps = 500
+	maxTraceSteps     = 2000
+	maxTraceBytes     = 1 << 20
+)
+
+// ExecutionTrace is the step-by-step timeline of a traced run
+type ExecutionTrace struct {
+	Steps     []TraceStep `json:"steps"`
+	Truncated string      `json:"truncated,omitempty"` // "steps" or "size" when recording stopped early
+}
+
+// TraceStep is the program's state as a line is about to run, a function
+// returns or an exception is raised. Values are JSON; those JSON cannot
+// represent are objects with a single "repr" field, and large values are
+// cut short.
+type TraceStep struct {
+	Event       string          `json:"event"` // "line", "return" or "exception"
+	File        string          `json:"file"`
+	Line        int             `json:"line"`
+	Function    string          `json:"function,omitempty"` // empty at the top level
+	Depth       int             `json:"depth"`              // calls into the learner's code below the top level
+	Locals      json.RawMessage `json:"locals"`             // variable name -> value, in definition order
+	ReturnValue json.RawMessage `json:"returnValue,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Output      int             `json:"output"` // bytes of program output written before this step
+}
+
+// traceDrivers holds the trace driver of each language that has one
+var traceDrivers = map[string]string{
+	LangJavaScript: jsTracer,
+	LangPython:     pyTracer,
+}
+
+// canTrace reports whether lang has a trace driver its runner can start.
+// The JavaScript tracer needs node's inspector, which the wasm engine lacks.
+func canTrace(lang string) bool {
+	tc, _ := lookupToolchain(lang)
+	if tc.Backend == BackendWasm && dialect(lang) == LangJavaScript {
+		return false
+	}
+	_, ok := traceDrivers[dialect(lang)]
+	return ok
+}
+
+// traceProgram makes prog start from the trace driver, which then runs
+// the program's own entry file. It returns the marker of the driver's
+// step records.
+func traceProgram(prog Program, tc Toolchain, maxSteps int) (Program, string, error) {
+	if maxSteps <= 0 {
+		maxSteps = defaultTraceSteps
+	}
+	maxSteps = min(maxSteps, maxTraceSteps)
+
+	marker, err := newMarker()
+	if err != nil {
+		return prog, "", err
+	}
+	var names []string
+	for name := range prog.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	input, err := json.Marshal(harnessInput{
+		Marker:   marker,
+		Args:     []interface{}{},
+		Entry:    prog.Entry,
+		Files:    names,
+		MaxSteps: maxSteps,
+		MaxBytes: maxTraceBytes,
+	})
+	if err != nil {
+		return prog, "", fmt.Errorf("failed to encode trace input: %w", err)
+	}
+
+	files := make(map[string]string, len(prog.Files)+2)
+	for name, content := range prog.Files {
+		files[name] = content
+	}
+	driver := traceDriver + tc.Extension
+	files[driver] = traceDrivers[dialect(prog.Language)]
+	files[harnessInputFile] = string(input)
+
+	prog.Files = files
+	prog.Entry = driver
+	// Room for the step records on top of the program's own output, which
+	// parseTrace holds to the original limit
+	prog.Limits.OutputBytes += maxTraceBytes + maxTraceSteps*(len(marker)+64)
+	return prog, marker, nil
+}
+
+// parseTrace collects the step records from a traced run's output and
+// leaves only the program's own output in res.Stdout
+func parseTrace(res *Result, marker string, outputLimit int) *ExecutionTrace {
+	trace := &ExecutionTrace{Steps: []TraceStep{}}
+	var output strings.Builder
+	size := 0
+
+	rest := res.Stdout
+	for {
+		idx := strings.Index(rest, "\n"+marker)
+		if idx < 0 {
+			output.WriteString(rest)
+			break
+		}
+		output.WriteString(rest[:idx])
+		line := rest[idx+1+len(marker):]
+		rest = ""
+		if end := strings.IndexByte(line, '\n'); end >= 0 {
+			line, rest = line[:end], line[end+1:]
+		}
+
+		var record struct {
+			TraceStep
+			Truncated string `json:"truncated"`
+		}
+		if trace.Truncated != "" || json.Unmarshal([]byte(line), &record) != nil {
+			continue
+		}
+		if record.Truncated != "" {
+			trace.Truncated = record.Truncated
+			continue
+		}
+		if size += len(line); size > maxTraceBytes {
+			trace.Truncated = "size"
+			continue
+		}
+		record.Output = output.Len()
+		trace.Steps = append(trace.Steps, record.TraceStep)
+	}
+
+	res.Stdout = output.String()
+	if outputLimit > 0 && len(res.Stdout) > outputLimit {
+		res.Stdout = res.Stdout[:outputLimit]
+		res.Truncated = true
+	}
+	return trace
+}
+
+// jsTracer runs the program on the main thread while a worker thread steps
+// through it with the inspector, pausing on every statement of the
+// learner's files. Node's own code runs unpaused.
+const jsTracer = `const { Worker, isMainThread, workerData } = require('worker_threads');
+const fs = require('fs');
+const path = require('path');
+const { pathToFileURL } = require('url');
+
+if (isMainThread) {
+  const input = JSON.parse(fs.readFileSync('` + harnessInputFile + `', 'utf8'));
+  const ready = new Int32Array(new SharedArrayBuffer(4));
+  const worker = new Worker(__filename, { workerData: { input, ready } });
+  worker.unref();
+  // Spin rather than Atomics.wait: the inspector needs this thread to
+  // service the worker's requests while it sets its breakpoints
+  const deadline = Date.now() + 2000;
+  while (Atomics.load(ready, 0) === 0 && Date.now() < deadline);
+  process.argv[1] = path.resolve(input.entry);
+  require(process.argv[1]);
+} else {
+  const inspector = require('inspector');
+  const { input, ready } = workerData;
+  const session = new inspector.Session();
+  session.connectToMainThread();
+  // Inspector replies arrive on this thread's event loop
+  setInterval(() => {}, 1 << 30);
+
+  const post = (method, params) =>
+    new Promise((resolve, reject) => session.post(method, params, (err, res) => (err ? reject(err) : resolve(res))));
+  const urls = new Map(input.files.map((name) => [pathToFileURL(path.resolve(name)).href, name]));
+  const scripts = new Map();
+  const expanded = new Set();
+  let steps = 0;
+  let bytes = 0;
+  let last = '';
+  let done = false;
+
+  const emit = (record) => {
+    const line = JSON.stringify(record);
+    bytes += line.length;
+    fs.writeSync(1, '\n' + input.marker + line + '\n');
+  };
+  const stop = async (reason) => {
+    done = true;
+    emit({ truncated: reason });
+    await post('Debugger.disable');
+  };
+
+  // Runs on the paused thread with a scope object, or with the value to
+  // render when whole is set, as this. Getters are never called.
+  function snapshot(whole) {
+    const seen = new Set();
+    const render = (v, depth) => {
+      if (typeof v === 'string') return v.length > 200 ? v.slice(0, 200) + '…' : v;
+      if (v === null || typeof v === 'boolean') return v;
+      if (typeof v === 'number') return Number.isFinite(v) ? v : { repr: String(v) };
+      if (v === undefined) return { repr: 'undefined' };
+      if (typeof v === 'function') return undefined;
+      if (typeof v !== 'object') return { repr: String(v) };
+      if (seen.has(v) || depth > 3) return { repr: Array.isArray(v) ? '[…]' : '{…}' };
+      seen.add(v);
+      if (Array.isArray(v)) {
+        const items = v.slice(0, 50).map((x) => render(x, depth + 1) ?? { repr: 'function' });
+        if (v.length > 50) items.push({ repr: '…' });
+        return items;
+      }
+      if (v instanceof Map || v instanceof Set) return { repr: v.constructor.name + '(' + v.size + ')' };
+      const out = {};
+      for (const k of Object.keys(v).slice(0, 50)) {
+        const d = Object.getOwnPropertyDescriptor(v, k);
+        if (d && 'value' in d) {
+          const r = render(d.value, depth + 1);
+          if (r !== undefined) out[k] = r;
+        }
+      }
+      return out;
+    };
+    if (whole) return render(this, 0);
+    const wrapper = ['exports', 'require', 'module', '__filename', '__dirname'];
+    const out = {};
+    for (const k of Object.getOwnPropertyNames(this)) {
+      if (wrapper.includes(k)) continue;
+      let v;
+      try {
+        v = this[k];
+      } catch (err) {
+        continue;
+      }
+      const r = render(v, 0);
+      if (r !== undefined) out[k] = r;
+    }
+    return out;
+  }
+
+  const render = async (object, whole) => {
+    if (!object.objectId) {
+      if (object.type === 'undefined') return { repr: 'undefined' };
+      if ('value' in object) return typeof object.value === 'string' && object.value.length > 200 ? object.value.slice(0, 200) + '…' : object.value;
+      return { repr: object.unserializableValue || object.description };
+    }
+    const { result } = await post('Runtime.callFunctionOn', {
+      objectId: object.objectId,
+      functionDeclaration: snapshot.toString(),
+      arguments: [{ value: whole }],
+      returnByValue: true,
+    });
+    return result.value;
+  };
+
+  const locals = async (frame) => {
+    const vars = {};
+    for (const scope of frame.scopeChain) {
+      if (scope.type !== 'local' && scope.type !== 'block') continue;
+      // Inner scopes come first and shadow outer ones
+      for (const [k, v] of Object.entries((await render(scope.object, false)) || {})) {
+        if (!(k in vars)) vars[k] = v;
+      }
+    }
+    return vars;
+  };
+
+  session.on('Debugger.scriptParsed', ({ params }) => {
+    if (urls.has(params.url)) scripts.set(params.scriptId, urls.get(params.url));
+  });
+
+  session.on('Debugger.paused', async ({ params }) => {
+    try {
+      const frame = params.callFrames[0];
+      const file = scripts.get(frame.location.scriptId);
+      if (done || file === undefined) {
+        await post('Debugger.resume');
+        return;
+      }
+      if (!expanded.has(frame.location.scriptId)) {
+        // Break on every statement of the file, not only at line starts
+        expanded.add(frame.location.scriptId);
+        const { locations } = await post('Debugger.getPossibleBreakpoints', {
+          start: { scriptId: frame.location.scriptId, lineNumber: 0, columnNumber: 0 },
+        });
+        for (const location of locations) {
+          await post('Debugger.setBreakpoint', { location }).catch(() => {});
+        }
+      }
+      if (steps >= input.maxSteps) return stop('steps');
+      if (bytes >= input.maxBytes) return stop('size');
+
+      const step = {
+        event: 'line',
+        file,
+        line: frame.location.lineNumber + 1,
+        function: frame.functionName,
+        depth: params.callFrames.filter((f) => scripts.has(f.location.scriptId)).length - 1,
+        locals: await locals(frame),
+      };
+      if (params.reason === 'exception') {
+        step.event = 'exception';
+        step.error = ((params.data && params.data.description) || 'Uncaught exception').split('\n')[0];
+      } else if (frame.returnValue) {
+        step.event = 'return';
+        step.returnValue = await render(frame.returnValue, true);
+      }
+      // Statements that share a line often pause twice in the same state
+      const key = JSON.stringify([step.event, step.line, step.depth, step.locals]);
+      if (key !== last && !(step.event === 'return' && step.function === '')) {
+        last = key;
+        steps++;
+        emit(step);
+      }
+      await post('Debugger.resume');
+    } catch (err) {
+      done = true;
+      session.post('Debugger.disable');
+    }
+  });
+
+  (async () => {
+    await post('Debugger.enable');
+    await post('Debugger.setPauseOnExceptions', { state: 'uncaught' });
+    // One breakpoint per line until each file is parsed and its first
+    // pause adds the rest
+    for (const [url, name] of urls) {
+      const lines = fs.readFileSync(name, 'utf8').split('\n').length;
+      for (let line = 0; line < lines; line++) {
+        await post('Debugger.setBreakpointByUrl', { url, lineNumber: line });
+      }
+    }
+  })().finally(() => Atomics.store(ready, 0, 1));
+}
+`
+
+// pyTracer runs the program with a sys.settrace hook that records the
+// learner's frames and ignores everything else
+const pyTracer = `import json
+import math
+import os
+import runpy
+import sys
+import traceback
+import types
+
+
+def __pp_trace():
+    with open("` + harnessInputFile + `") as f:
+        data = json.load(f)
+
+    files = {os.path.realpath(name): name for name in data["files"]}
+    out = sys.stdout
+    # Step records and the program's output must interleave in order
+    out.reconfigure(line_buffering=True)
+    state = {"steps": 0, "bytes": 0, "done": False}
+    raising = set()  # frames an exception is propagating through
+    hidden = (types.ModuleType, types.FunctionType, types.BuiltinFunctionType, type)
+
+    def render(value, depth):
+        if value is None or isinstance(value, (bool, int)) and abs(value) < 2 ** 53:
+            return value
+        if isinstance(value, float):
+            return value if math.isfinite(value) else {"repr": repr(value)}
+        if isinstance(value, str):
+            return value if len(value) <= 200 else value[:200] + "…"
+        if depth > 3:
+            return {"repr": "…"}
+        if isinstance(value, (list, tuple)):
+            items = [render(v, depth + 1) for v in value[:50]]
+            if len(value) > 50:
+                items.append({"repr": "…"})
+            return items
+        if isinstance(value, dict):
+            return {str(k): render(v, depth + 1) for k, v in list(value.items())[:50]}
+        text = repr(value)
+        return {"repr": text if len(text) <= 200 else text[:200] + "…"}
+
+    def snapshot(frame):
+        return {
+            name: render(value, 0)
+            for name, value in frame.f_locals.items()
+            if not name.startswith("__") and not isinstance(value, hidden)
+        }
+
+    def emit(record):
+        line = json.dumps(record)
+        state["bytes"] += len(line)
+        out.write("\n" + data["marker"] + line + "\n")
+
+    def depth(frame):
+        n = -1
+        while frame is not None:
+            if os.path.realpath(frame.f_code.co_filename) in files:
+                n += 1
+            frame = frame.f_back
+        return n
+
+    def tracer(frame, event, arg):
+        if state["done"]:
+            return None
+        path = os.path.realpath(frame.f_code.co_filename)
+        if path not in files:
+            return None
+        top = frame.f_code.co_name == "<module>"
+        # A frame an exception leaves also reports a return of None
+        unwinding = event == "return" and id(frame) in raising
+        if event == "exception":
+            raising.add(id(frame))
+        else:
+            raising.discard(id(frame))
+        if event not in ("line", "return", "exception") or (event == "return" and (top or unwinding)):
+            return tracer
+        if state["steps"] >= data["maxSteps"] or state["bytes"] >= data["maxBytes"]:
+            state["done"] = True
+            sys.settrace(None)
+            emit({"truncated": "steps" if state["steps"] >= data["maxSteps"] else "size"})
+            return None
+        step = {
+            "event": event,
+            "file": files[path],
+            "line": frame.f_lineno,
+            "function": "" if top else frame.f_code.co_name,
+            "depth": depth(frame),
+            "locals": snapshot(frame),
+        }
+        if event == "return":
+            step["returnValue"] = render(arg, 0)
+        elif event == "exception":
+            step["error"] = arg[0].__name__ + ": " + str(arg[1])
+        state["steps"] += 1
+        emit(step)
+        return tracer
+
+    sys.argv = [data["entry"]]
+    sys.settrace(tracer)
+    try:
+        runpy.run_path(data["entry"], run_name="__main__")
+    except SystemExit:
+        raise
+    except BaseException as err:
+        sys.settrace(None)
+        # Report the error from the learner's first frame, as a plain run would
+        tb = err.__traceback__
+        while tb is not None and os.path.realpath(tb.tb_frame.f_code.co_filename) not in files:
+            tb = tb.tb_next
+        traceback.print_exception(type(err), err, tb)
+        sys.exit(1)
+    finally:
+        sys.settrace(None)
+
+
+__pp_trace()
+`
+
+// traceCall builds a program that calls entry once with args and prints
+// what it returns as JSON. The call is appended to the learner's code, so
+// it is the last top-level line of the trace.
+func traceCall(lang, code, entry string, args []interface{}, limits Limits) (Program, error) {
+	if !identPattern.MatchString(entry) {
+		return Program{}, fmt.Errorf("invalid function name %q", entry)
+	}
+	blob, err := json.Marshal(args)
+	if err != nil {
+		return Program{}, fmt.Errorf("failed to encode arguments: %w", err)
+	}
+
+	var call string
+	switch dialect(lang) {
+	case LangJavaScript:
+		call = fmt.Sprintf("console.log(JSON.stringify(%s(...%s)));", entry, blob)
+	case LangPython:
+		call = fmt.Sprintf("print(__import__('json').dumps(%s(*__import__('json').loads(%s))))", entry, strconv.Quote(string(blob)))
+	default:
+		return Program{}, fmt.Errorf("tracing is not available for %s", lang)
+	}
+
+	tc, _ := lookupToolchain(lang)
+	return Program{
+		Language: lang,
+		Files:    map[string]string{tc.MainFile: strings.TrimRight(code, "\n") + "\n" + call + "\n"},
+		Entry:    tc.MainFile,
+		Limits:   limits,
+	}, nil
+}
@@ -0,0 +1,282 @@
+package sandbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Status of one language in a verification
+const (
+	VerifyPassed  = "passed"
+	VerifyFailed  = "failed"
+	VerifyMissing = "missing" // starter code without a reference solution
+)
+
+// Verification is the outcome of running an exercise's reference solutions
+// against all of its test cases, hidden ones included
+type Verification struct {
+	ExerciseID  string                 `json:"exerciseId"`
+	Slug        string                 `json:"slug"`
+	Passed      bool                   `json:"passed"`
+	Message     string                 `json:"message,omitempty"`
+	Filled      int                    `json:"filled,omitempty"`      // expected outputs filled in from a reference solution
+	Unpublished bool                   `json:"unpublished,omitempty"` // taken offline because it failed
+	Languages   []LanguageVerification `json:"languages"`
+}
+
+// LanguageVerification is one cell of the verification matrix
+type LanguageVerification struct {
+	Language string       `json:"language"`
+	Status   string       `json:"status"`
+	Passed   int          `json:"passed"`
+	Failed   int          `json:"failed"`
+	Message  string       `json:"message,omitempty"`
+	Results  []TestResult `json:"results,omitempty"`
+}
+
+// VerifyOptions controls the changes a verification may make
+type VerifyOptions struct {
+	// FillExpected names the language whose reference solution supplies the
+	// expected output of test cases that have none
+	FillExpected string `json:"fillExpected,omitempty"`
+	// Unpublish takes a failing exercise offline
+	Unpublish bool `json:"unpublish,omitempty"`
+}
+
+// Querier is the database a verification reads and writes: a *sql.DB, or
+// a *sql.Tx holding an edit that is verified before it is committed
+type Querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// ExerciseIDs lists every exercise, published or not, in curriculum order
+func ExerciseIDs(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SELECT id FROM exercises ORDER BY primitive_id, sequence_order, id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list exercises: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to read exercise: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// VerifyExercise runs a verification on one sandbox worker, reading the
+// exercise through q
+func (h *Handler) VerifyExercise(ctx context.Context, q Querier, id string, opts VerifyOptions) (*Verification, error) {
+	release, err := h.scheduler.Acquire(ctx, Ticket{})
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return VerifyExercise(ctx, q, h.runner, id, opts)
+}
+
+// VerifyExercise runs the reference solution of every language the
+// exercise has one for against all of its test cases. The exercise passes
+// when it has tests and at least one solution, and no solution fails.
+func VerifyExercise(ctx context.Context, db Querier, runner Runner, id string, opts VerifyOptions) (*Verification, error) {
+	v := &Verification{ExerciseID: id}
+	err := db.QueryRow("SELECT slug FROM exercises WHERE id = ?", id).Scan(&v.Slug)
+	if err == sql.ErrNoRows {
+		return nil, ErrExerciseNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load exercise: %w", err)
+	}
+
+	if opts.FillExpected != "" {
+		if v.Filled, err = fillExpected(ctx, db, runner, id, opts.FillExpected); err != nil {
+			return nil, err
+		}
+	}
+
+	langs, err := solutionLanguages(db, id)
+	if err != nil {
+		return nil, err
+	}
+	solved := 0
+	for _, lang := range langs {
+		spec, err := readExercise(db, id, lang, true, false)
+		if err != nil {
+			return nil, err
+		}
+		cell, err := verifyLanguage(ctx, runner, lang, spec)
+		if err != nil {
+			return nil, err
+		}
+		if cell.Status != VerifyMissing {
+			solved++
+		}
+		v.Languages = append(v.Languages, cell)
+	}
+
+	v.Passed = true
+	for _, cell := range v.Languages {
+		if cell.Status == VerifyFailed {
+			v.Passed = false
+			v.Message = "The reference solution fails in " + cell.Language
+			break
+		}
+	}
+	if blanks, err := blankExpected(db, id); err != nil {
+		return nil, err
+	} else if len(blanks) > 0 {
+		v.Passed = false
+		v.Message = fmt.Sprintf("%d test case(s) have no expected output", len(blanks))
+	}
+	if solved == 0 {
+		v.Passed = false
+		v.Message = "The exercise has no reference solution"
+	}
+
+	if !v.Passed && opts.Unpublish {
+		res, err := db.Exec("UPDATE exercises SET is_published = 0 WHERE id = ? AND is_published = 1", id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unpublish exercise: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		v.Unpublished = n > 0
+	}
+	return v, nil
+}
+
+// verifyLanguage runs one language's reference solution through the same
+// checks a learner's submission gets
+func verifyLanguage(ctx context.Context, runner Runner, lang string, spec *exerciseSpec) (LanguageVerification, error) {
+	cell := LanguageVerification{Language: lang}
+	switch {
+	case strings.TrimSpace(spec.Solution) == "":
+		cell.Status = VerifyMissing
+		return cell, nil
+	case len(spec.Tests) == 0:
+		cell.Status = VerifyFailed
+		cell.Message = "The exercise has no test cases"
+		return cell, nil
+	case spec.Deterministic && !DeterministicLanguage(lang):
+		cell.Status = VerifyFailed
+		cell.Message = ErrNotDeterministic.Error()
+		return cell, nil
+	}
+
+	if violations := spec.checkPolicy(lang, spec.Solution); len(violations) > 0 {
+		cell.Status = VerifyFailed
+		cell.Message = policyError(violations)
+		return cell, nil
+	}
+
+	entry := spec.entryFor(lang, spec.Solution)
+	results, err := runTests(ctx, runner, lang, spec.Solution, entry, spec.Signature, spec.Tests, spec.Limits, caseHooks{})
+	if err != nil {
+		return cell, err
+	}
+	cell.Results = append(results, spec.checkConstructs(lang, spec.Solution, entry)...)
+	cell.Passed, cell.Failed, _ = summarize(cell.Results)
+	cell.Status = VerifyPassed
+	if cell.Failed > 0 {
+		cell.Status = VerifyFailed
+		for _, r := range cell.Results {
+			if !r.Passed {
+				cell.Message = r.Name + ": " + r.Message
+				break
+			}
+		}
+	}
+	return cell, nil
+}
+
+// fillExpected stores lang's reference solution output as the expected
+// output of every test case that has none, returning how many it filled
+func fillExpected(ctx context.Context, db Querier, runner Runner, id, lang string) (int, error) {
+	if _, ok := lookupToolchain(lang); !ok {
+		return 0, fmt.Errorf("unsupported language %q", lang)
+	}
+	blanks, err := blankExpected(db, id)
+	if err != nil || len(blanks) == 0 {
+		return 0, err
+	}
+	spec, err := readExercise(db, id, lang, true, false)
+	if err != nil {
+		return 0, err
+	}
+	if strings.TrimSpace(spec.Solution) == "" {
+		return 0, fmt.Errorf("the exercise has no %s reference solution", lang)
+	}
+
+	var tests []TestCase
+	for _, tc := range spec.Tests {
+		if blanks[tc.ID] {
+			tests = append(tests, tc)
+		}
+	}
+	results, err := runTests(ctx, runner, lang, spec.Solution, spec.entryFor(lang, spec.Solution), spec.Signature, tests, spec.Limits, caseHooks{})
+	if err != nil {
+		return 0, err
+	}
+
+	filled := 0
+	for _, r := range results {
+		// Only a returned value is an output; errors leave the case blank
+		if r.Actual == "" {
+			continue
+		}
+		if _, err := db.Exec("UPDATE exercise_test_cases SET expected_output = ? WHERE id = ?", r.Actual, r.ID); err != nil {
+			return filled, fmt.Errorf("failed to store expected output: %w", err)
+		}
+		filled++
+	}
+	return filled, nil
+}
+
+// blankExpected returns the IDs of an exercise's test cases without an
+// expected output
+func blankExpected(db Querier, id string) (map[string]bool, error) {
+	rows, err := db.Query("SELECT id FROM exercise_test_cases WHERE exercise_id = ? AND TRIM(expected_output) = ''", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load test cases: %w", err)
+	}
+	defer rows.Close()
+
+	blanks := map[string]bool{}
+	for rows.Next() {
+		var tc string
+		if err := rows.Scan(&tc); err != nil {
+			return nil, fmt.Errorf("failed to read test case: %w", err)
+		}
+		blanks[tc] = true
+	}
+	return blanks, rows.Err()
+}
+
+// solutionLanguages lists the supported languages an exercise has starter
+// code for
+func solutionLanguages(db Querier, id string) ([]string, error) {
+	rows, err := db.Query("SELECT language FROM exercise_starter_code WHERE exercise_id = ? ORDER BY language", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load starter code: %w", err)
+	}
+	defer rows.Close()
+
+	var langs []string
+	for rows.Next() {
+		var lang string
+		if err := rows.Scan(&lang); err != nil {
+			return nil, fmt.Errorf("failed to read starter code: %w", err)
+		}
+		if validLang(lang) {
+			langs = append(langs, lang)
+		}
+	}
+	return langs, rows.Err()
+}
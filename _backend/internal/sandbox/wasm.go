@@ -0,0 +1,374 @@
+package sandbox
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing/fstest"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// WasmConfig configures the WebAssembly runner
+type WasmConfig struct {
+	ModuleDir string // runtime binaries and the directories they mount
+	CacheDir  string // compiled runtimes, kept between restarts; empty keeps them in memory
+	// FuelPerSecond is the number of function calls a program may make per
+	// second of its CPU time limit. Metering makes calls several times
+	// slower; 0 turns it off and leaves only the wall-clock limit.
+	FuelPerSecond int64
+}
+
+// DefaultWasmConfig returns a config reading runtimes from ModuleDir
+func DefaultWasmConfig() WasmConfig {
+	base := filepath.Join(os.TempDir(), "pp-sandbox")
+	return WasmConfig{
+		ModuleDir:     filepath.Join(base, "wasm"),
+		CacheDir:      filepath.Join(base, "cache", "wasm"),
+		FuelPerSecond: 10_000_000,
+	}
+}
+
+// wasmPageSize is the unit of WebAssembly memory
+const wasmPageSize = 64 << 10
+
+// WasmRunner executes programs inside WebAssembly builds of the language
+// runtimes, in-process. Programs see their own files, read-only, and the
+// runtime's mounts, and have no network. Memory is capped by the module's
+// page limit and CPU by fuel, counted in function calls.
+type WasmRunner struct {
+	cfg   WasmConfig
+	cache wazero.CompilationCache
+
+	mu      sync.Mutex
+	engines map[uint32]*wasmEngine // by memory limit in pages
+}
+
+// wasmEngine is a runtime with one memory limit and the modules compiled
+// for it
+type wasmEngine struct {
+	runtime wazero.Runtime
+
+	mu      sync.Mutex
+	modules map[string]wazero.CompiledModule // by module path
+}
+
+// NewWasmRunner creates a WebAssembly runner and its compilation cache
+func NewWasmRunner(cfg WasmConfig) (*WasmRunner, error) {
+	if _, err := os.Stat(cfg.ModuleDir); err != nil {
+		return nil, fmt.Errorf("wasm module directory: %w", err)
+	}
+	cache := wazero.NewCompilationCache()
+	if cfg.CacheDir != "" {
+		var err error
+		if cache, err = wazero.NewCompilationCacheWithDir(cfg.CacheDir); err != nil {
+			return nil, fmt.Errorf("failed to create wasm cache: %w", err)
+		}
+	}
+	return &WasmRunner{cfg: cfg, cache: cache, engines: map[uint32]*wasmEngine{}}, nil
+}
+
+// Close releases every runtime and compiled module
+func (w *WasmRunner) Close(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for pages, e := range w.engines {
+		e.runtime.Close(ctx)
+		delete(w.engines, pages)
+	}
+	return w.cache.Close(ctx)
+}
+
+// Run starts the language's wasm runtime on prog and waits for it to
+// finish under prog.Limits
+func (w *WasmRunner) Run(ctx context.Context, prog Program) (*Result, error) {
+	tc, ok := lookupToolchain(prog.Language)
+	if !ok {
+		return nil, fmt.Errorf("unsupported language: %s", prog.Language)
+	}
+	if tc.Wasm == nil {
+		return nil, fmt.Errorf("%s has no wasm runtime", prog.Language)
+	}
+
+	files := fstest.MapFS{}
+	for _, set := range []map[string]string{tc.Support, tc.Wasm.Support, prog.Files} {
+		for name, content := range set {
+			clean := path.Clean(name)
+			if clean == "." || path.IsAbs(clean) || strings.HasPrefix(clean, "..") {
+				return nil, fmt.Errorf("invalid file name: %s", name)
+			}
+			files[clean] = &fstest.MapFile{Data: []byte(content), Mode: 0444}
+		}
+	}
+
+	// Limits the program leaves unset come from its language
+	limits := prog.Limits.orDefaults(tc.limits())
+	entry := prog.Entry
+	if entry == "" {
+		entry = tc.MainFile
+	}
+
+	start := time.Now()
+	engine, err := w.engine(ctx, limits.MemoryBytes)
+	if err != nil {
+		return nil, err
+	}
+	module, err := w.compile(ctx, engine, tc.Wasm.Module)
+	if err != nil {
+		return nil, err
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, limits.WallTime)
+	defer cancel()
+	cpu := limits.CPUTime
+	if cpu <= 0 {
+		cpu = limits.WallTime
+	}
+	fuel := &wasmFuel{left: int64(cpu.Seconds() * float64(w.cfg.FuelPerSecond))}
+	runCtx = context.WithValue(runCtx, wasmFuelKey{}, fuel)
+
+	stdout := &cappedBuffer{limit: limits.OutputBytes, onOverflow: cancel}
+	stderr := &cappedBuffer{limit: limits.OutputBytes, onOverflow: cancel}
+	if prog.OnOutput != nil {
+		stdout.onWrite = func(b []byte) { prog.OnOutput(StreamStdout, b) }
+		stderr.onWrite = func(b []byte) { prog.OnOutput(StreamStderr, b) }
+	}
+
+	fsConfig := wazero.NewFSConfig().WithFSMount(files, "/")
+	for guest, host := range tc.Wasm.Mounts {
+		dir := filepath.Join(w.cfg.ModuleDir, host)
+		if _, err := os.Stat(dir); err == nil {
+			fsConfig = fsConfig.WithReadOnlyDirMount(dir, guest)
+		}
+	}
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(tc.Wasm.command(entry)...).
+		WithStdin(strings.NewReader(prog.Stdin)).
+		WithStdout(stdout).
+		WithStderr(stderr).
+		WithFSConfig(fsConfig).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithSysNanosleep().
+		WithRandSource(rand.Reader)
+	for _, kv := range append(append([]string{}, tc.Wasm.Env...), prog.Env...) {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			config = config.WithEnv(k, v)
+		}
+	}
+
+	instance, runErr := engine.runtime.InstantiateModule(runCtx, module, config)
+	if instance != nil {
+		instance.Close(ctx)
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	res := &Result{
+		Stage:     StageRun,
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.Overflowed() || stderr.Overflowed(),
+		Duration:  time.Since(start),
+	}
+	var exit *sys.ExitError
+	switch {
+	case runErr == nil:
+	case fuel.exhausted:
+		res.ExitCode, res.Signal, res.TimedOut = -1, "killed", true
+	case res.Truncated:
+		res.ExitCode, res.Signal = -1, "killed"
+	case errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		res.ExitCode, res.Signal, res.TimedOut = -1, "killed", true
+	case errors.As(runErr, &exit):
+		res.ExitCode = int(exit.ExitCode())
+	default:
+		// A trap, such as unreachable code or a call stack overflow
+		res.ExitCode, res.Signal = -1, "wasm trap"
+		res.Stderr += "\n" + runErr.Error() + "\n"
+	}
+	return res, nil
+}
+
+// engine returns the runtime for programs limited to memoryBytes
+func (w *WasmRunner) engine(ctx context.Context, memoryBytes int64) (*wasmEngine, error) {
+	pages := uint32(65536)
+	if memoryBytes > 0 && memoryBytes < int64(pages)*wasmPageSize {
+		pages = uint32((memoryBytes + wasmPageSize - 1) / wasmPageSize)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if e, ok := w.engines[pages]; ok {
+		return e, nil
+	}
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(pages).
+		WithCloseOnContextDone(true).
+		WithCompilationCache(w.cache))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("failed to start wasi: %w", err)
+	}
+	e := &wasmEngine{runtime: runtime, modules: map[string]wazero.CompiledModule{}}
+	w.engines[pages] = e
+	return e, nil
+}
+
+// compile returns name compiled for e, compiling it on first use
+func (w *WasmRunner) compile(ctx context.Context, e *wasmEngine, name string) (wazero.CompiledModule, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if m, ok := e.modules[name]; ok {
+		return m, nil
+	}
+	bin, err := os.ReadFile(filepath.Join(w.cfg.ModuleDir, name))
+	if err != nil {
+		return nil, fmt.Errorf("runtime %q is not installed: %w", name, err)
+	}
+	if w.cfg.FuelPerSecond > 0 {
+		ctx = experimental.WithFunctionListenerFactory(ctx, wasmFuelMeter{})
+	}
+	m, err := e.runtime.CompileModule(ctx, bin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile %s: %w", name, err)
+	}
+	e.modules[name] = m
+	return m, nil
+}
+
+// command returns the module's arguments for a program starting at entry
+func (wt *WasmToolchain) command(entry string) []string {
+	argv := make([]string, len(wt.Args))
+	for i, arg := range wt.Args {
+		if arg == entryArg {
+			arg = entry
+		}
+		argv[i] = arg
+	}
+	return argv
+}
+
+// wasmFuel is the function calls one run has left
+type wasmFuel struct {
+	left      int64
+	exhausted bool
+}
+
+type wasmFuelKey struct{}
+
+// errOutOfFuel unwinds a run that used up its fuel
+var errOutOfFuel = errors.New("out of fuel")
+
+// wasmFuelMeter charges a run's fuel for every function call. A run only
+// executes on one goroutine, so the count needs no locking.
+type wasmFuelMeter struct{}
+
+func (wasmFuelMeter) NewFunctionListener(api.FunctionDefinition) experimental.FunctionListener {
+	return wasmFuelMeter{}
+}
+
+func (wasmFuelMeter) Before(ctx context.Context, _ api.Module, _ api.FunctionDefinition, _ []uint64, _ experimental.StackIterator) {
+	fuel, ok := ctx.Value(wasmFuelKey{}).(*wasmFuel)
+	if !ok {
+		return
+	}
+	if fuel.left--; fuel.left < 0 {
+		fuel.exhausted = true
+		panic(errOutOfFuel)
+	}
+}
+
+func (wasmFuelMeter) After(context.Context, api.Module, api.FunctionDefinition, []uint64) {}
+
+func (wasmFuelMeter) Abort(context.Context, api.Module, api.FunctionDefinition, error) {}
+
+// BackendRunner sends each program to the runner of its language's
+// backend, so languages can trade isolation for startup time separately
+type BackendRunner struct {
+	runners map[string]Runner
+}
+
+// NewBackendRunner routes programs to runners by backend name, such as
+// BackendProcess and BackendWasm
+func NewBackendRunner(runners map[string]Runner) *BackendRunner {
+	return &BackendRunner{runners: runners}
+}
+
+// Run executes prog on its language's backend
+func (b *BackendRunner) Run(ctx context.Context, prog Program) (*Result, error) {
+	tc, ok := lookupToolchain(prog.Language)
+	if !ok {
+		return nil, fmt.Errorf("unsupported language: %s", prog.Language)
+	}
+	runner, ok := b.runners[tc.Backend]
+	if !ok {
+		return nil, fmt.Errorf("%s runs on the %s backend, which is not configured", prog.Language, tc.Backend)
+	}
+	return runner.Run(ctx, prog)
+}
+
+// BuildCacheStats reports the process runner's build cache counters
+func (b *BackendRunner) BuildCacheStats() (BuildCacheStats, bool) {
+	if r, ok := b.runners[BackendProcess].(interface {
+		BuildCacheStats() (BuildCacheStats, bool)
+	}); ok {
+		return r.BuildCacheStats()
+	}
+	return BuildCacheStats{}, false
+}
+
+// qjsNodeShim is included before programs run under QuickJS. It supplies
+// the parts of node's API that the JavaScript drivers use.
+const qjsNodeShim = "__pp_node.js"
+
+const qjsNodeShimSource = `globalThis.require = (name) => {
+  if (name === 'fs') {
+    return {
+      readFileSync(file) {
+        const data = std.loadFile(file);
+        if (data === null) throw new Error("ENOENT: no such file or directory, open '" + file + "'");
+        return data;
+      },
+    };
+  }
+  throw new Error("Cannot find module '" + name + "'");
+};
+const __pp_stream = (f) => ({
+  write(s) {
+    f.puts(String(s));
+    f.flush();
+    return true;
+  },
+});
+globalThis.process = {
+  argv: ['qjs'].concat(scriptArgs),
+  env: {},
+  stdout: __pp_stream(std.out),
+  stderr: __pp_stream(std.err),
+  exit(code) {
+    std.out.flush();
+    std.exit(code || 0);
+  },
+  hrtime: { bigint: () => BigInt(Math.round(os.now() * 1000)) },
+};
+if (typeof console.error !== 'function') {
+  console.error = console.warn = (...args) => process.stderr.write(args.join(' ') + '\n');
+}
+if (typeof structuredClone !== 'function') {
+  globalThis.structuredClone = (value) => JSON.parse(JSON.stringify(value));
+}
+`
@@ -0,0 +1,29 @@
+-- Migration 013: Per-language entry points for graded exercises
+-- The sandbox harness calls this function with each test case's input
+
+ALTER TABLE exercise_starter_code ADD COLUMN entry_point TEXT;
+
+-- Backfill the seeded exercises (JavaScript and Go share camelCase names)
+UPDATE exercise_starter_code SET entry_point = (
+    SELECT CASE e.slug
+        WHEN 'sum-of-numbers' THEN 'sumToN'
+        WHEN 'array-sum' THEN 'arraySum'
+        WHEN 'multiplication-table' THEN 'multiplicationTable'
+        WHEN 'variable-swap' THEN 'swap'
+        WHEN 'temperature-converter' THEN 'celsiusToFahrenheit'
+    END
+    FROM exercises e WHERE e.id = exercise_starter_code.exercise_id
+)
+WHERE language IN ('javascript', 'go') AND entry_point IS NULL;
+
+UPDATE exercise_starter_code SET entry_point = (
+    SELECT CASE e.slug
+        WHEN 'sum-of-numbers' THEN 'sum_to_n'
+        WHEN 'array-sum' THEN 'array_sum'
+        WHEN 'multiplication-table' THEN 'multiplication_table'
+        WHEN 'variable-swap' THEN 'swap'
+        WHEN 'temperature-converter' THEN 'celsius_to_fahrenheit'
+    END
+    FROM exercises e WHERE e.id = exercise_starter_code.exercise_id
+)
+WHERE language = 'python' AND entry_point IS NULL;
@@ -0,0 +1,4 @@
+-- Migration 014: Per-exercise memory ceiling for sandboxed test runs
+-- NULL uses the sandbox default
+
+ALTER TABLE exercises ADD COLUMN memory_limit_mb INTEGER;
@@ -0,0 +1,4 @@
+-- Migration 015: Per-exercise import allowlist for the sandbox security policy
+-- JSON array of module names added to the language defaults, NULL for none
+
+ALTER TABLE exercises ADD COLUMN allowed_imports TEXT;
@@ -0,0 +1,5 @@
+-- Migration 016: Constructs a solution must use or avoid
+-- JSON arrays such as ["loop"] and ["sum", "reduce"]; NULL for none
+
+ALTER TABLE exercises ADD COLUMN required_constructs TEXT;
+ALTER TABLE exercises ADD COLUMN forbidden_constructs TEXT;
@@ -0,0 +1,4 @@
+-- Migration 017: Input generators for empirical complexity estimation
+-- JSON such as {"sizes": [1000, 2000, 4000, 8000], "input": [{"$ints": "$n"}]}
+
+ALTER TABLE exercises ADD COLUMN input_generator TEXT;
@@ -0,0 +1,4 @@
+-- Migration 018: Input schemas for random test cases checked against the reference solution
+-- JSON such as {"cases": 50, "args": [{"type": "array", "max": 20, "items": {"type": "int", "min": -100, "max": 100}}]}
+
+ALTER TABLE exercises ADD COLUMN input_schema TEXT;
@@ -0,0 +1,19 @@
+-- Migration 019: Runner definitions for the language registry
+-- The sandbox runs every active, sandbox-supported language that has a
+-- runner definition or a built-in one. A definition is JSON such as
+-- {"mainFile": "main.ts", "run": ["node", "{entry}"], "driver": "javascript",
+--  "limits": {"wallTimeMs": 5000, "memoryMb": 256}}
+-- where driver names the built-in test driver (javascript, python or go)
+-- and compile, env and support files are optional.
+
+ALTER TABLE languages ADD COLUMN runner TEXT;
+
+-- Python and Go have been runnable since the sandbox landed
+UPDATE languages SET sandbox_supported = 1 WHERE id IN ('javascript', 'python', 'go');
+
+-- TypeScript reuses the JavaScript driver through Node's type stripping
+-- (Node 22.6 or later). Enable it with is_active = 1, sandbox_supported = 1.
+UPDATE languages SET runner = '{"mainFile": "main.ts", "run": ["node", "--experimental-strip-types", "--disallow-code-generation-from-strings", "{entry}"], "env": ["NODE_NO_WARNINGS=1"], "driver": "javascript"}'
+WHERE id = 'typescript';
+
+-- Rust still needs a test driver before it can have a runner
@@ -0,0 +1,25 @@
+-- Migration 020: History of every run and submission
+-- exercise_completions keeps one row per user, exercise and language; this
+-- keeps each attempt so learners and mentors can see how a solution changed.
+-- results is the JSON array of test results the learner was shown.
+
+CREATE TABLE IF NOT EXISTS exercise_attempts (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    exercise_id TEXT NOT NULL,
+    language TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    code TEXT NOT NULL,
+    passed INTEGER NOT NULL DEFAULT 0,
+    tests_passed INTEGER NOT NULL DEFAULT 0,
+    tests_failed INTEGER NOT NULL DEFAULT 0,
+    score INTEGER,
+    error_type TEXT,
+    results TEXT,
+    execution_ms INTEGER,
+    created_at TEXT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (exercise_id) REFERENCES exercises(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_attempts_user_exercise ON exercise_attempts(user_id, exercise_id, created_at);
@@ -0,0 +1,32 @@
+-- Migration 021: Similar submissions, for spotting copied solutions
+-- The similarity analyzer compares each learner's latest passing submission
+-- with every other learner's for the same exercise and language. Pairs that
+-- score above its threshold are kept here. similarity_analyses records when
+-- each exercise and language was last compared, so only groups with new
+-- submissions are compared again.
+
+CREATE TABLE IF NOT EXISTS submission_similarity (
+    exercise_id TEXT NOT NULL,
+    language TEXT NOT NULL,
+    attempt_a TEXT NOT NULL,
+    attempt_b TEXT NOT NULL,
+    user_a TEXT NOT NULL,
+    user_b TEXT NOT NULL,
+    score REAL NOT NULL,
+    shared INTEGER NOT NULL,
+    computed_at TEXT NOT NULL,
+    PRIMARY KEY (attempt_a, attempt_b),
+    FOREIGN KEY (attempt_a) REFERENCES exercise_attempts(id) ON DELETE CASCADE,
+    FOREIGN KEY (attempt_b) REFERENCES exercise_attempts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_similarity_exercise ON submission_similarity(exercise_id, language, score);
+
+CREATE TABLE IF NOT EXISTS similarity_analyses (
+    exercise_id TEXT NOT NULL,
+    language TEXT NOT NULL,
+    submissions INTEGER NOT NULL,
+    latest_attempt_at TEXT NOT NULL,
+    analyzed_at TEXT NOT NULL,
+    PRIMARY KEY (exercise_id, language)
+);
@@ -0,0 +1,5 @@
+-- Migration 022: Language-neutral entry point signatures
+-- JSON such as {"name": "sum to n", "params": [{"name": "n", "type": "int"}], "returns": "int"}
+-- Each language derives its own function and parameter names, types and starter code from it.
+
+ALTER TABLE exercises ADD COLUMN signature TEXT;
@@ -0,0 +1,5 @@
+-- Migration 023: Per-test-case output checkers
+-- JSON such as {"type": "tolerance", "abs": 0.001} or {"type": "custom", "language": "python", "code": "..."}
+-- Test cases without one compare the returned value with expected_output exactly.
+
+ALTER TABLE exercise_test_cases ADD COLUMN checker TEXT;
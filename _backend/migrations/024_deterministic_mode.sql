@@ -0,0 +1,6 @@
+-- Migration 024: Deterministic execution mode
+-- Deterministic exercises run every test case with randomness seeded from the case ID
+-- and the wall clock frozen at the case's clock, an RFC 3339 time such as 2024-02-29T09:30:00Z.
+
+ALTER TABLE exercises ADD COLUMN deterministic INTEGER DEFAULT 0;
+ALTER TABLE exercise_test_cases ADD COLUMN clock TEXT;
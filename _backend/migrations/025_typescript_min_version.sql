@@ -0,0 +1,8 @@
+-- Migration 025: Minimum Node version for the TypeScript runner
+-- Type stripping arrived in Node 22.6 and the image ships Node 20, so TypeScript
+-- stays unsupported. With minVersion set the runtime inventory refuses an older
+-- Node even once an admin sets sandbox_supported = 1.
+
+UPDATE languages SET runner = '{"mainFile": "main.ts", "run": ["node", "--experimental-strip-types", "--disallow-code-generation-from-strings", "{entry}"], "env": ["NODE_NO_WARNINGS=1"], "minVersion": "22.6", "driver": "javascript"}',
+    sandbox_supported = 0
+WHERE id = 'typescript';
@@ -0,0 +1,6 @@
+-- Migration 026: Publication pending verification
+-- An edit to a published exercise commits it unpublished with a token in publish_pending,
+-- verifies it outside the write transaction, and publishes it again only while the token
+-- is still its own. A later edit replaces the token and takes over the publication.
+
+ALTER TABLE exercises ADD COLUMN publish_pending TEXT;